@@ -0,0 +1,145 @@
+package main
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// backupFile writes the backup of db since the version to the file, and
+// returns the version for the next incremental backup. The file is replaced
+// only once the backup is completely written.
+func backupFile(db sdk.Storage, path string, since uint64) (uint64, error) {
+	temp := path + ".tmp"
+
+	f, err := os.Create(temp)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(temp)
+
+	version, err := db.Backup(f, since)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.Rename(temp, path)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// backupFilePath returns the path of the backup file given by name within
+// the directory dir. The name must be relative and must not contain "..",
+// so that no backup is written outside the directory.
+func backupFilePath(dir, name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) || name[0] == '/' || name[0] == '\\' {
+		return "", errors.New("backup path must be relative to BackupPath")
+	}
+	for _, elem := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if elem == ".." {
+			return "", errors.New("backup path must not contain '..'")
+		}
+	}
+
+	path := filepath.Join(dir, name)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// restoreFiles restores db from the full backup file followed by its
+// incremental backup files.
+func restoreFiles(db sdk.Storage, force bool, paths ...string) error {
+	var backups = make([]io.Reader, 0, len(paths))
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		backups = append(backups, f)
+	}
+	return db.Restore(force, backups...)
+}
+
+// runTool runs the tool given by args against the database of conf:
+//
+//	backup [-since version] file
+//	restore [-force] file [incremental file ...]
+//	restore [-force] -snapshots dir
+func runTool(conf *sdk.Config, args []string) error {
+	if conf.Engine != sdk.ENGINE_FILE {
+		return fmt.Errorf("%s requires the %s engine", args[0], sdk.ENGINE_FILE)
+	}
+
+	switch args[0] {
+	case "backup":
+		var (
+			flags = flag.NewFlagSet("backup", flag.ExitOnError)
+			since = flags.Uint64("since", 0, "write the incremental backup since the version returned by the previous backup")
+		)
+		flags.Parse(args[1:])
+		if flags.NArg() != 1 {
+			return errors.New("usage: badgerlit backup [-since version] file")
+		}
+
+		db := badger.New(conf)
+		db.Start(context.Background())
+		defer db.Stop(context.Background())
+
+		version, err := backupFile(db, flags.Arg(0), *since)
+		if err != nil {
+			return err
+		}
+		fmt.Println(version)
+		return nil
+	case "restore":
+		var (
+			flags     = flag.NewFlagSet("restore", flag.ExitOnError)
+			force     = flags.Bool("force", false, "drop the existing keys before restoring")
+			snapshots = flags.String("snapshots", "", "restore the latest full snapshot in the directory and its incremental snapshots")
+		)
+		flags.Parse(args[1:])
+
+		var paths = flags.Args()
+		if *snapshots != "" {
+			if len(paths) > 0 {
+				return errors.New("usage: badgerlit restore [-force] -snapshots dir")
+			}
+
+			var err error
+			paths, err = badger.SnapshotFiles(*snapshots)
+			if err != nil {
+				return err
+			}
+		}
+		if len(paths) < 1 {
+			return errors.New("usage: badgerlit restore [-force] file [incremental file ...]")
+		}
+
+		db := badger.New(conf)
+		defer db.Stop(context.Background())
+
+		return restoreFiles(db, *force, paths...)
+	}
+	return fmt.Errorf("unknown command '%s'", args[0])
+}
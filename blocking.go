@@ -0,0 +1,183 @@
+package main
+
+import (
+	"badgerlit/sdk"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+// BlockingCommandFunc handles a command which blocks the client until one
+// of keys is available. It returns blocked = true without any reply when the
+// command cannot be served yet, and will be called again once some of the
+// keys were pushed. Within MULTI the command never blocks and replies nil.
+type BlockingCommandFunc func(conn ReplyWriter, db sdk.Operations, args []resp.Value) (keys [][]byte, timeout time.Duration, blocked bool)
+
+// waiter is a client blocked by a command.
+type waiter struct {
+	keys  [][]byte
+	serve func(conn ReplyWriter) bool
+	reply chan resp.Value
+	done  bool
+}
+
+// blockingRegistry keeps the blocked clients by keys, and serves them in
+// the order they were blocked when the keys are pushed.
+type blockingRegistry struct {
+	mutex   sync.Mutex
+	waiters map[string][]*waiter
+
+	// NOTE: the keys are queued by the storage listener, which might be
+	// called while serving the waiters, so it is guarded by another mutex.
+	pendingMutex sync.Mutex
+	pending      [][]byte
+	signal       chan struct{}
+}
+
+func newBlockingRegistry() *blockingRegistry {
+	return &blockingRegistry{
+		waiters: make(map[string][]*waiter),
+		signal:  make(chan struct{}, 1),
+	}
+}
+
+// listen is the sdk.EventListener which queues the pushed keys.
+func (r *blockingRegistry) listen(event sdk.KeyEvent) {
+	switch event.Event {
+	case "lpush", "rpush":
+	default:
+		return
+	}
+
+	r.pendingMutex.Lock()
+	r.pending = append(r.pending, event.Key)
+	r.pendingMutex.Unlock()
+
+	select {
+	case r.signal <- struct{}{}:
+	default:
+	}
+}
+
+// run serves the waiters of the queued keys.
+func (r *blockingRegistry) run() {
+	for range r.signal {
+		r.pendingMutex.Lock()
+		pending := r.pending
+		r.pending = nil
+		r.pendingMutex.Unlock()
+
+		for _, key := range pending {
+			r.serveKey(key)
+		}
+	}
+}
+
+func (r *blockingRegistry) serveKey(key []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for {
+		waiters := r.waiters[string(key)]
+		if len(waiters) == 0 {
+			return
+		}
+
+		var (
+			w     = waiters[0]
+			reply = &replyBuffer{}
+		)
+		if !w.serve(reply) {
+			return
+		}
+		r.remove(w)
+		w.done = true
+		w.reply <- reply.value
+	}
+}
+
+// block serves the command immediately if possible, otherwise it registers
+// a waiter of the keys. It returns nil if the command has been served.
+func (r *blockingRegistry) block(conn ReplyWriter, db sdk.Operations, handler BlockingCommandFunc, args []resp.Value) (*waiter, time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// NOTE: the first attempt is made with the lock held, so the keys
+	// pushed after the attempt will not be missed.
+	keys, timeout, blocked := handler(conn, db, args)
+	if !blocked {
+		return nil, 0
+	}
+
+	w := &waiter{
+		keys:  keys,
+		reply: make(chan resp.Value, 1),
+		serve: func(conn ReplyWriter) bool {
+			_, _, blocked := handler(conn, db, args)
+			return !blocked
+		},
+	}
+	for _, key := range keys {
+		r.waiters[string(key)] = append(r.waiters[string(key)], w)
+	}
+	return w, timeout
+}
+
+// cancel removes the waiter. It returns false if the waiter has been served.
+func (r *blockingRegistry) cancel(w *waiter) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if w.done {
+		return false
+	}
+	r.remove(w)
+	return true
+}
+
+func (r *blockingRegistry) remove(w *waiter) {
+	for _, key := range w.keys {
+		waiters := r.waiters[string(key)]
+		for i := range waiters {
+			if waiters[i] == w {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(r.waiters, string(key))
+		} else {
+			r.waiters[string(key)] = waiters
+		}
+	}
+}
+
+// parseTimeout parses the timeout of blocking commands in seconds. Zero
+// means blocking indefinitely.
+func parseTimeout(arg resp.Value) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(arg.String(), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, errors.New("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, errors.New("ERR timeout is negative")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// parseListDirection parses LEFT or RIGHT of list commands. It returns true
+// for LEFT.
+func parseListDirection(arg resp.Value) (bool, error) {
+	switch strings.ToUpper(arg.String()) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	}
+	return false, errors.New("ERR syntax error")
+}
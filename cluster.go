@@ -0,0 +1,690 @@
+package main
+
+import (
+	"badgerlit/sdk"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+const (
+	SLOT_STATE_IMPORTING = "IMPORTING"
+	SLOT_STATE_MIGRATING = "MIGRATING"
+	SLOT_STATE_NODE      = "NODE"
+	SLOT_STATE_STABLE    = "STABLE"
+
+	// the keys of a migrating slot are moved in batches
+	migrateBatchSize = 100
+	migrateTimeout   = 5 * time.Second
+	migrateRetries   = 3
+)
+
+// keySpec locates the keys in the arguments of a command, which are the
+// arguments from first to last stepping by step. The negative last counts
+// from the end of the arguments.
+type keySpec struct {
+	first int
+	last  int
+	step  int
+}
+
+// commandKeySpecs lists the commands which access the keys; the others are
+// served by any node of the cluster.
+var commandKeySpecs = map[string]keySpec{
+	"BLMOVE":         {1, 2, 1},
+	"BLPOP":          {1, -2, 1},
+	"BRPOP":          {1, -2, 1},
+	"DEL":            {1, -1, 1},
+	"DUMP":           {1, 1, 1},
+	"EXISTS":         {1, -1, 1},
+	"EXPIRE":         {1, 1, 1},
+	"GET":            {1, 1, 1},
+	"HDEL":           {1, 1, 1},
+	"HEXISTS":        {1, 1, 1},
+	"HGET":           {1, 1, 1},
+	"HGETALL":        {1, 1, 1},
+	"HINCRBY":        {1, 1, 1},
+	"HINCRBYFLOAT":   {1, 1, 1},
+	"HLEN":           {1, 1, 1},
+	"HSCAN":          {1, 1, 1},
+	"HSET":           {1, 1, 1},
+	"INCRBY":         {1, 1, 1},
+	"INCRBYFLOAT":    {1, 1, 1},
+	"LLEN":           {1, 1, 1},
+	"LMOVE":          {1, 2, 1},
+	"LOCKACQUIRE":    {1, 1, 1},
+	"LOCKRELEASE":    {1, 1, 1},
+	"LOCKRENEW":      {1, 1, 1},
+	"LPOP":           {1, 1, 1},
+	"LPUSH":          {1, 1, 1},
+	"LRANGE":         {1, 1, 1},
+	"MGET":           {1, -1, 1},
+	"MSET":           {1, -1, 2},
+	"MSETNX":         {1, -1, 2},
+	"PERSIST":        {1, 1, 1},
+	"QACK":           {1, 1, 1},
+	"QLEN":           {1, 1, 1},
+	"QPUSH":          {1, 1, 1},
+	"QRECEIVE":       {1, 1, 1},
+	"RATELIMIT":      {1, 1, 1},
+	"RESTORE":        {1, 1, 1},
+	"RESTORE-ASKING": {1, 1, 1},
+	"RPOP":           {1, 1, 1},
+	"RPUSH":          {1, 1, 1},
+	"SADD":           {1, 1, 1},
+	"SCARD":          {1, 1, 1},
+	"SDIFF":          {1, -1, 1},
+	"SET":            {1, 1, 1},
+	"SINTER":         {1, -1, 1},
+	"SISMEMBER":      {1, 1, 1},
+	"SMEMBERS":       {1, 1, 1},
+	"SREM":           {1, 1, 1},
+	"SUNION":         {1, -1, 1},
+	"TRANSFER":       {1, 2, 1},
+	"TSADD":          {1, 1, 1},
+	"TSCARD":         {1, 1, 1},
+	"TSISMEMBER":     {1, 1, 1},
+	"TSREM":          {1, 1, 1},
+	"TTL":            {1, 1, 1},
+	"TYPE":           {1, 1, 1},
+	"WATCH":          {1, -1, 1},
+	"ZADD":           {1, 1, 1},
+	"ZCARD":          {1, 1, 1},
+	"ZINCRBY":        {1, 1, 1},
+	"ZRANGE":         {1, 1, 1},
+	"ZRANGEBYSCORE":  {1, 1, 1},
+	"ZRANK":          {1, 1, 1},
+	"ZREM":           {1, 1, 1},
+	"ZREVRANK":       {1, 1, 1},
+	"ZSCORE":         {1, 1, 1},
+}
+
+// commandKeyOptions lists the options of the commands which are followed by
+// a key, after the keys located by commandKeySpecs.
+var commandKeyOptions = map[string]string{
+	"QRECEIVE": "DEADLETTER",
+}
+
+// commandKeys returns the keys in the arguments of the command.
+func commandKeys(command string, args []resp.Value) [][]byte {
+	spec, ok := commandKeySpecs[command]
+	if !ok {
+		return nil
+	}
+
+	var last = spec.last
+	if last < 0 {
+		last += len(args)
+	}
+	if last >= len(args) {
+		last = len(args) - 1
+	}
+
+	var keys [][]byte
+	for i := spec.first; i <= last; i += spec.step {
+		keys = append(keys, args[i].Bytes())
+	}
+	if option, ok := commandKeyOptions[command]; ok {
+		for i := last + 1; i+1 < len(args); i++ {
+			if strings.EqualFold(args[i].String(), option) {
+				keys = append(keys, args[i+1].Bytes())
+				i++
+			}
+		}
+	}
+	return keys
+}
+
+// parseSlot returns the slot given by the argument.
+func parseSlot(arg resp.Value) (int, error) {
+	slot, err := strconv.Atoi(arg.String())
+	if err != nil || slot < 0 || slot >= sdk.CLUSTER_SLOTS {
+		return 0, errors.New("ERR Invalid or out of range slot")
+	}
+	return slot, nil
+}
+
+// cluster keeps the owners of the hash slots of the sharded cluster, and
+// redirects the commands of the keys owned by the other nodes. The nodes
+// do not gossip; the owners of a slot are changed by CLUSTER SETSLOT NODE,
+// which is sent to every node once the slot is migrated.
+type cluster struct {
+	id        string
+	nodes     []sdk.ClusterNode // in the order of the config, with the configured slots
+	stateFile string
+
+	mutex     sync.RWMutex
+	owners    [sdk.CLUSTER_SLOTS]string // id of the owner; empty if unassigned
+	migrating map[int]string            // id of the node which the slot is migrating to
+	importing map[int]string            // id of the node which the slot is importing from
+}
+
+func newCluster(conf *sdk.Config) (*cluster, error) {
+	// NOTE: the topology had been validated with the config
+	nodes, _ := conf.ClusterTopology()
+
+	c := &cluster{
+		id:        conf.ClusterNodeID,
+		nodes:     nodes,
+		stateFile: conf.ClusterStateFile,
+		migrating: make(map[int]string),
+		importing: make(map[int]string),
+	}
+	for _, node := range nodes {
+		c.assign(node.ID, node.Slots)
+	}
+
+	if c.stateFile == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(c.stateFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c, nil
+		}
+		return nil, err
+	}
+
+	var state map[string][]sdk.SlotRange
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster state file %s: %v", c.stateFile, err)
+	}
+
+	c.owners = [sdk.CLUSTER_SLOTS]string{}
+	for id, slots := range state {
+		if _, ok := c.node(id); !ok {
+			return nil, fmt.Errorf("invalid cluster state file %s: unknown node '%s'", c.stateFile, id)
+		}
+		for _, r := range slots {
+			if r.Start < 0 || r.End >= sdk.CLUSTER_SLOTS || r.Start > r.End {
+				return nil, fmt.Errorf("invalid cluster state file %s: invalid slots %d-%d", c.stateFile, r.Start, r.End)
+			}
+		}
+		c.assign(id, slots)
+	}
+	return c, nil
+}
+
+func (c *cluster) assign(id string, slots []sdk.SlotRange) {
+	for _, r := range slots {
+		for slot := r.Start; slot <= r.End; slot++ {
+			c.owners[slot] = id
+		}
+	}
+}
+
+func (c *cluster) node(id string) (sdk.ClusterNode, bool) {
+	for _, node := range c.nodes {
+		if node.ID == id {
+			return node, true
+		}
+	}
+	return sdk.ClusterNode{}, false
+}
+
+// route returns the error which redirects the command to the node serving
+// its keys, or nil if the command is served by this node. The keys of the
+// slot migrating to another node are served until they are moved, and the
+// keys of the slot importing from another node are served if asking is
+// true.
+func (c *cluster) route(db sdk.Storage, command string, args []resp.Value, asking bool) error {
+	keys := commandKeys(command, args)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	var slot = sdk.KeySlot(keys[0])
+	for _, key := range keys[1:] {
+		if sdk.KeySlot(key) != slot {
+			return errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+
+	c.mutex.RLock()
+	var (
+		owner     = c.owners[slot]
+		migrating = c.migrating[slot]
+		importing = c.importing[slot]
+	)
+	c.mutex.RUnlock()
+
+	if owner != c.id {
+		if importing != "" && asking {
+			return nil
+		}
+		node, ok := c.node(owner)
+		if !ok {
+			return errors.New("CLUSTERDOWN Hash slot not served")
+		}
+		return fmt.Errorf("MOVED %d %s", slot, node.Address)
+	}
+	if migrating == "" {
+		return nil
+	}
+
+	var missing = 0
+	for _, key := range keys {
+		count, err := db.Exists(key)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			missing++
+		}
+	}
+	switch {
+	case missing == 0:
+		return nil
+	case missing < len(keys):
+		return errors.New("TRYAGAIN Multiple keys request during rehashing of slot")
+	}
+	node, _ := c.node(migrating)
+	return fmt.Errorf("ASK %d %s", slot, node.Address)
+}
+
+// topology returns the nodes with the slots they own.
+func (c *cluster) topology() []sdk.ClusterNode {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var (
+		nodes = make([]sdk.ClusterNode, 0, len(c.nodes))
+		index = make(map[string]int)
+	)
+	for i, node := range c.nodes {
+		nodes = append(nodes, sdk.ClusterNode{
+			ID:      node.ID,
+			Address: node.Address,
+		})
+		index[node.ID] = i
+	}
+
+	for slot := 0; slot < sdk.CLUSTER_SLOTS; slot++ {
+		owner := c.owners[slot]
+		if owner == "" {
+			continue
+		}
+		node := &nodes[index[owner]]
+		if n := len(node.Slots); n > 0 && node.Slots[n-1].End == slot-1 {
+			node.Slots[n-1].End = slot
+		} else {
+			node.Slots = append(node.Slots, sdk.SlotRange{Start: slot, End: slot})
+		}
+	}
+	return nodes
+}
+
+// setSlot changes the state of the slot as CLUSTER SETSLOT does. The owner
+// set by SLOT_STATE_NODE is saved to the state file, and the node refuses
+// to give away the slot while it still holds keys of the slot.
+func (c *cluster) setSlot(db sdk.Storage, slot int, state string, id string) error {
+	if state != SLOT_STATE_STABLE {
+		if _, ok := c.node(id); !ok {
+			return fmt.Errorf("ERR I don't know about node %s", id)
+		}
+	}
+
+	if state == SLOT_STATE_NODE && id != c.id {
+		keys, _, err := db.SlotKeys(slot, nil, 1)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			return fmt.Errorf("ERR Can't assign hashslot %d to a different node while I still hold keys for this hash slot.", slot)
+		}
+	}
+	return c.updateSlot(slot, state, id)
+}
+
+// updateSlot changes the state of the slot without checking the keys of the
+// slot.
+func (c *cluster) updateSlot(slot int, state string, id string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch state {
+	case SLOT_STATE_IMPORTING:
+		if c.owners[slot] == c.id {
+			return fmt.Errorf("ERR I'm already the owner of hash slot %d", slot)
+		}
+		c.importing[slot] = id
+	case SLOT_STATE_MIGRATING:
+		if c.owners[slot] != c.id {
+			return fmt.Errorf("ERR I'm not the owner of hash slot %d", slot)
+		}
+		c.migrating[slot] = id
+	case SLOT_STATE_STABLE:
+		delete(c.importing, slot)
+		delete(c.migrating, slot)
+	case SLOT_STATE_NODE:
+		delete(c.importing, slot)
+		delete(c.migrating, slot)
+		if c.owners[slot] != id {
+			c.owners[slot] = id
+			return c.save()
+		}
+	}
+	return nil
+}
+
+// save writes the owners of the slots to the state file, if any. The mutex
+// must be held.
+func (c *cluster) save() error {
+	if c.stateFile == "" {
+		return nil
+	}
+
+	var state = make(map[string][]sdk.SlotRange)
+	for slot := 0; slot < sdk.CLUSTER_SLOTS; slot++ {
+		owner := c.owners[slot]
+		if owner == "" {
+			continue
+		}
+		slots := state[owner]
+		if n := len(slots); n > 0 && slots[n-1].End == slot-1 {
+			slots[n-1].End = slot
+		} else {
+			state[owner] = append(slots, sdk.SlotRange{Start: slot, End: slot})
+		}
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(c.stateFile), 0755)
+	if err != nil {
+		return err
+	}
+	tmp := c.stateFile + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.stateFile)
+}
+
+// slotsReply returns the reply of CLUSTER SLOTS.
+func (c *cluster) slotsReply() []resp.Value {
+	var reply []resp.Value
+	for _, node := range c.topology() {
+		host, port, _ := net.SplitHostPort(node.Address)
+		portValue, _ := strconv.Atoi(port)
+
+		for _, r := range node.Slots {
+			reply = append(reply, resp.ArrayValue([]resp.Value{
+				resp.IntegerValue(r.Start),
+				resp.IntegerValue(r.End),
+				resp.ArrayValue([]resp.Value{
+					resp.StringValue(host),
+					resp.IntegerValue(portValue),
+					resp.StringValue(node.ID),
+				}),
+			}))
+		}
+	}
+	return reply
+}
+
+// nodesReply returns the reply of CLUSTER NODES.
+func (c *cluster) nodesReply() string {
+	var (
+		nodes = c.topology()
+		b     strings.Builder
+	)
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, node := range nodes {
+		var flags = "master"
+		if node.ID == c.id {
+			flags = "myself,master"
+		}
+		fmt.Fprintf(&b, "%s %s@0 %s - 0 0 0 connected", node.ID, node.Address, flags)
+
+		for _, r := range node.Slots {
+			if r.Start == r.End {
+				fmt.Fprintf(&b, " %d", r.Start)
+			} else {
+				fmt.Fprintf(&b, " %d-%d", r.Start, r.End)
+			}
+		}
+		if node.ID == c.id {
+			for slot, id := range c.migrating {
+				fmt.Fprintf(&b, " [%d->-%s]", slot, id)
+			}
+			for slot, id := range c.importing {
+				fmt.Fprintf(&b, " [%d-<-%s]", slot, id)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// infoReply returns the reply of CLUSTER INFO.
+func (c *cluster) infoReply() string {
+	var (
+		nodes    = c.topology()
+		assigned = 0
+		size     = 0
+		state    = "ok"
+	)
+	for _, node := range nodes {
+		if len(node.Slots) > 0 {
+			size++
+		}
+		for _, r := range node.Slots {
+			assigned += r.End - r.Start + 1
+		}
+	}
+	if assigned < sdk.CLUSTER_SLOTS {
+		state = "fail"
+	}
+
+	return fmt.Sprintf("cluster_state:%s\r\n"+
+		"cluster_slots_assigned:%d\r\n"+
+		"cluster_slots_ok:%d\r\n"+
+		"cluster_slots_pfail:0\r\n"+
+		"cluster_slots_fail:0\r\n"+
+		"cluster_known_nodes:%d\r\n"+
+		"cluster_size:%d\r\n"+
+		"cluster_current_epoch:0\r\n"+
+		"cluster_my_epoch:0\r\n",
+		state, assigned, assigned, len(nodes), size)
+}
+
+// migrateSlot moves the slot with its keys to the node, and then tells all
+// nodes the new owner of the slot.
+func (c *cluster) migrateSlot(db sdk.Storage, slot int, id string) error {
+	node, ok := c.node(id)
+	if !ok {
+		return fmt.Errorf("ERR I don't know about node %s", id)
+	}
+	if id == c.id {
+		return fmt.Errorf("ERR I'm already the owner of hash slot %d", slot)
+	}
+
+	_, err := clusterCall(node.Address, "CLUSTER", "SETSLOT", strconv.Itoa(slot), SLOT_STATE_IMPORTING, c.id)
+	if err != nil {
+		return err
+	}
+	err = c.setSlot(db, slot, SLOT_STATE_MIGRATING, id)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: a single pass moves all keys of the slot, since the keys which
+	// are missing from a migrating slot are created on the importing node.
+	var cursor []byte
+	for {
+		keys, next, err := db.SlotKeys(slot, cursor, migrateBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			_, err = migrateKeys(db, node.Address, keys, migrateTimeout, false, true)
+			if err != nil {
+				return err
+			}
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+
+	_, err = clusterCall(node.Address, "CLUSTER", "SETSLOT", strconv.Itoa(slot), SLOT_STATE_NODE, id)
+	if err != nil {
+		return err
+	}
+	err = c.updateSlot(slot, SLOT_STATE_NODE, id)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: the nodes which miss the new owner still redirect the clients
+	// to this node, which redirects them to the new owner.
+	for _, other := range c.nodes {
+		if other.ID == c.id || other.ID == id {
+			continue
+		}
+		_, err = clusterCall(other.Address, "CLUSTER", "SETSLOT", strconv.Itoa(slot), SLOT_STATE_NODE, id)
+		if err != nil {
+			log.Printf("cluster: failed to tell %s the owner of slot %d: %v", other.ID, slot, err)
+		}
+	}
+	return nil
+}
+
+// migrateKeys restores the keys on the node at address, and deletes them
+// unless keep is true. It returns the number of the keys which exist. A key
+// changed while it is being moved is moved again.
+func migrateKeys(db sdk.Storage, address string, keys [][]byte, timeout time.Duration, keep bool, replace bool) (int, error) {
+	netConn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return 0, fmt.Errorf("IOERR error or timeout connecting to the client: %v", err)
+	}
+	defer netConn.Close()
+
+	var (
+		conn  = resp.NewConn(netConn)
+		moved = 0
+	)
+	for _, key := range keys {
+		for attempt := 0; ; attempt++ {
+			watches, err := db.Watch(key)
+			if err != nil {
+				return moved, err
+			}
+			payload, err := db.DumpKey(key)
+			if err != nil {
+				if errors.Is(err, sdk.ErrNil) {
+					break
+				}
+				return moved, err
+			}
+			_, ttl, err := db.Ttl(key)
+			if err != nil {
+				return moved, err
+			}
+
+			var restoreArgs = []any{key, 0, payload}
+			if ttl >= 0 {
+				// NOTE: the key expiring within the second is restored with
+				// the shortest ttl instead of no ttl
+				restoreArgs[1] = ttl*1000 + 1
+			}
+			if replace || attempt > 0 {
+				restoreArgs = append(restoreArgs, "REPLACE")
+			}
+
+			netConn.SetDeadline(time.Now().Add(timeout))
+			err = conn.WriteMultiBulk("RESTORE-ASKING", restoreArgs...)
+			if err != nil {
+				return moved, fmt.Errorf("IOERR error or timeout writing to target instance: %v", err)
+			}
+			v, _, err := conn.ReadValue()
+			if err != nil {
+				return moved, fmt.Errorf("IOERR error or timeout reading to target instance: %v", err)
+			}
+			if v.Type() == resp.Error {
+				return moved, fmt.Errorf("ERR Target instance replied with error: %s", v.String())
+			}
+
+			if keep {
+				moved++
+				break
+			}
+			err = db.Multi(watches, func(ops sdk.Operations) error {
+				_, err := ops.Del(key)
+				return err
+			})
+			if err != nil {
+				if errors.Is(err, sdk.ErrTxnAborted) && attempt < migrateRetries {
+					continue
+				}
+				return moved, err
+			}
+			moved++
+			break
+		}
+	}
+	return moved, nil
+}
+
+// clusterCall sends the command to the node at address, and returns its
+// reply.
+func clusterCall(address string, command string, args ...any) (resp.Value, error) {
+	netConn, err := net.DialTimeout("tcp", address, migrateTimeout)
+	if err != nil {
+		return resp.Value{}, err
+	}
+	defer netConn.Close()
+
+	netConn.SetDeadline(time.Now().Add(migrateTimeout))
+	conn := resp.NewConn(netConn)
+	err = conn.WriteMultiBulk(command, args...)
+	if err != nil {
+		return resp.Value{}, err
+	}
+	v, _, err := conn.ReadValue()
+	if err != nil {
+		return resp.Value{}, err
+	}
+	if v.Type() == resp.Error {
+		return v, v.Error()
+	}
+	return v, nil
+}
+
+// parseRestore returns the arguments of the Restore command.
+func parseRestore(name string, args []resp.Value) (key []byte, payload []byte, ttl time.Duration, replace bool, err error) {
+	if len(args) < 4 {
+		return nil, nil, 0, false, errors.New("ERR wrong number of arguments for '" + name + "' command")
+	}
+
+	ms, err := strconv.ParseInt(args[2].String(), 10, 64)
+	if err != nil || ms < 0 {
+		return nil, nil, 0, false, errors.New("ERR Invalid TTL value, must be >= 0")
+	}
+	for _, arg := range args[4:] {
+		if strings.ToUpper(arg.String()) != "REPLACE" {
+			return nil, nil, 0, false, errors.New("ERR syntax error")
+		}
+		replace = true
+	}
+	return args[1].Bytes(), args[3].Bytes(), time.Duration(ms) * time.Millisecond, replace, nil
+}
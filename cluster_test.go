@@ -0,0 +1,132 @@
+package main
+
+import (
+	"badgerlit/sdk"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/resp"
+)
+
+func TestCluster_Route(t *testing.T) {
+	s, addr := startTestServer(t, sdk.Config{
+		ClusterNodeID: "n1",
+		ClusterNodes: []string{
+			"n1 127.0.0.1:7001 0-8191",
+			"n2 127.0.0.1:7002 8192-16383",
+		},
+	})
+	client := dialTestServer(t, addr)
+
+	// key returns a key of the slots of the node, with the hash tag
+	key := func(tag string, owner string) string {
+		for i := 0; ; i++ {
+			key := fmt.Sprintf("{%s%d}", tag, i)
+			if s.cluster.owners[sdk.KeySlot([]byte(key))] == owner {
+				return key
+			}
+		}
+	}
+	var (
+		local  = key("local", "n1")
+		remote = key("remote", "n2")
+		slot   = strconv.Itoa(sdk.KeySlot([]byte(local)))
+	)
+
+	expectError := func(v resp.Value, prefix string) {
+		t.Helper()
+		if v.Type() != resp.Error || !strings.HasPrefix(v.Error().Error(), prefix) {
+			t.Errorf("expect %s, but got %v", prefix, v)
+		}
+	}
+
+	if v := client.do("SET", local, "1"); v.Type() == resp.Error {
+		t.Fatalf("expect the local key to be served, but got %v", v)
+	}
+	expectError(client.do("GET", remote), fmt.Sprintf("MOVED %d 127.0.0.1:7002", sdk.KeySlot([]byte(remote))))
+	expectError(client.do("MGET", local, remote), "CROSSSLOT")
+	expectError(client.do("QRECEIVE", local+".q", "1000", "DEADLETTER", remote), "CROSSSLOT")
+	expectError(client.do("QRECEIVE", local+".q", "1000", "deadletter", remote), "CROSSSLOT")
+	if v := client.do("QRECEIVE", local+".q", "1000", "DEADLETTER", local+".dead"); v.Type() == resp.Error {
+		t.Errorf("expect the dead letters of the same slot to be served, but got %v", v)
+	}
+
+	// the migrating slot serves the existing keys, and asks for the others
+	if v := client.do("CLUSTER", "SETSLOT", slot, "MIGRATING", "n2"); v.Type() == resp.Error {
+		t.Fatal(v)
+	}
+	if v := client.do("GET", local); v.String() != "1" {
+		t.Errorf("expect the existing key to be served, but got %v", v)
+	}
+	expectError(client.do("GET", local+".missing"), "ASK "+slot+" 127.0.0.1:7002")
+	expectError(client.do("MGET", local, local+".missing"), "TRYAGAIN")
+	if v := client.do("CLUSTER", "SETSLOT", slot, "STABLE"); v.Type() == resp.Error {
+		t.Fatal(v)
+	}
+
+	// the importing slot serves the keys asked only
+	remoteSlot := strconv.Itoa(sdk.KeySlot([]byte(remote)))
+	if v := client.do("CLUSTER", "SETSLOT", remoteSlot, "IMPORTING", "n2"); v.Type() == resp.Error {
+		t.Fatal(v)
+	}
+	expectError(client.do("GET", remote), "MOVED")
+	client.do("ASKING")
+	if v := client.do("GET", remote); v.Type() == resp.Error {
+		t.Errorf("expect the asked key to be served, but got %v", v)
+	}
+	expectError(client.do("GET", remote), "MOVED")
+}
+
+func TestCluster_SlotKeys(t *testing.T) {
+	s, addr := startTestServer(t, sdk.Config{
+		ClusterNodeID: "n1",
+		ClusterNodes:  []string{"n1 127.0.0.1:7001 0-16383"},
+	})
+	client := dialTestServer(t, addr)
+
+	for i := 0; i < 2500; i++ {
+		if v := client.do("SET", fmt.Sprintf("key:%d", i), "1"); v.Type() == resp.Error {
+			t.Fatal(v)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if v := client.do("SET", fmt.Sprintf("{tag}%d", i), "1"); v.Type() == resp.Error {
+			t.Fatal(v)
+		}
+	}
+
+	// the keys of the slot are scanned once each from the cursor
+	var (
+		slot   = sdk.KeySlot([]byte("tag"))
+		seen   = make(map[string]bool)
+		cursor []byte
+	)
+	for {
+		keys, next, err := s.db.SlotKeys(slot, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range keys {
+			if seen[string(key)] {
+				t.Errorf("expect %s to be scanned once", key)
+			}
+			seen[string(key)] = true
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+
+	var expected = 5
+	for i := 0; i < 2500; i++ {
+		if sdk.KeySlot([]byte(fmt.Sprintf("key:%d", i))) == slot {
+			expected++
+		}
+	}
+	if len(seen) != expected {
+		t.Errorf("expect %d keys of the slot, but got %d", expected, len(seen))
+	}
+}
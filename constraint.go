@@ -0,0 +1,94 @@
+package main
+
+import (
+	"badgerlit/sdk"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/resp"
+)
+
+// parseIntegerConstraint parses the constraint clause which keyword is
+// args[i]. It returns the index of the last argument consumed.
+func parseIntegerConstraint(args []resp.Value, i int) (sdk.Constraint[int64], int, error) {
+	// is EOF?
+	if i+1 >= len(args) {
+		return nil, i, errors.New("ERR missing constraint type")
+	}
+	i++
+	constraintType := strings.ToUpper(args[i].String())
+	switch constraintType {
+	case "<=", "LE", "LESS_OR_EQUAL":
+		// is EOF?
+		if i+1 >= len(args) {
+			return nil, i, errors.New("ERR missing constraint criteria")
+		}
+		i++
+		var criteria int64 = int64(args[i].Integer())
+		return sdk.IntegerLessOrEqual(criteria), i, nil
+	case ">=", "GE", "GREATER_OR_EQUAL":
+		// is EOF?
+		if i+1 >= len(args) {
+			return nil, i, errors.New("ERR missing constraint criteria")
+		}
+		i++
+		var criteria int64 = int64(args[i].Integer())
+		return sdk.IntegerGreaterOrEqual(criteria), i, nil
+	case "NON_NEGATIVE":
+		return sdk.IntegerNonNegativeValue(), i, nil
+	case "NON_ZERO":
+		return sdk.IntegerNonZero(), i, nil
+	}
+	return nil, i, errors.New(fmt.Sprintf("ERR unsupported constraint type '%s'", constraintType))
+}
+
+// parseNumberConstraint parses the constraint clause which keyword is
+// args[i]. It returns the index of the last argument consumed.
+func parseNumberConstraint(args []resp.Value, i int) (sdk.Constraint[float64], int, error) {
+	// is EOF?
+	if i+1 >= len(args) {
+		return nil, i, errors.New("ERR missing constraint type")
+	}
+	i++
+	constraintType := strings.ToUpper(args[i].String())
+	switch constraintType {
+	case "<", "LT", "LESS":
+		// is EOF?
+		if i+1 >= len(args) {
+			return nil, i, errors.New("ERR missing constraint criteria")
+		}
+		i++
+		var criteria = args[i].Float()
+		return sdk.NumberLess(criteria), i, nil
+	case "<=", "LE", "LESS_OR_EQUAL":
+		// is EOF?
+		if i+1 >= len(args) {
+			return nil, i, errors.New("ERR missing constraint criteria")
+		}
+		i++
+		var criteria = args[i].Float()
+		return sdk.NumberLessOrEqual(criteria), i, nil
+	case ">", "GT", "GREATER":
+		// is EOF?
+		if i+1 >= len(args) {
+			return nil, i, errors.New("ERR missing constraint criteria")
+		}
+		i++
+		var criteria = args[i].Float()
+		return sdk.NumberGreater(criteria), i, nil
+	case ">=", "GE", "GREATER_OR_EQUAL":
+		// is EOF?
+		if i+1 >= len(args) {
+			return nil, i, errors.New("ERR missing constraint criteria")
+		}
+		i++
+		var criteria = args[i].Float()
+		return sdk.NumberGreaterOrEqual(criteria), i, nil
+	case "NON_NEGATIVE":
+		return sdk.NumberNonNegativeValue(), i, nil
+	case "NON_ZERO":
+		return sdk.NumberNonZero(), i, nil
+	}
+	return nil, i, errors.New(fmt.Sprintf("ERR unsupported constraint type '%s'", constraintType))
+}
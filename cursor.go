@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+const (
+	__CURSOR_BEGIN = "0"
+)
+
+// encodeCursor encodes the key where the next scan starts from. The
+// encoded cursor of nil is "0", which means the scan has completed.
+func encodeCursor(key []byte) string {
+	if len(key) == 0 {
+		return __CURSOR_BEGIN
+	}
+	return hex.EncodeToString(key)
+}
+
+// decodeCursor decodes the cursor which is encoded by encodeCursor. The
+// cursor "0" or an empty cursor means the scan starts from the beginning.
+func decodeCursor(cursor string) ([]byte, error) {
+	if len(cursor) == 0 || cursor == __CURSOR_BEGIN {
+		return nil, nil
+	}
+
+	key, err := hex.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("ERR invalid cursor")
+	}
+	return key, nil
+}
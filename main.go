@@ -8,6 +8,8 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -19,6 +21,7 @@ import (
 
 var (
 	DefaultConfigFile = "config.yaml"
+	DefaultScanCount  = 10
 
 	configFile = flag.String("config", DefaultConfigFile, "specified config file. Default: config.yaml")
 )
@@ -31,11 +34,19 @@ func main() {
 	)
 
 	conf := sdk.Config{
-		ListenAddress:      sdk.DefaultListenAddress,
-		Engine:             sdk.DefaultEngine,
-		DataPath:           sdk.DefaultDataPath,
-		KeyDiscardInterval: sdk.DefaultKeyDiscardInterval,
-		KeyDiscardRatio:    sdk.DefaultKeyDiscardRatio,
+		ListenAddress:        sdk.DefaultListenAddress,
+		Engine:               sdk.DefaultEngine,
+		DataPath:             sdk.DefaultDataPath,
+		KeyDiscardInterval:   sdk.DefaultKeyDiscardInterval,
+		KeyDiscardRatio:      sdk.DefaultKeyDiscardRatio,
+		QueuePromoteInterval: sdk.DefaultQueuePromoteInterval,
+		SubscriberBufferSize: sdk.DefaultSubscriberBufferSize,
+		ExpirySweepInterval:  sdk.DefaultExpirySweepInterval,
+		HistoryRetention:     sdk.DefaultHistoryRetention,
+
+		SnapshotFullRetention:        sdk.DefaultSnapshotFullRetention,
+		SnapshotIncrementalRetention: sdk.DefaultSnapshotIncrementalRetention,
+		BackupPath:                   sdk.DefaultBackupPath,
 	}
 
 	// load config
@@ -46,59 +57,2061 @@ func main() {
 		panic(err)
 	}
 
+	// run tool
+	if flag.NArg() > 0 {
+		if err := runTool(&conf, flag.Args()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// setup storage
 	db = badger.New(&conf)
 	db.Start(context.Background())
 	defer db.Stop(context.Background())
 
 	// setup server
-	s := resp.NewServer()
+	s := NewServer(db, &conf)
 
-	s.HandleFunc("Del", func(conn *resp.Conn, args []resp.Value) bool {
-		if len(args) != 2 {
+	// setup replication
+	if conf.ReplicaOf != "" {
+		if err := s.ReplicaOf(conf.ReplicaOf); err != nil {
+			panic(err)
+		}
+	}
+
+	registerHandlers(s, db)
+
+	fmt.Printf("server start at %s\n", conf.ListenAddress)
+	if err := s.ListenAndServe(conf.ListenAddress); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// registerHandlers registers the handlers of the commands served by db.
+func registerHandlers(s *Server, db sdk.Storage) {
+	s.HandleBlockingFunc("BLMove", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) ([][]byte, time.Duration, bool) {
+		if len(args) != 6 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'BLMove' command"))
+			return nil, 0, false
+		}
+
+		var (
+			source      = args[1].Bytes()
+			destination = args[2].Bytes()
+		)
+
+		fromLeft, err := parseListDirection(args[3])
+		if err != nil {
+			conn.WriteError(err)
+			return nil, 0, false
+		}
+		toLeft, err := parseListDirection(args[4])
+		if err != nil {
+			conn.WriteError(err)
+			return nil, 0, false
+		}
+		timeout, err := parseTimeout(args[5])
+		if err != nil {
+			conn.WriteError(err)
+			return nil, 0, false
+		}
+
+		value, err := db.LMove(source, destination, fromLeft, toLeft)
+		if err != nil {
+			if errors.Is(err, sdk.ErrNil) {
+				return [][]byte{source}, timeout, true
+			}
+			conn.WriteError(err)
+			return nil, 0, false
+		}
+		conn.WriteBytes(value)
+		return nil, 0, false
+	})
+	s.HandleBlockingFunc("BLPop", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) ([][]byte, time.Duration, bool) {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'BLPop' command"))
+			return nil, 0, false
+		}
+
+		timeout, err := parseTimeout(args[len(args)-1])
+		if err != nil {
+			conn.WriteError(err)
+			return nil, 0, false
+		}
+
+		var keys = make([][]byte, 0, len(args)-2)
+		for _, arg := range args[1 : len(args)-1] {
+			keys = append(keys, arg.Bytes())
+		}
+
+		for _, key := range keys {
+			values, err := db.LPop(key, 1)
+			if err != nil {
+				conn.WriteError(err)
+				return nil, 0, false
+			}
+			if len(values) > 0 {
+				conn.WriteArray([]resp.Value{
+					resp.BytesValue(key),
+					resp.BytesValue(values[0]),
+				})
+				return nil, 0, false
+			}
+		}
+		return keys, timeout, true
+	})
+	s.HandleBlockingFunc("BRPop", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) ([][]byte, time.Duration, bool) {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'BRPop' command"))
+			return nil, 0, false
+		}
+
+		timeout, err := parseTimeout(args[len(args)-1])
+		if err != nil {
+			conn.WriteError(err)
+			return nil, 0, false
+		}
+
+		var keys = make([][]byte, 0, len(args)-2)
+		for _, arg := range args[1 : len(args)-1] {
+			keys = append(keys, arg.Bytes())
+		}
+
+		for _, key := range keys {
+			values, err := db.RPop(key, 1)
+			if err != nil {
+				conn.WriteError(err)
+				return nil, 0, false
+			}
+			if len(values) > 0 {
+				conn.WriteArray([]resp.Value{
+					resp.BytesValue(key),
+					resp.BytesValue(values[0]),
+				})
+				return nil, 0, false
+			}
+		}
+		return keys, timeout, true
+	})
+	s.HandleFunc("Backup", func(conn ReplyWriter, _ sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 && len(args) != 4 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Backup' command"))
+		} else {
+			var (
+				path        = args[1].String()
+				since int64 = 0
+			)
+
+			if len(args) == 4 {
+				if strings.ToUpper(args[2].String()) != "SINCE" {
+					conn.WriteError(errors.New("ERR syntax error"))
+					return true
+				}
+				var err error
+				since, err = strconv.ParseInt(args[3].String(), 10, 64)
+				if err != nil || since < 0 {
+					conn.WriteError(errors.New("ERR version is not an integer or out of range"))
+					return true
+				}
+			}
+
+			if s.backupPath == "" {
+				conn.WriteError(errors.New("ERR BACKUP is disabled, since BackupPath is not set"))
+				return true
+			}
+			path, err := backupFilePath(s.backupPath, path)
+			if err != nil {
+				conn.WriteError(errors.New("ERR " + err.Error()))
+				return true
+			}
+
+			version, err := backupFile(db, path, uint64(since))
+			if err != nil {
+				conn.WriteError(errors.New("ERR " + err.Error()))
+			} else {
+				conn.WriteInteger(int(version))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("Cluster", func(conn ReplyWriter, _ sdk.Operations, args []resp.Value) bool {
+		if len(args) < 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Cluster' command"))
+			return true
+		}
+		if s.cluster == nil {
+			conn.WriteError(errors.New("ERR This instance has cluster support disabled"))
+			return true
+		}
+
+		var (
+			subcommand = strings.ToUpper(args[1].String())
+			errArity   = errors.New("ERR wrong number of arguments for 'Cluster " + subcommand + "' command")
+		)
+
+		switch subcommand {
+		case "COUNTKEYSINSLOT":
+			if len(args) != 3 {
+				conn.WriteError(errArity)
+				return true
+			}
+			slot, err := parseSlot(args[2])
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+			count, err := db.CountKeysInSlot(slot)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		case "GETKEYSINSLOT":
+			if len(args) != 4 {
+				conn.WriteError(errArity)
+				return true
+			}
+			slot, err := parseSlot(args[2])
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+			count, err := strconv.Atoi(args[3].String())
+			if err != nil || count < 0 {
+				conn.WriteError(errors.New("ERR Invalid number of keys"))
+				return true
+			}
+
+			var reply = []resp.Value{}
+			if count > 0 {
+				keys, _, err := db.SlotKeys(slot, nil, count)
+				if err != nil {
+					conn.WriteError(err)
+					return true
+				}
+				for _, key := range keys {
+					reply = append(reply, resp.BytesValue(key))
+				}
+			}
+			conn.WriteArray(reply)
+		case "INFO":
+			if len(args) != 2 {
+				conn.WriteError(errArity)
+			} else {
+				conn.WriteString(s.cluster.infoReply())
+			}
+		case "KEYSLOT":
+			if len(args) != 3 {
+				conn.WriteError(errArity)
+			} else {
+				conn.WriteInteger(sdk.KeySlot(args[2].Bytes()))
+			}
+		case "MIGRATESLOT":
+			if len(args) != 4 {
+				conn.WriteError(errArity)
+				return true
+			}
+			slot, err := parseSlot(args[2])
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+			err = s.cluster.migrateSlot(db, slot, args[3].String())
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteSimpleString("OK")
+			}
+		case "MYID":
+			if len(args) != 2 {
+				conn.WriteError(errArity)
+			} else {
+				conn.WriteString(s.cluster.id)
+			}
+		case "NODES":
+			if len(args) != 2 {
+				conn.WriteError(errArity)
+			} else {
+				conn.WriteString(s.cluster.nodesReply())
+			}
+		case "SETSLOT":
+			if len(args) != 4 && len(args) != 5 {
+				conn.WriteError(errArity)
+				return true
+			}
+			slot, err := parseSlot(args[2])
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+
+			var (
+				state = strings.ToUpper(args[3].String())
+				id    string
+			)
+			switch state {
+			case SLOT_STATE_IMPORTING, SLOT_STATE_MIGRATING, SLOT_STATE_NODE:
+				if len(args) != 5 {
+					conn.WriteError(errArity)
+					return true
+				}
+				id = args[4].String()
+			case SLOT_STATE_STABLE:
+				if len(args) != 4 {
+					conn.WriteError(errArity)
+					return true
+				}
+			default:
+				conn.WriteError(errors.New("ERR Invalid CLUSTER SETSLOT action or number of arguments"))
+				return true
+			}
+
+			err = s.cluster.setSlot(db, slot, state, id)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteSimpleString("OK")
+			}
+		case "SLOTS":
+			if len(args) != 2 {
+				conn.WriteError(errArity)
+			} else {
+				conn.WriteArray(s.cluster.slotsReply())
+			}
+		default:
+			conn.WriteError(errors.New("ERR unknown subcommand '" + args[1].String() + "'"))
+		}
+		return true
+	})
+	s.HandleFunc("Del", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 2 {
 			conn.WriteError(errors.New("ERR wrong number of arguments for 'Del' command"))
 		} else {
 			var (
-				name = args[1].Bytes()
+				names = make([][]byte, 0, len(args)-1)
+			)
+			for _, arg := range args[1:] {
+				names = append(names, arg.Bytes())
+			}
+			count, err := db.Del(names...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("Dump", func(conn ReplyWriter, _ sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Dump' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+			)
+			payload, err := db.DumpKey(name)
+			if err != nil {
+				if errors.Is(err, sdk.ErrNil) {
+					conn.WriteNull()
+				} else {
+					conn.WriteError(err)
+				}
+			} else {
+				conn.WriteBytes(payload)
+			}
+		}
+		return true
+	})
+	s.HandleFunc("Exists", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Exists' command"))
+		} else {
+			var (
+				names = make([][]byte, 0, len(args)-1)
+			)
+			for _, arg := range args[1:] {
+				names = append(names, arg.Bytes())
+			}
+			count, err := db.Exists(names...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("Expire", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Expire' command"))
+		} else {
+			var (
+				name  = args[1].Bytes()
+				lease = time.Duration(args[2].Integer()) * time.Second
+			)
+			ok, err := db.Expire(name, lease)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				if ok {
+					conn.WriteInteger(1)
+				} else {
+					conn.WriteInteger(0)
+				}
+			}
+		}
+		return true
+	})
+	s.HandleFunc("Get", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Get' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+			)
+			value, err := db.Get(name)
+			if err != nil {
+				if errors.Is(err, sdk.ErrNil) {
+					conn.WriteNull()
+				} else {
+					conn.WriteError(err)
+				}
+			} else {
+				conn.WriteBytes(value)
+			}
+		}
+		return true
+	})
+	s.HandleFunc("HDel", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'HDel' command"))
+		} else {
+			var (
+				name   = args[1].Bytes()
+				fields = make([][]byte, 0, len(args)-2)
+			)
+			for _, arg := range args[2:] {
+				fields = append(fields, arg.Bytes())
+			}
+			count, err := db.HDel(name, fields...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("HExists", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'HExists' command"))
+		} else {
+			var (
+				name  = args[1].Bytes()
+				field = args[2].Bytes()
+			)
+			ok, err := db.HExists(name, field)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				if ok {
+					conn.WriteInteger(1)
+				} else {
+					conn.WriteInteger(0)
+				}
+			}
+		}
+		return true
+	})
+	s.HandleFunc("HGet", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'HGet' command"))
+		} else {
+			var (
+				name  = args[1].Bytes()
+				field = args[2].Bytes()
+			)
+			value, err := db.HGet(name, field)
+			if err != nil {
+				if errors.Is(err, sdk.ErrNil) {
+					conn.WriteNull()
+				} else {
+					conn.WriteError(err)
+				}
+			} else {
+				conn.WriteBytes(value)
+			}
+		}
+		return true
+	})
+	s.HandleFunc("HGetAll", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'HGetAll' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+			)
+			fvs, err := db.HGetAll(name)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				var reply = make([]resp.Value, 0, len(fvs)*2)
+				for _, fv := range fvs {
+					reply = append(reply, resp.BytesValue(fv.Field), resp.BytesValue(fv.Value))
+				}
+				conn.WriteArray(reply)
+			}
+		}
+		return true
+	})
+	s.HandleFunc("HIncrBy", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 4 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'HIncrBy' command"))
+		} else {
+			var (
+				name      = args[1].Bytes()
+				field     = args[2].Bytes()
+				increment = int64(args[3].Integer())
+
+				constraints []sdk.Constraint[int64]
+			)
+
+			for i := 4; i < len(args); i++ {
+				param := strings.ToUpper(args[i].String())
+
+				switch param {
+				case "CONSTRAINT":
+					constraint, next, err := parseIntegerConstraint(args, i)
+					if err != nil {
+						conn.WriteError(err)
+						return true
+					}
+					i = next
+					constraints = append(constraints, constraint)
+				}
+			}
+
+			value, err := db.HIncrBy(name, field, increment, constraints...)
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+			conn.WriteInteger(int(value))
+		}
+		return true
+	})
+	s.HandleFunc("HIncrByFloat", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 4 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'HIncrByFloat' command"))
+		} else {
+			var (
+				name      = args[1].Bytes()
+				field     = args[2].Bytes()
+				increment = args[3].Float()
+
+				constraints []sdk.Constraint[float64]
+			)
+
+			for i := 4; i < len(args); i++ {
+				param := strings.ToUpper(args[i].String())
+
+				switch param {
+				case "CONSTRAINT":
+					constraint, next, err := parseNumberConstraint(args, i)
+					if err != nil {
+						conn.WriteError(err)
+						return true
+					}
+					i = next
+					constraints = append(constraints, constraint)
+				}
+			}
+
+			value, err := db.HIncrByFloat(name, field, increment, constraints...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteString(strconv.FormatFloat(value, 'f', 4, 64))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("HLen", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'HLen' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+			)
+			count, err := db.HLen(name)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("HScan", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'HScan' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+				opts = sdk.ScanOptions{
+					Limit: DefaultScanCount,
+				}
+			)
+
+			cursor, err := decodeCursor(args[2].String())
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+
+			for i := 3; i < len(args); i++ {
+				param := strings.ToUpper(args[i].String())
+
+				switch param {
+				case "MATCH":
+					// is EOF?
+					if i+1 >= len(args) {
+						conn.WriteError(errors.New("ERR wrong number of arguments for 'HScan' command"))
+						return true
+					}
+					i++
+					value := args[i]
+					opts.Match = value.Bytes()
+				case "COUNT":
+					// is EOF?
+					if i+1 >= len(args) {
+						conn.WriteError(errors.New("ERR wrong number of arguments for 'HScan' command"))
+						return true
+					}
+					i++
+					count, err := strconv.Atoi(args[i].String())
+					if err != nil || count < 1 {
+						conn.WriteError(errors.New("ERR syntax error"))
+						return true
+					}
+					opts.Limit = count
+				}
+			}
+			fvs, next, err := db.HScan(name, cursor, opts)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				var reply = make([]resp.Value, 0, len(fvs)*2)
+				for _, fv := range fvs {
+					reply = append(reply, resp.BytesValue(fv.Field), resp.BytesValue(fv.Value))
+				}
+				conn.WriteArray([]resp.Value{
+					resp.StringValue(encodeCursor(next)),
+					resp.ArrayValue(reply),
+				})
+			}
+		}
+		return true
+	})
+	s.HandleFunc("HSet", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 4 || (len(args)-2)%2 != 0 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'HSet' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+				fvs  = make([]sdk.FieldValue, 0, (len(args)-2)/2)
+			)
+			for i := 2; i < len(args); i += 2 {
+				fvs = append(fvs, sdk.FieldValue{
+					Field: args[i].Bytes(),
+					Value: args[i+1].Bytes(),
+				})
+			}
+			count, err := db.HSet(name, fvs...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("IncrBy", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'IncrBy' command"))
+		} else {
+			var (
+				name      = args[1].Bytes()
+				increment = int64(args[2].Integer())
+				lease     time.Duration
+
+				constraints []sdk.Constraint[int64]
+			)
+
+			for i := 2; i < len(args); i++ {
+				param := strings.ToUpper(args[i].String())
+
+				switch param {
+				case "CONSTRAINT":
+					constraint, next, err := parseIntegerConstraint(args, i)
+					if err != nil {
+						conn.WriteError(err)
+						return true
+					}
+					i = next
+					constraints = append(constraints, constraint)
+				case "EX", "PX":
+					// is EOF?
+					if i+1 >= len(args) || lease > 0 {
+						conn.WriteError(errors.New("ERR syntax error"))
+						return true
+					}
+					i++
+					n, err := strconv.ParseInt(args[i].String(), 10, 64)
+					if err != nil {
+						conn.WriteError(errors.New("ERR value is not an integer or out of range"))
+						return true
+					}
+					if n <= 0 {
+						conn.WriteError(errors.New("ERR invalid expire time in 'IncrBy' command"))
+						return true
+					}
+					if param == "EX" {
+						lease = time.Duration(n) * time.Second
+					} else {
+						lease = time.Duration(n) * time.Millisecond
+					}
+				}
+			}
+
+			value, err := db.IncrBy(name, increment, lease, constraints...)
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+			conn.WriteInteger(int(value))
+		}
+		return true
+	})
+	s.HandleFunc("IncrByFloat", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'IncrByFloat' command"))
+		} else {
+			var (
+				name      = args[1].Bytes()
+				increment = args[2].Float()
+				lease     time.Duration
+
+				constraints []sdk.Constraint[float64]
+			)
+
+			for i := 2; i < len(args); i++ {
+				param := strings.ToUpper(args[i].String())
+
+				switch param {
+				case "CONSTRAINT":
+					constraint, next, err := parseNumberConstraint(args, i)
+					if err != nil {
+						conn.WriteError(err)
+						return true
+					}
+					i = next
+					constraints = append(constraints, constraint)
+				case "EX", "PX":
+					// is EOF?
+					if i+1 >= len(args) || lease > 0 {
+						conn.WriteError(errors.New("ERR syntax error"))
+						return true
+					}
+					i++
+					n, err := strconv.ParseInt(args[i].String(), 10, 64)
+					if err != nil {
+						conn.WriteError(errors.New("ERR value is not an integer or out of range"))
+						return true
+					}
+					if n <= 0 {
+						conn.WriteError(errors.New("ERR invalid expire time in 'IncrByFloat' command"))
+						return true
+					}
+					if param == "EX" {
+						lease = time.Duration(n) * time.Second
+					} else {
+						lease = time.Duration(n) * time.Millisecond
+					}
+				}
+			}
+
+			value, err := db.IncrByFloat(name, increment, lease, constraints...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteString(strconv.FormatFloat(value, 'f', 4, 64))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("Keys", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Keys' command"))
+		} else {
+			var (
+				opts = sdk.ScanOptions{
+					Match: args[1].Bytes(),
+				}
+			)
+			keys, _, err := db.Scan(nil, opts)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				var reply = make([]resp.Value, 0, len(keys))
+				for _, key := range keys {
+					reply = append(reply, resp.BytesValue(key))
+				}
+				conn.WriteArray(reply)
+			}
+		}
+		return true
+	})
+	s.HandleFunc("LLen", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'LLen' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+			)
+			count, err := db.LLen(name)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("LMove", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 5 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'LMove' command"))
+		} else {
+			var (
+				source      = args[1].Bytes()
+				destination = args[2].Bytes()
+			)
+
+			fromLeft, err := parseListDirection(args[3])
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+			toLeft, err := parseListDirection(args[4])
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+
+			value, err := db.LMove(source, destination, fromLeft, toLeft)
+			if err != nil {
+				if errors.Is(err, sdk.ErrNil) {
+					conn.WriteNull()
+				} else {
+					conn.WriteError(err)
+				}
+			} else {
+				conn.WriteBytes(value)
+			}
+		}
+		return true
+	})
+	s.HandleFunc("LockAcquire", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 4 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'LockAcquire' command"))
+		} else {
+			var (
+				name  = args[1].Bytes()
+				owner = args[2].Bytes()
+			)
+			milliseconds, err := strconv.ParseInt(args[3].String(), 10, 64)
+			if err != nil || milliseconds <= 0 {
+				conn.WriteError(errors.New("ERR invalid lease in 'LockAcquire' command"))
+				return true
+			}
+			token, ok, err := db.LockAcquire(name, owner, time.Duration(milliseconds)*time.Millisecond)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				if ok {
+					conn.WriteInteger(int(token))
+				} else {
+					conn.WriteNull()
+				}
+			}
+		}
+		return true
+	})
+	s.HandleFunc("LockRelease", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'LockRelease' command"))
+		} else {
+			var (
+				name  = args[1].Bytes()
+				owner = args[2].Bytes()
+			)
+			ok, err := db.LockRelease(name, owner)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				if ok {
+					conn.WriteInteger(1)
+				} else {
+					conn.WriteInteger(0)
+				}
+			}
+		}
+		return true
+	})
+	s.HandleFunc("LockRenew", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 4 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'LockRenew' command"))
+		} else {
+			var (
+				name  = args[1].Bytes()
+				owner = args[2].Bytes()
+			)
+			milliseconds, err := strconv.ParseInt(args[3].String(), 10, 64)
+			if err != nil || milliseconds <= 0 {
+				conn.WriteError(errors.New("ERR invalid lease in 'LockRenew' command"))
+				return true
+			}
+			ok, err := db.LockRenew(name, owner, time.Duration(milliseconds)*time.Millisecond)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				if ok {
+					conn.WriteInteger(1)
+				} else {
+					conn.WriteInteger(0)
+				}
+			}
+		}
+		return true
+	})
+	s.HandleFunc("LPop", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 && len(args) != 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'LPop' command"))
+		} else {
+			var (
+				name  = args[1].Bytes()
+				count = 1
+			)
+			if len(args) == 3 {
+				n, err := strconv.Atoi(args[2].String())
+				if err != nil || n < 0 {
+					conn.WriteError(errors.New("ERR value is out of range, must be positive"))
+					return true
+				}
+				count = n
+			}
+			values, err := db.LPop(name, count)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				switch {
+				case values == nil:
+					conn.WriteNull()
+				case len(args) == 2:
+					conn.WriteBytes(values[0])
+				default:
+					var reply = make([]resp.Value, 0, len(values))
+					for _, value := range values {
+						reply = append(reply, resp.BytesValue(value))
+					}
+					conn.WriteArray(reply)
+				}
+			}
+		}
+		return true
+	})
+	s.HandleFunc("LPush", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'LPush' command"))
+		} else {
+			var (
+				name   = args[1].Bytes()
+				values = make([][]byte, 0, len(args)-2)
+			)
+			for _, arg := range args[2:] {
+				values = append(values, arg.Bytes())
+			}
+			count, err := db.LPush(name, values...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("LRange", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 4 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'LRange' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+			)
+			start, err := strconv.ParseInt(args[2].String(), 10, 64)
+			if err != nil {
+				conn.WriteError(errors.New("ERR value is not an integer or out of range"))
+				return true
+			}
+			stop, err := strconv.ParseInt(args[3].String(), 10, 64)
+			if err != nil {
+				conn.WriteError(errors.New("ERR value is not an integer or out of range"))
+				return true
+			}
+			values, err := db.LRange(name, start, stop)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				var reply = make([]resp.Value, 0, len(values))
+				for _, value := range values {
+					reply = append(reply, resp.BytesValue(value))
+				}
+				conn.WriteArray(reply)
+			}
+		}
+		return true
+	})
+	s.HandleFunc("MGet", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'MGet' command"))
+		} else {
+			var (
+				names = make([][]byte, 0, len(args)-1)
+			)
+			for _, arg := range args[1:] {
+				names = append(names, arg.Bytes())
+			}
+			values, err := db.MGet(names...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				var reply = make([]resp.Value, 0, len(values))
+				for _, value := range values {
+					if value == nil {
+						reply = append(reply, resp.NullValue())
+					} else {
+						reply = append(reply, resp.BytesValue(value))
+					}
+				}
+				conn.WriteArray(reply)
+			}
+		}
+		return true
+	})
+	s.HandleFunc("Migrate", func(conn ReplyWriter, _ sdk.Operations, args []resp.Value) bool {
+		if len(args) < 6 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Migrate' command"))
+		} else {
+			var (
+				address = net.JoinHostPort(args[1].String(), args[2].String())
+				keys    [][]byte
+				keep    = false
+				replace = false
+			)
+			if name := args[3].Bytes(); len(name) > 0 {
+				keys = append(keys, name)
+			}
+			if args[4].String() != "0" {
+				conn.WriteError(errors.New("ERR DB index is out of range"))
+				return true
+			}
+			ms, err := strconv.ParseInt(args[5].String(), 10, 64)
+			if err != nil || ms < 0 {
+				conn.WriteError(errors.New("ERR timeout is not an integer or out of range"))
+				return true
+			}
+			if ms == 0 {
+				ms = 1000
+			}
+
+			for i := 6; i < len(args); i++ {
+				param := strings.ToUpper(args[i].String())
+
+				switch param {
+				case "COPY":
+					keep = true
+				case "REPLACE":
+					replace = true
+				case "KEYS":
+					if len(keys) > 0 {
+						conn.WriteError(errors.New("ERR When using MIGRATE KEYS option, the key argument must be set to the empty string"))
+						return true
+					}
+					for _, arg := range args[i+1:] {
+						keys = append(keys, arg.Bytes())
+					}
+					i = len(args)
+				default:
+					conn.WriteError(errors.New("ERR syntax error"))
+					return true
+				}
+			}
+
+			count, err := migrateKeys(db, address, keys, time.Duration(ms)*time.Millisecond, keep, replace)
+			if err != nil {
+				conn.WriteError(err)
+			} else if count == 0 {
+				conn.WriteSimpleString("NOKEY")
+			} else {
+				conn.WriteSimpleString("OK")
+			}
+		}
+		return true
+	})
+	s.HandleFunc("MSet", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 || (len(args)-1)%2 != 0 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'MSet' command"))
+		} else {
+			var (
+				kvs = make([]sdk.KeyValue, 0, (len(args)-1)/2)
+			)
+			for i := 1; i < len(args); i += 2 {
+				kvs = append(kvs, sdk.KeyValue{
+					Key:   args[i].Bytes(),
+					Value: args[i+1].Bytes(),
+				})
+			}
+			err := db.MSet(kvs...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteSimpleString("OK")
+			}
+		}
+		return true
+	})
+	s.HandleFunc("MSetNX", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 || (len(args)-1)%2 != 0 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'MSetNX' command"))
+		} else {
+			var (
+				kvs = make([]sdk.KeyValue, 0, (len(args)-1)/2)
+			)
+			for i := 1; i < len(args); i += 2 {
+				kvs = append(kvs, sdk.KeyValue{
+					Key:   args[i].Bytes(),
+					Value: args[i+1].Bytes(),
+				})
+			}
+			ok, err := db.MSetNX(kvs...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				if ok {
+					conn.WriteInteger(1)
+				} else {
+					conn.WriteInteger(0)
+				}
+			}
+		}
+		return true
+	})
+	s.HandleFunc("Persist", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Persist' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+			)
+			ok, err := db.Persist(name)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				if ok {
+					conn.WriteInteger(1)
+				} else {
+					conn.WriteInteger(0)
+				}
+			}
+		}
+		return true
+	})
+	s.HandleFunc("Publish", func(conn ReplyWriter, _ sdk.Operations, args []resp.Value) bool {
+		if len(args) != 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Publish' command"))
+		} else {
+			var (
+				channel = args[1].Bytes()
+				message = args[2].Bytes()
+			)
+			count := s.Publish(channel, message)
+			conn.WriteInteger(count)
+		}
+		return true
+	})
+	s.HandleFunc("QAck", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'QAck' command"))
+		} else {
+			var (
+				name     = args[1].Bytes()
+				receipts = make([][]byte, 0, len(args)-2)
+			)
+			for _, arg := range args[2:] {
+				receipts = append(receipts, arg.Bytes())
+			}
+			count, err := db.QAck(name, receipts...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("QLen", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'QLen' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+			)
+			count, err := db.QLen(name)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("QPush", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 4 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'QPush' command"))
+		} else {
+			var (
+				name     = args[1].Bytes()
+				messages = make([][]byte, 0, len(args)-3)
+			)
+			milliseconds, err := strconv.ParseInt(args[2].String(), 10, 64)
+			if err != nil || milliseconds < 0 {
+				conn.WriteError(errors.New("ERR invalid delay in 'QPush' command"))
+				return true
+			}
+			for _, arg := range args[3:] {
+				messages = append(messages, arg.Bytes())
+			}
+			count, err := db.QPush(name, time.Duration(milliseconds)*time.Millisecond, messages...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("QReceive", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'QReceive' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+				opts = sdk.QReceiveOptions{
+					Count: 1,
+				}
+			)
+
+			milliseconds, err := strconv.ParseInt(args[2].String(), 10, 64)
+			if err != nil || milliseconds <= 0 {
+				conn.WriteError(errors.New("ERR invalid visibility timeout in 'QReceive' command"))
+				return true
+			}
+			opts.Visibility = time.Duration(milliseconds) * time.Millisecond
+
+			for i := 3; i < len(args); i++ {
+				param := strings.ToUpper(args[i].String())
+
+				// is EOF?
+				if i+1 >= len(args) {
+					conn.WriteError(errors.New("ERR syntax error"))
+					return true
+				}
+				i++
+
+				switch param {
+				case "COUNT":
+					count, err := strconv.ParseInt(args[i].String(), 10, 64)
+					if err != nil || count <= 0 {
+						conn.WriteError(errors.New("ERR count must be a positive integer"))
+						return true
+					}
+					opts.Count = int(count)
+				case "MAXRECEIVES":
+					maxReceives, err := strconv.ParseInt(args[i].String(), 10, 64)
+					if err != nil || maxReceives <= 0 {
+						conn.WriteError(errors.New("ERR max receives must be a positive integer"))
+						return true
+					}
+					opts.MaxReceives = maxReceives
+				case "DEADLETTER":
+					opts.DeadLetter = args[i].Bytes()
+				default:
+					conn.WriteError(errors.New("ERR syntax error"))
+					return true
+				}
+			}
+
+			messages, err := db.QReceive(name, opts)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				var replies = make([]resp.Value, 0, len(messages))
+				for _, msg := range messages {
+					replies = append(replies, resp.ArrayValue([]resp.Value{
+						resp.IntegerValue(int(msg.ID)),
+						resp.BytesValue(msg.Receipt),
+						resp.IntegerValue(int(msg.Receives)),
+						resp.BytesValue(msg.Body),
+					}))
+				}
+				conn.WriteArray(replies)
+			}
+		}
+		return true
+	})
+	s.HandleFunc("RaftStatus", func(conn ReplyWriter, _ sdk.Operations, args []resp.Value) bool {
+		if len(args) != 1 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'RaftStatus' command"))
+		} else {
+			var (
+				status  = db.RaftStatus()
+				members = make([]resp.Value, 0, len(status.Members))
+			)
+			for _, member := range status.Members {
+				members = append(members, resp.StringValue(member.ID+"="+member.Address))
+			}
+
+			conn.WriteArray([]resp.Value{
+				resp.StringValue("node_id"),
+				resp.StringValue(status.NodeID),
+				resp.StringValue("state"),
+				resp.StringValue(status.State),
+				resp.StringValue("leader_id"),
+				resp.StringValue(status.LeaderID),
+				resp.StringValue("leader_address"),
+				resp.StringValue(status.LeaderAddress),
+				resp.StringValue("applied_index"),
+				resp.IntegerValue(int(status.AppliedIndex)),
+				resp.StringValue("members"),
+				resp.ArrayValue(members),
+			})
+		}
+		return true
+	})
+	s.HandleFunc("RateLimit", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 5 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'RateLimit' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+				opts = sdk.RateLimitOptions{
+					Algorithm: strings.ToLower(args[2].String()),
+					Cost:      1,
+				}
+			)
+
+			limit, err := strconv.ParseInt(args[3].String(), 10, 64)
+			if err != nil || limit <= 0 {
+				conn.WriteError(errors.New("ERR limit must be a positive integer"))
+				return true
+			}
+			opts.Limit = limit
+
+			// NOTE: the period is rejected if it is truncated to zero or
+			// overflows time.Duration.
+			seconds, err := strconv.ParseFloat(args[4].String(), 64)
+			if err != nil || !(seconds > 0 && seconds*float64(time.Second) < math.MaxInt64) {
+				conn.WriteError(errors.New("ERR period must be a positive number of seconds"))
+				return true
+			}
+			opts.Period = time.Duration(seconds * float64(time.Second))
+			if opts.Period <= 0 {
+				conn.WriteError(errors.New("ERR period must be a positive number of seconds"))
+				return true
+			}
+			if opts.Algorithm == sdk.RATE_LIMIT_GCRA && int64(opts.Period) < opts.Limit {
+				conn.WriteError(errors.New("ERR period must be at least one nanosecond per request"))
+				return true
+			}
+
+			for i := 5; i < len(args); i++ {
+				param := strings.ToUpper(args[i].String())
+
+				switch param {
+				case "COST":
+					// is EOF?
+					if i+1 >= len(args) {
+						conn.WriteError(errors.New("ERR syntax error"))
+						return true
+					}
+					i++
+					cost, err := strconv.ParseInt(args[i].String(), 10, 64)
+					if err != nil || cost < 0 {
+						conn.WriteError(errors.New("ERR cost must be a non-negative integer"))
+						return true
+					}
+					opts.Cost = cost
+				default:
+					conn.WriteError(errors.New("ERR syntax error"))
+					return true
+				}
+			}
+
+			result, err := db.RateLimit(name, opts)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				var (
+					allowed    = 0
+					retryAfter = ((result.RetryAfter + time.Millisecond - 1) / time.Millisecond)
+				)
+				if result.Allowed {
+					allowed = 1
+				}
+				if result.RetryAfter < 0 {
+					retryAfter = -1
+				}
+				conn.WriteArray([]resp.Value{
+					resp.IntegerValue(allowed),
+					resp.IntegerValue(int(result.Remaining)),
+					resp.IntegerValue(int(retryAfter)),
+					resp.IntegerValue(int(result.ResetAfter.Milliseconds())),
+				})
+			}
+		}
+		return true
+	})
+	s.HandleFunc("ReplicaOf", func(conn ReplyWriter, _ sdk.Operations, args []resp.Value) bool {
+		if len(args) != 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'ReplicaOf' command"))
+		} else {
+			primary, err := parseReplicaOf(args[1], args[2])
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+
+			err = s.ReplicaOf(primary)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteSimpleString("OK")
+			}
+		}
+		return true
+	})
+	s.HandleFunc("ReplicationStatus", func(conn ReplyWriter, _ sdk.Operations, args []resp.Value) bool {
+		if len(args) != 1 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'ReplicationStatus' command"))
+		} else {
+			var (
+				status      = s.ReplicationStatus()
+				role        = "primary"
+				lastContact int64
+			)
+			if status.Primary != "" {
+				role = "replica"
+			}
+			if !status.LastContact.IsZero() {
+				lastContact = time.Since(status.LastContact).Milliseconds()
+			}
+
+			conn.WriteArray([]resp.Value{
+				resp.StringValue("role"),
+				resp.StringValue(role),
+				resp.StringValue("primary"),
+				resp.StringValue(status.Primary),
+				resp.StringValue("state"),
+				resp.StringValue(status.State),
+				resp.StringValue("version"),
+				resp.IntegerValue(int(status.Version)),
+				resp.StringValue("lag_ms"),
+				resp.IntegerValue(int(status.Lag.Milliseconds())),
+				resp.StringValue("last_contact_ms"),
+				resp.IntegerValue(int(lastContact)),
+				resp.StringValue("replicas"),
+				resp.IntegerValue(int(status.Replicas)),
+			})
+		}
+		return true
+	})
+	s.HandleFunc("Restore", func(conn ReplyWriter, _ sdk.Operations, args []resp.Value) bool {
+		name, payload, ttl, replace, err := parseRestore("Restore", args)
+		if err != nil {
+			conn.WriteError(err)
+			return true
+		}
+
+		err = db.RestoreKey(name, payload, ttl, replace)
+		if err != nil {
+			conn.WriteError(err)
+		} else {
+			conn.WriteSimpleString("OK")
+		}
+		return true
+	})
+	s.HandleFunc("Restore-Asking", func(conn ReplyWriter, _ sdk.Operations, args []resp.Value) bool {
+		name, payload, ttl, replace, err := parseRestore("Restore-Asking", args)
+		if err != nil {
+			conn.WriteError(err)
+			return true
+		}
+
+		err = db.RestoreKey(name, payload, ttl, replace)
+		if err != nil {
+			conn.WriteError(err)
+		} else {
+			conn.WriteSimpleString("OK")
+		}
+		return true
+	})
+	s.HandleFunc("RPop", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 && len(args) != 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'RPop' command"))
+		} else {
+			var (
+				name  = args[1].Bytes()
+				count = 1
+			)
+			if len(args) == 3 {
+				n, err := strconv.Atoi(args[2].String())
+				if err != nil || n < 0 {
+					conn.WriteError(errors.New("ERR value is out of range, must be positive"))
+					return true
+				}
+				count = n
+			}
+			values, err := db.RPop(name, count)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				switch {
+				case values == nil:
+					conn.WriteNull()
+				case len(args) == 2:
+					conn.WriteBytes(values[0])
+				default:
+					var reply = make([]resp.Value, 0, len(values))
+					for _, value := range values {
+						reply = append(reply, resp.BytesValue(value))
+					}
+					conn.WriteArray(reply)
+				}
+			}
+		}
+		return true
+	})
+	s.HandleFunc("RPush", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'RPush' command"))
+		} else {
+			var (
+				name   = args[1].Bytes()
+				values = make([][]byte, 0, len(args)-2)
+			)
+			for _, arg := range args[2:] {
+				values = append(values, arg.Bytes())
+			}
+			count, err := db.RPush(name, values...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("SAdd", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'SAdd' command"))
+		} else {
+			var (
+				name    = args[1].Bytes()
+				members = make([][]byte, 0, len(args)-2)
+			)
+			for _, arg := range args[2:] {
+				members = append(members, arg.Bytes())
+			}
+			count, err := db.SAdd(name, members...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("Scan", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Scan' command"))
+		} else {
+			var (
+				opts = sdk.ScanOptions{
+					Limit: DefaultScanCount,
+				}
+			)
+
+			cursor, err := decodeCursor(args[1].String())
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+
+			for i := 2; i < len(args); i++ {
+				param := strings.ToUpper(args[i].String())
+
+				switch param {
+				case "PREFIX":
+					// is EOF?
+					if i+1 >= len(args) {
+						conn.WriteError(errors.New("ERR wrong number of arguments for 'Scan' command"))
+						return true
+					}
+					i++
+					value := args[i]
+					opts.Prefix = value.Bytes()
+				case "END":
+					// is EOF?
+					if i+1 >= len(args) {
+						conn.WriteError(errors.New("ERR wrong number of arguments for 'Scan' command"))
+						return true
+					}
+					i++
+					value := args[i]
+					opts.EndKey = value.Bytes()
+				case "MATCH":
+					// is EOF?
+					if i+1 >= len(args) {
+						conn.WriteError(errors.New("ERR wrong number of arguments for 'Scan' command"))
+						return true
+					}
+					i++
+					value := args[i]
+					opts.Match = value.Bytes()
+				case "TYPE":
+					// is EOF?
+					if i+1 >= len(args) {
+						conn.WriteError(errors.New("ERR wrong number of arguments for 'Scan' command"))
+						return true
+					}
+					i++
+					value := args[i]
+					opts.Type = strings.ToLower(value.String())
+				case "COUNT":
+					// is EOF?
+					if i+1 >= len(args) {
+						conn.WriteError(errors.New("ERR wrong number of arguments for 'Scan' command"))
+						return true
+					}
+					i++
+					count, err := strconv.Atoi(args[i].String())
+					if err != nil || count < 1 {
+						conn.WriteError(errors.New("ERR syntax error"))
+						return true
+					}
+					opts.Limit = count
+				case "WITH_REVERSE":
+					opts.Reverse = true
+				case "WITH_VALUE":
+					opts.PrefetchValues = true
+				}
+			}
+			keys, next, err := db.Scan(cursor, opts)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				var reply []resp.Value
+				for _, key := range keys {
+					value := resp.BytesValue(key)
+					reply = append(reply, value)
+				}
+				conn.WriteArray([]resp.Value{
+					resp.StringValue(encodeCursor(next)),
+					resp.ArrayValue(reply),
+				})
+			}
+		}
+		return true
+	})
+	s.HandleFunc("SCard", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'SCard' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+			)
+			count, err := db.SCard(name)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("SDiff", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'SDiff' command"))
+		} else {
+			var (
+				keys = make([][]byte, 0, len(args)-1)
+			)
+			for _, arg := range args[1:] {
+				keys = append(keys, arg.Bytes())
+			}
+			members, err := db.SDiff(keys...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				var reply = make([]resp.Value, 0, len(members))
+				for _, member := range members {
+					reply = append(reply, resp.BytesValue(member))
+				}
+				conn.WriteArray(reply)
+			}
+		}
+		return true
+	})
+	s.HandleFunc("Set", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Set' command"))
+		} else {
+			var (
+				name  = args[1].Bytes()
+				value = args[2].Bytes()
+				opts  = sdk.SetOptions{}
+
+				hasExpiry bool
+			)
+
+			for i := 3; i < len(args); i++ {
+				param := strings.ToUpper(args[i].String())
+
+				switch param {
+				case "NX":
+					if opts.IfExists {
+						conn.WriteError(errors.New("ERR syntax error"))
+						return true
+					}
+					opts.IfNotExists = true
+				case "XX":
+					if opts.IfNotExists {
+						conn.WriteError(errors.New("ERR syntax error"))
+						return true
+					}
+					opts.IfExists = true
+				case "GET":
+					opts.ReturnOld = true
+				case "KEEPTTL":
+					if hasExpiry {
+						conn.WriteError(errors.New("ERR syntax error"))
+						return true
+					}
+					opts.KeepTTL = true
+					hasExpiry = true
+				case "EX", "PX", "EXAT", "PXAT":
+					// is EOF?
+					if i+1 >= len(args) || hasExpiry {
+						conn.WriteError(errors.New("ERR syntax error"))
+						return true
+					}
+					i++
+					n, err := strconv.ParseInt(args[i].String(), 10, 64)
+					if err != nil {
+						conn.WriteError(errors.New("ERR value is not an integer or out of range"))
+						return true
+					}
+					if n <= 0 {
+						conn.WriteError(errors.New("ERR invalid expire time in 'Set' command"))
+						return true
+					}
+					switch param {
+					case "EX":
+						opts.Lease = time.Duration(n) * time.Second
+					case "PX":
+						opts.Lease = time.Duration(n) * time.Millisecond
+					case "EXAT":
+						opts.ExpireAt = time.Unix(n, 0)
+					case "PXAT":
+						opts.ExpireAt = time.UnixMilli(n)
+					}
+					hasExpiry = true
+				default:
+					conn.WriteError(errors.New("ERR syntax error"))
+					return true
+				}
+			}
+
+			ok, old, err := db.Set(name, value, opts)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				switch {
+				case opts.ReturnOld:
+					if old == nil {
+						conn.WriteNull()
+					} else {
+						conn.WriteBytes(old)
+					}
+				case ok:
+					conn.WriteSimpleString("OK")
+				default:
+					conn.WriteNull()
+				}
+			}
+		}
+		return true
+	})
+	s.HandleFunc("SInter", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'SInter' command"))
+		} else {
+			var (
+				keys = make([][]byte, 0, len(args)-1)
+			)
+			for _, arg := range args[1:] {
+				keys = append(keys, arg.Bytes())
+			}
+			members, err := db.SInter(keys...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				var reply = make([]resp.Value, 0, len(members))
+				for _, member := range members {
+					reply = append(reply, resp.BytesValue(member))
+				}
+				conn.WriteArray(reply)
+			}
+		}
+		return true
+	})
+	s.HandleFunc("SIsMember", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'SIsMember' command"))
+		} else {
+			var (
+				name   = args[1].Bytes()
+				member = args[2].Bytes()
+			)
+			ok, err := db.SIsMember(name, member)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				if ok {
+					conn.WriteInteger(1)
+				} else {
+					conn.WriteInteger(0)
+				}
+			}
+		}
+		return true
+	})
+	s.HandleFunc("SMembers", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'SMembers' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+			)
+			members, err := db.SMembers(name)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				var reply = make([]resp.Value, 0, len(members))
+				for _, member := range members {
+					reply = append(reply, resp.BytesValue(member))
+				}
+				conn.WriteArray(reply)
+			}
+		}
+		return true
+	})
+	s.HandleFunc("SnapshotStatus", func(conn ReplyWriter, _ sdk.Operations, args []resp.Value) bool {
+		if len(args) != 1 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'SnapshotStatus' command"))
+		} else {
+			var (
+				status                   = db.SnapshotStatus()
+				lastSuccess, lastFailure int64
+			)
+			if !status.LastSuccess.IsZero() {
+				lastSuccess = status.LastSuccess.Unix()
+			}
+			if !status.LastFailure.IsZero() {
+				lastFailure = status.LastFailure.Unix()
+			}
+
+			conn.WriteArray([]resp.Value{
+				resp.StringValue("last_success"),
+				resp.IntegerValue(int(lastSuccess)),
+				resp.StringValue("last_failure"),
+				resp.IntegerValue(int(lastFailure)),
+				resp.StringValue("last_error"),
+				resp.StringValue(status.LastError),
+				resp.StringValue("last_version"),
+				resp.IntegerValue(int(status.LastVersion)),
+				resp.StringValue("successes"),
+				resp.IntegerValue(int(status.Successes)),
+				resp.StringValue("failures"),
+				resp.IntegerValue(int(status.Failures)),
+			})
+		}
+		return true
+	})
+	s.HandleFunc("SRem", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'SRem' command"))
+		} else {
+			var (
+				name    = args[1].Bytes()
+				members = make([][]byte, 0, len(args)-2)
+			)
+			for _, arg := range args[2:] {
+				members = append(members, arg.Bytes())
+			}
+			count, err := db.SRem(name, members...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("SUnion", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'SUnion' command"))
+		} else {
+			var (
+				keys = make([][]byte, 0, len(args)-1)
+			)
+			for _, arg := range args[1:] {
+				keys = append(keys, arg.Bytes())
+			}
+			members, err := db.SUnion(keys...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				var reply = make([]resp.Value, 0, len(members))
+				for _, member := range members {
+					reply = append(reply, resp.BytesValue(member))
+				}
+				conn.WriteArray(reply)
+			}
+		}
+		return true
+	})
+	s.HandleFunc("Transfer", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 4 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Transfer' command"))
+		} else {
+			var (
+				source      = args[1].Bytes()
+				destination = args[2].Bytes()
+				amount      = int64(args[3].Integer())
+
+				sourceConstraints      []sdk.Constraint[int64]
+				destinationConstraints []sdk.Constraint[int64]
+			)
+
+			for i := 4; i < len(args); i++ {
+				param := strings.ToUpper(args[i].String())
+
+				switch param {
+				case "SOURCE_CONSTRAINT":
+					constraint, next, err := parseIntegerConstraint(args, i)
+					if err != nil {
+						conn.WriteError(err)
+						return true
+					}
+					i = next
+					sourceConstraints = append(sourceConstraints, constraint)
+				case "DESTINATION_CONSTRAINT":
+					constraint, next, err := parseIntegerConstraint(args, i)
+					if err != nil {
+						conn.WriteError(err)
+						return true
+					}
+					i = next
+					destinationConstraints = append(destinationConstraints, constraint)
+				default:
+					conn.WriteError(errors.New("ERR syntax error"))
+					return true
+				}
+			}
+
+			sourceValue, destinationValue, err := db.Transfer(source, destination, amount, sourceConstraints, destinationConstraints)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteArray([]resp.Value{
+					resp.IntegerValue(int(sourceValue)),
+					resp.IntegerValue(int(destinationValue)),
+				})
+			}
+		}
+		return true
+	})
+	s.HandleFunc("TSAdd", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 4 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'TSAdd' command"))
+		} else {
+			var (
+				name    = args[1].Bytes()
+				members = make([][]byte, 0, len(args)-3)
 			)
-			err := db.Del(name)
+			seconds, err := strconv.ParseInt(args[2].String(), 10, 64)
+			if err != nil || seconds <= 0 {
+				conn.WriteError(errors.New("ERR invalid expire time in 'TSAdd' command"))
+				return true
+			}
+			for _, arg := range args[3:] {
+				members = append(members, arg.Bytes())
+			}
+			count, err := db.TSAdd(name, time.Duration(seconds)*time.Second, members...)
 			if err != nil {
 				conn.WriteError(err)
 			} else {
-				conn.WriteInteger(1)
+				conn.WriteInteger(int(count))
 			}
 		}
 		return true
 	})
-	s.HandleFunc("Exists", func(conn *resp.Conn, args []resp.Value) bool {
+	s.HandleFunc("TSCard", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
 		if len(args) != 2 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'Exists' command"))
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'TSCard' command"))
 		} else {
 			var (
 				name = args[1].Bytes()
 			)
-			ok, err := db.Exists(name)
+			count, err := db.TSCard(name)
 			if err != nil {
 				conn.WriteError(err)
 			} else {
-				if ok {
-					conn.WriteInteger(1)
-				} else {
-					conn.WriteInteger(0)
-				}
+				conn.WriteInteger(int(count))
 			}
 		}
 		return true
 	})
-	s.HandleFunc("Expire", func(conn *resp.Conn, args []resp.Value) bool {
+	s.HandleFunc("TSIsMember", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
 		if len(args) != 3 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'Expire' command"))
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'TSIsMember' command"))
 		} else {
 			var (
-				name  = args[1].Bytes()
-				lease = time.Duration(args[2].Integer()) * time.Second
+				name   = args[1].Bytes()
+				member = args[2].Bytes()
 			)
-			ok, err := db.Expire(name, lease)
+			ok, err := db.TSIsMember(name, member)
 			if err != nil {
 				conn.WriteError(err)
 			} else {
@@ -111,283 +2124,445 @@ func main() {
 		}
 		return true
 	})
-	s.HandleFunc("Get", func(conn *resp.Conn, args []resp.Value) bool {
+	s.HandleFunc("TSRem", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'TSRem' command"))
+		} else {
+			var (
+				name    = args[1].Bytes()
+				members = make([][]byte, 0, len(args)-2)
+			)
+			for _, arg := range args[2:] {
+				members = append(members, arg.Bytes())
+			}
+			count, err := db.TSRem(name, members...)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("Ttl", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
 		if len(args) != 2 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'Get' command"))
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Ttl' command"))
 		} else {
 			var (
 				name = args[1].Bytes()
 			)
-			value, err := db.Get(name)
+
+			ok, ttl, err := db.Ttl(name)
 			if err != nil {
-				if errors.Is(err, sdk.ErrNil) {
-					conn.WriteNull()
+				conn.WriteError(err)
+			} else {
+				if !ok {
+					conn.WriteInteger(-2)
 				} else {
-					conn.WriteError(err)
+					if ttl < 0 {
+						conn.WriteInteger(-1)
+					} else {
+						conn.WriteInteger(int(ttl))
+					}
 				}
+			}
+
+		}
+		return true
+	})
+	s.HandleFunc("Type", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'Type' command"))
+		} else {
+			var (
+				name = args[1].Bytes()
+			)
+			reply, err := db.Type(name)
+			if err != nil {
+				conn.WriteError(err)
 			} else {
-				conn.WriteBytes(value)
+				conn.WriteSimpleString(reply)
 			}
 		}
 		return true
 	})
-	s.HandleFunc("IncrBy", func(conn *resp.Conn, args []resp.Value) bool {
-		if len(args) < 3 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'IncrBy' command"))
+	s.HandleFunc("ZAdd", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 4 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'ZAdd' command"))
 		} else {
 			var (
-				name      = args[1].Bytes()
-				increment = int64(args[2].Integer())
-
-				constraints []sdk.Constraint[int64]
+				name = args[1].Bytes()
+				opts = sdk.ZAddOptions{}
+				i    = 2
 			)
 
-			for i := 2; i < len(args); i++ {
+		OPTIONS:
+			for ; i < len(args); i++ {
 				param := strings.ToUpper(args[i].String())
 
 				switch param {
-				case "CONSTRAINT":
-					// is EOF?
-					if i+1 >= len(args) {
-						conn.WriteError(errors.New("ERR missing constraint type"))
-						return true
-					}
-					i++
-					constraintType := strings.ToUpper(args[i].String())
-					switch constraintType {
-					case "<=", "LE", "LESS_OR_EQUAL":
-						// is EOF?
-						if i+1 >= len(args) {
-							conn.WriteError(errors.New("ERR missing constraint criteria"))
-							return true
-						}
-						i++
-						var criteria int64 = int64(args[i].Integer())
-						constraints = append(constraints, sdk.IntegerLessOrEqual(criteria))
-					case ">=", "GE", "GREATER_OR_EQUAL":
-						// is EOF?
-						if i+1 >= len(args) {
-							conn.WriteError(errors.New("ERR missing constraint criteria"))
-							return true
-						}
-						i++
-						var criteria int64 = int64(args[i].Integer())
-						constraints = append(constraints, sdk.IntegerGreaterOrEqual(criteria))
-					case "NON_NEGATIVE":
-						constraints = append(constraints, sdk.IntegerNonNegativeValue())
-					case "NON_ZERO":
-						constraints = append(constraints, sdk.IntegerNonZero())
-					default:
-						conn.WriteError(errors.New(fmt.Sprintf("ERR unsupported constraint type '%s'", constraintType)))
-						return true
-					}
+				case "NX":
+					opts.IfNotExists = true
+				case "XX":
+					opts.IfExists = true
+				case "GT":
+					opts.GreaterThan = true
+				case "LT":
+					opts.LessThan = true
+				case "CH":
+					opts.Changed = true
+				default:
+					break OPTIONS
+				}
+			}
+
+			if opts.IfNotExists && opts.IfExists {
+				conn.WriteError(errors.New("ERR XX and NX options at the same time are not compatible"))
+				return true
+			}
+			if (opts.GreaterThan && opts.LessThan) || (opts.IfNotExists && (opts.GreaterThan || opts.LessThan)) {
+				conn.WriteError(errors.New("ERR GT, LT, and/or NX options at the same time are not compatible"))
+				return true
+			}
+			// is EOF?
+			if i >= len(args) || (len(args)-i)%2 != 0 {
+				conn.WriteError(errors.New("ERR syntax error"))
+				return true
+			}
+
+			var members = make([]sdk.ScoredMember, 0, (len(args)-i)/2)
+			for ; i < len(args); i += 2 {
+				score, err := parseScore(args[i])
+				if err != nil {
+					conn.WriteError(err)
+					return true
 				}
+				members = append(members, sdk.ScoredMember{
+					Member: args[i+1].Bytes(),
+					Score:  score,
+				})
 			}
 
-			value, err := db.IncrBy(name, increment, constraints...)
+			count, err := db.ZAdd(name, opts, members...)
 			if err != nil {
 				conn.WriteError(err)
-				return true
+			} else {
+				conn.WriteInteger(int(count))
 			}
-			conn.WriteInteger(int(value))
 		}
 		return true
 	})
-	s.HandleFunc("IncrByFloat", func(conn *resp.Conn, args []resp.Value) bool {
-		if len(args) < 3 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'IncrByFloat' command"))
+	s.HandleFunc("ZCard", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 2 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'ZCard' command"))
 		} else {
 			var (
-				name      = args[1].Bytes()
-				increment = args[2].Float()
+				name = args[1].Bytes()
+			)
+			count, err := db.ZCard(name)
+			if err != nil {
+				conn.WriteError(err)
+			} else {
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("ZIncrBy", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 4 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'ZIncrBy' command"))
+		} else {
+			var (
+				name   = args[1].Bytes()
+				member = args[3].Bytes()
 
 				constraints []sdk.Constraint[float64]
 			)
 
-			for i := 2; i < len(args); i++ {
+			increment, err := parseScore(args[2])
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+
+			for i := 4; i < len(args); i++ {
 				param := strings.ToUpper(args[i].String())
 
 				switch param {
 				case "CONSTRAINT":
-					// is EOF?
-					if i+1 >= len(args) {
-						conn.WriteError(errors.New("ERR missing constraint type"))
+					constraint, next, err := parseNumberConstraint(args, i)
+					if err != nil {
+						conn.WriteError(err)
 						return true
 					}
-					i++
-					constraintType := strings.ToUpper(args[i].String())
-					switch constraintType {
-					case "<", "LT", "LESS":
-						// is EOF?
-						if i+1 >= len(args) {
-							conn.WriteError(errors.New("ERR missing constraint criteria"))
-							return true
-						}
-						i++
-						var criteria = args[i].Float()
-						constraints = append(constraints, sdk.NumberLess(criteria))
-					case "<=", "LE", "LESS_OR_EQUAL":
-						// is EOF?
-						if i+1 >= len(args) {
-							conn.WriteError(errors.New("ERR missing constraint criteria"))
-							return true
-						}
-						i++
-						var criteria = args[i].Float()
-						constraints = append(constraints, sdk.NumberLessOrEqual(criteria))
-					case ">", "GT", "GREATER":
-						// is EOF?
-						if i+1 >= len(args) {
-							conn.WriteError(errors.New("ERR missing constraint criteria"))
-							return true
-						}
-						i++
-						var criteria = args[i].Float()
-						constraints = append(constraints, sdk.NumberGreater(criteria))
-					case ">=", "GE", "GREATER_OR_EQUAL":
-						// is EOF?
-						if i+1 >= len(args) {
-							conn.WriteError(errors.New("ERR missing constraint criteria"))
-							return true
-						}
-						i++
-						var criteria = args[i].Float()
-						constraints = append(constraints, sdk.NumberGreaterOrEqual(criteria))
-					case "NON_NEGATIVE":
-						constraints = append(constraints, sdk.NumberNonNegativeValue())
-					case "NON_ZERO":
-						constraints = append(constraints, sdk.NumberNonZero())
-					default:
-						conn.WriteError(errors.New(fmt.Sprintf("ERR unsupported constraint type '%s'", constraintType)))
-						return true
-					}
-				}
-			}
-
-			value, err := db.IncrByFloat(name, increment, constraints...)
+					i = next
+					constraints = append(constraints, constraint)
+				}
+			}
+
+			score, err := db.ZIncrBy(name, member, increment, constraints...)
 			if err != nil {
 				conn.WriteError(err)
 			} else {
-				conn.WriteString(strconv.FormatFloat(value, 'f', 4, 64))
+				conn.WriteString(formatScore(score))
 			}
 		}
 		return true
 	})
-	s.HandleFunc("Persist", func(conn *resp.Conn, args []resp.Value) bool {
-		if len(args) != 2 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'Persist' command"))
+	s.HandleFunc("ZRange", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 4 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'ZRange' command"))
 		} else {
 			var (
-				name = args[1].Bytes()
+				name       = args[1].Bytes()
+				byScore    = false
+				withScores = false
+				limited    = false
+				opts       = sdk.ZRangeOptions{}
 			)
-			ok, err := db.Persist(name)
+
+			for i := 4; i < len(args); i++ {
+				param := strings.ToUpper(args[i].String())
+
+				switch param {
+				case "BYSCORE":
+					byScore = true
+				case "REV":
+					opts.Reverse = true
+				case "WITHSCORES":
+					withScores = true
+				case "LIMIT":
+					// is EOF?
+					if i+2 >= len(args) {
+						conn.WriteError(errors.New("ERR syntax error"))
+						return true
+					}
+					offset, err := strconv.ParseInt(args[i+1].String(), 10, 64)
+					if err != nil {
+						conn.WriteError(errors.New("ERR value is not an integer or out of range"))
+						return true
+					}
+					count, err := strconv.ParseInt(args[i+2].String(), 10, 64)
+					if err != nil {
+						conn.WriteError(errors.New("ERR value is not an integer or out of range"))
+						return true
+					}
+					i += 2
+					limited = true
+					opts.Offset = offset
+					opts.Count = count
+				default:
+					conn.WriteError(errors.New("ERR syntax error"))
+					return true
+				}
+			}
+
+			if !byScore {
+				if limited {
+					conn.WriteError(errors.New("ERR syntax error, LIMIT is only supported in combination with BYSCORE"))
+					return true
+				}
+				start, err := strconv.ParseInt(args[2].String(), 10, 64)
+				if err != nil {
+					conn.WriteError(errors.New("ERR value is not an integer or out of range"))
+					return true
+				}
+				stop, err := strconv.ParseInt(args[3].String(), 10, 64)
+				if err != nil {
+					conn.WriteError(errors.New("ERR value is not an integer or out of range"))
+					return true
+				}
+				members, err := db.ZRange(name, start, stop, opts.Reverse)
+				if err != nil {
+					conn.WriteError(err)
+				} else {
+					conn.WriteArray(scoredMembersReply(members, withScores))
+				}
+				return true
+			}
+
+			min, err := parseScoreBound(args[2])
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+			max, err := parseScoreBound(args[3])
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+			if opts.Reverse {
+				// NOTE: the range is given as max and min with REV
+				min, max = max, min
+			}
+			if limited && opts.Count == 0 {
+				conn.WriteArray([]resp.Value{})
+				return true
+			}
+			members, err := db.ZRangeByScore(name, min, max, opts)
 			if err != nil {
 				conn.WriteError(err)
 			} else {
-				if ok {
-					conn.WriteInteger(1)
-				} else {
-					conn.WriteInteger(0)
-				}
+				conn.WriteArray(scoredMembersReply(members, withScores))
 			}
 		}
 		return true
 	})
-	s.HandleFunc("Scan", func(conn *resp.Conn, args []resp.Value) bool {
-		if len(args) < 2 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'Scan' command"))
+	s.HandleFunc("ZRangeByScore", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 4 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'ZRangeByScore' command"))
 		} else {
 			var (
-				cursor = args[1].Bytes()
-				opts   = sdk.ScanOptions{}
+				name       = args[1].Bytes()
+				withScores = false
+				limited    = false
+				opts       = sdk.ZRangeOptions{}
 			)
 
-			for i := 2; i < len(args); i++ {
+			min, err := parseScoreBound(args[2])
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+			max, err := parseScoreBound(args[3])
+			if err != nil {
+				conn.WriteError(err)
+				return true
+			}
+
+			for i := 4; i < len(args); i++ {
 				param := strings.ToUpper(args[i].String())
 
 				switch param {
-				case "PREFIX":
+				case "WITHSCORES":
+					withScores = true
+				case "LIMIT":
 					// is EOF?
-					if i+1 >= len(args) {
-						conn.WriteError(errors.New("ERR wrong number of arguments for 'Scan' command"))
+					if i+2 >= len(args) {
+						conn.WriteError(errors.New("ERR syntax error"))
 						return true
 					}
-					i++
-					value := args[i]
-					opts.Prefix = value.Bytes()
-				case "WITH_REVERSE":
-					opts.Reverse = true
-				case "WITH_VALUE":
-					opts.PrefetchValues = true
+					offset, err := strconv.ParseInt(args[i+1].String(), 10, 64)
+					if err != nil {
+						conn.WriteError(errors.New("ERR value is not an integer or out of range"))
+						return true
+					}
+					count, err := strconv.ParseInt(args[i+2].String(), 10, 64)
+					if err != nil {
+						conn.WriteError(errors.New("ERR value is not an integer or out of range"))
+						return true
+					}
+					i += 2
+					limited = true
+					opts.Offset = offset
+					opts.Count = count
+				default:
+					conn.WriteError(errors.New("ERR syntax error"))
+					return true
 				}
 			}
-			keys, err := db.Scan(cursor, opts)
+
+			if limited && opts.Count == 0 {
+				conn.WriteArray([]resp.Value{})
+				return true
+			}
+			members, err := db.ZRangeByScore(name, min, max, opts)
 			if err != nil {
 				conn.WriteError(err)
 			} else {
-				var reply []resp.Value
-				for _, key := range keys {
-					value := resp.BytesValue(key)
-					reply = append(reply, value)
-				}
-				conn.WriteArray(reply)
+				conn.WriteArray(scoredMembersReply(members, withScores))
 			}
 		}
 		return true
 	})
-	s.HandleFunc("Set", func(conn *resp.Conn, args []resp.Value) bool {
+	s.HandleFunc("ZRank", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
 		if len(args) != 3 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'Set' command"))
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'ZRank' command"))
 		} else {
 			var (
-				name  = args[1].Bytes()
-				value = args[2].Bytes()
+				name   = args[1].Bytes()
+				member = args[2].Bytes()
 			)
-			err := db.Set(name, value)
+			rank, err := db.ZRank(name, member, false)
 			if err != nil {
-				conn.WriteError(err)
+				if errors.Is(err, sdk.ErrNil) {
+					conn.WriteNull()
+				} else {
+					conn.WriteError(err)
+				}
 			} else {
-				conn.WriteSimpleString("OK")
+				conn.WriteInteger(int(rank))
 			}
 		}
 		return true
 	})
-	s.HandleFunc("Ttl", func(conn *resp.Conn, args []resp.Value) bool {
-		if len(args) != 2 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'Ttl' command"))
+	s.HandleFunc("ZRem", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) < 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'ZRem' command"))
 		} else {
 			var (
-				name = args[1].Bytes()
+				name    = args[1].Bytes()
+				members = make([][]byte, 0, len(args)-2)
 			)
-
-			ok, ttl, err := db.Ttl(name)
+			for _, arg := range args[2:] {
+				members = append(members, arg.Bytes())
+			}
+			count, err := db.ZRem(name, members...)
 			if err != nil {
 				conn.WriteError(err)
 			} else {
-				if !ok {
-					conn.WriteInteger(-2)
+				conn.WriteInteger(int(count))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("ZRevRank", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'ZRevRank' command"))
+		} else {
+			var (
+				name   = args[1].Bytes()
+				member = args[2].Bytes()
+			)
+			rank, err := db.ZRank(name, member, true)
+			if err != nil {
+				if errors.Is(err, sdk.ErrNil) {
+					conn.WriteNull()
 				} else {
-					if ttl < 0 {
-						conn.WriteInteger(-1)
-					} else {
-						conn.WriteInteger(int(ttl))
-					}
+					conn.WriteError(err)
 				}
+			} else {
+				conn.WriteInteger(int(rank))
+			}
+		}
+		return true
+	})
+	s.HandleFunc("ZScore", func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		if len(args) != 3 {
+			conn.WriteError(errors.New("ERR wrong number of arguments for 'ZScore' command"))
+		} else {
+			var (
+				name   = args[1].Bytes()
+				member = args[2].Bytes()
+			)
+			score, err := db.ZScore(name, member)
+			if err != nil {
+				if errors.Is(err, sdk.ErrNil) {
+					conn.WriteNull()
+				} else {
+					conn.WriteError(err)
+				}
+			} else {
+				conn.WriteString(formatScore(score))
 			}
-
 		}
 		return true
 	})
 
-	s.HandleFunc("Shutdown", func(conn *resp.Conn, args []resp.Value) bool {
+	s.HandleFunc("Shutdown", func(conn ReplyWriter, _ sdk.Operations, args []resp.Value) bool {
 		conn.WriteSimpleString("OK")
 		db.Stop(context.Background())
 		os.Exit(0)
 		return false
 	})
-
-	fmt.Printf("server start at %s\n", conf.ListenAddress)
-	if err := s.ListenAndServe(conf.ListenAddress); err != nil {
-		log.Fatal(err)
-	}
 }
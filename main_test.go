@@ -0,0 +1,66 @@
+package main
+
+import (
+	"badgerlit/sdk"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tidwall/resp"
+)
+
+func TestRateLimit_Arguments(t *testing.T) {
+	_, addr := startTestServer(t, sdk.Config{})
+	client := dialTestServer(t, addr)
+
+	cases := []struct {
+		args     []any
+		expected string
+	}{
+		{[]any{"RATELIMIT", "k", "fixed_window", "1", "0.0000000001"}, "ERR period must be a positive number of seconds"},
+		{[]any{"RATELIMIT", "k", "fixed_window", "1", "1e300"}, "ERR period must be a positive number of seconds"},
+		{[]any{"RATELIMIT", "k", "fixed_window", "1", "NaN"}, "ERR period must be a positive number of seconds"},
+		{[]any{"RATELIMIT", "k", "gcra", "1000000000000", "1"}, "ERR period must be at least one nanosecond per request"},
+		{[]any{"RATELIMIT", "k", "fixed_window", "0", "1"}, "ERR limit must be a positive integer"},
+	}
+	for _, c := range cases {
+		v := client.do(c.args...)
+		if v.Type() != resp.Error || v.Error().Error() != c.expected {
+			t.Errorf("%v: expect %q, but got %v", c.args, c.expected, v)
+		}
+	}
+
+	v := client.do("RATELIMIT", "k", "gcra", "1000000000", "1")
+	if replies := v.Array(); len(replies) != 4 || replies[0].Integer() != 1 {
+		t.Errorf("expect the request to be allowed, but got %v", v)
+	}
+}
+
+func TestBackup_Path(t *testing.T) {
+	dir := t.TempDir()
+	_, addr := startTestServer(t, sdk.Config{BackupPath: dir})
+	client := dialTestServer(t, addr)
+
+	for _, path := range []string{"/tmp/full.bak", "../full.bak", "a/../../full.bak", `..\full.bak`} {
+		v := client.do("BACKUP", path)
+		if v.Type() != resp.Error {
+			t.Errorf("%s: expect an error, but got %v", path, v)
+		}
+	}
+
+	v := client.do("BACKUP", "a/full.bak")
+	if v.Type() != resp.Integer {
+		t.Fatalf("expect the version of the backup, but got %v", v)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a", "full.bak")); err != nil {
+		t.Errorf("expect the backup in BackupPath, but got %v", err)
+	}
+
+	_, addr = startTestServer(t, sdk.Config{})
+	client = dialTestServer(t, addr)
+
+	v = client.do("BACKUP", "full.bak")
+	if v.Type() != resp.Error {
+		t.Errorf("expect BACKUP to be disabled, but got %v", v)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"badgerlit/sdk"
+	"net"
+	"sync"
+
+	"github.com/tidwall/resp"
+)
+
+// subscriber keeps the subscriptions of a session. The published messages
+// are buffered up to the buffer size, and the subscriber is dropped, which
+// closes the connection, once the buffer is full, so that slow consumers
+// never block the publishers.
+type subscriber struct {
+	conn     net.Conn
+	messages chan resp.Value
+	dropped  chan struct{}
+	once     sync.Once
+
+	// NOTE: channels and patterns are modified with the mutex of the
+	// registry held, and are read by the session only.
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+// count returns the number of the subscriptions.
+func (sub *subscriber) count() int {
+	return len(sub.channels) + len(sub.patterns)
+}
+
+// deliver buffers the message without blocking. It drops the subscriber if
+// the buffer is full.
+func (sub *subscriber) deliver(message resp.Value) bool {
+	select {
+	case sub.messages <- message:
+		return true
+	default:
+		sub.drop()
+		return false
+	}
+}
+
+func (sub *subscriber) drop() {
+	sub.once.Do(func() {
+		close(sub.dropped)
+		sub.conn.Close()
+	})
+}
+
+// pubsubRegistry keeps the subscribers by channels and patterns, and delivers
+// the published messages to them.
+type pubsubRegistry struct {
+	mutex    sync.RWMutex
+	channels map[string]map[*subscriber]struct{}
+	patterns map[string]map[*subscriber]struct{}
+
+	bufferSize int
+}
+
+func newPubsubRegistry(bufferSize int) *pubsubRegistry {
+	return &pubsubRegistry{
+		channels:   make(map[string]map[*subscriber]struct{}),
+		patterns:   make(map[string]map[*subscriber]struct{}),
+		bufferSize: bufferSize,
+	}
+}
+
+func (r *pubsubRegistry) newSubscriber(conn net.Conn) *subscriber {
+	return &subscriber{
+		conn:     conn,
+		messages: make(chan resp.Value, r.bufferSize),
+		dropped:  make(chan struct{}),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+}
+
+// subscribe subscribes sub to the channel, or to the pattern if pattern is
+// true. It returns the number of the subscriptions of sub.
+func (r *pubsubRegistry) subscribe(sub *subscriber, name string, pattern bool) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	index, subscriptions := r.channels, sub.channels
+	if pattern {
+		index, subscriptions = r.patterns, sub.patterns
+	}
+
+	subscribers, ok := index[name]
+	if !ok {
+		subscribers = make(map[*subscriber]struct{})
+		index[name] = subscribers
+	}
+	subscribers[sub] = struct{}{}
+	subscriptions[name] = struct{}{}
+	return sub.count()
+}
+
+// unsubscribe unsubscribes sub from the channel, or from the pattern if
+// pattern is true. It returns the number of the subscriptions of sub.
+func (r *pubsubRegistry) unsubscribe(sub *subscriber, name string, pattern bool) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.remove(sub, name, pattern)
+	return sub.count()
+}
+
+// unsubscribeAll unsubscribes sub from all channels and patterns.
+func (r *pubsubRegistry) unsubscribeAll(sub *subscriber) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for name := range sub.channels {
+		r.remove(sub, name, false)
+	}
+	for name := range sub.patterns {
+		r.remove(sub, name, true)
+	}
+}
+
+func (r *pubsubRegistry) remove(sub *subscriber, name string, pattern bool) {
+	index, subscriptions := r.channels, sub.channels
+	if pattern {
+		index, subscriptions = r.patterns, sub.patterns
+	}
+
+	delete(subscriptions, name)
+	if subscribers, ok := index[name]; ok {
+		delete(subscribers, sub)
+		if len(subscribers) == 0 {
+			delete(index, name)
+		}
+	}
+}
+
+// publish delivers the message to the subscribers of the channel and of the
+// matching patterns. It returns the number of the deliveries.
+func (r *pubsubRegistry) publish(channel []byte, message []byte) int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var count int = 0
+
+	if subscribers, ok := r.channels[string(channel)]; ok {
+		reply := resp.ArrayValue([]resp.Value{
+			resp.StringValue("message"),
+			resp.BytesValue(channel),
+			resp.BytesValue(message),
+		})
+		for sub := range subscribers {
+			if sub.deliver(reply) {
+				count++
+			}
+		}
+	}
+
+	for pattern, subscribers := range r.patterns {
+		if !sdk.MatchPattern([]byte(pattern), channel) {
+			continue
+		}
+
+		reply := resp.ArrayValue([]resp.Value{
+			resp.StringValue("pmessage"),
+			resp.StringValue(pattern),
+			resp.BytesValue(channel),
+			resp.BytesValue(message),
+		})
+		for sub := range subscribers {
+			if sub.deliver(reply) {
+				count++
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"badgerlit/sdk"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+// expectArray fails the test unless v is the array of the values.
+func expectArray(t *testing.T, v resp.Value, values ...any) {
+	t.Helper()
+
+	var expected = make([]resp.Value, 0, len(values))
+	for _, value := range values {
+		switch value := value.(type) {
+		case nil:
+			expected = append(expected, resp.NullValue())
+		case int:
+			expected = append(expected, resp.IntegerValue(value))
+		default:
+			expected = append(expected, resp.StringValue(value.(string)))
+		}
+	}
+	if !v.Equals(resp.ArrayValue(expected)) {
+		t.Errorf("expect %v, but got %v", expected, v)
+	}
+}
+
+func TestPubsub(t *testing.T) {
+	_, addr := startTestServer(t, sdk.Config{})
+
+	var (
+		subscriber = dialTestServer(t, addr)
+		publisher  = dialTestServer(t, addr)
+	)
+
+	expectArray(t, subscriber.do("SUBSCRIBE", "news", "alerts"), "subscribe", "news", 1)
+	expectArray(t, subscriber.read(), "subscribe", "alerts", 2)
+	expectArray(t, subscriber.do("PSUBSCRIBE", "n*"), "psubscribe", "n*", 3)
+
+	// only the pubsub commands are allowed in subscribe mode
+	if v := subscriber.do("GET", "a"); v.Type() != resp.Error {
+		t.Errorf("expect GET to be rejected, but got %v", v)
+	}
+	expectArray(t, subscriber.do("PING"), "pong", "")
+
+	// the message is delivered by the channel and by the pattern
+	if v := publisher.do("PUBLISH", "news", "hi"); v.Integer() != 2 {
+		t.Errorf("expect 2 deliveries, but got %v", v)
+	}
+	if v := publisher.do("PUBLISH", "other", "hi"); v.Integer() != 0 {
+		t.Errorf("expect no delivery, but got %v", v)
+	}
+	expectArray(t, subscriber.read(), "message", "news", "hi")
+	expectArray(t, subscriber.read(), "pmessage", "n*", "news", "hi")
+
+	// UNSUBSCRIBE without channels replies each of the channels
+	var channels = make(map[string]bool)
+	for i, v := range []resp.Value{subscriber.do("UNSUBSCRIBE"), subscriber.read()} {
+		replies := v.Array()
+		if len(replies) != 3 || replies[0].String() != "unsubscribe" || replies[2].Integer() != 2-i {
+			t.Errorf("expect the unsubscribe reply with %d subscriptions, but got %v", 2-i, v)
+			continue
+		}
+		channels[replies[1].String()] = true
+	}
+	if !channels["news"] || !channels["alerts"] {
+		t.Errorf("expect news and alerts to be unsubscribed, but got %v", channels)
+	}
+	expectArray(t, subscriber.do("PUNSUBSCRIBE"), "punsubscribe", "n*", 0)
+	expectArray(t, subscriber.do("UNSUBSCRIBE"), "unsubscribe", nil, 0)
+
+	// the session leaves subscribe mode with the last subscription
+	if v := subscriber.do("GET", "a"); !v.IsNull() {
+		t.Errorf("expect GET to be served, but got %v", v)
+	}
+}
+
+func TestPubsub_SlowConsumer(t *testing.T) {
+	_, addr := startTestServer(t, sdk.Config{SubscriberBufferSize: 1})
+
+	var (
+		subscriber = dialTestServer(t, addr)
+		publisher  = dialTestServer(t, addr)
+		message    = bytes.Repeat([]byte{'x'}, 1<<20)
+	)
+
+	expectArray(t, subscriber.do("SUBSCRIBE", "ch"), "subscribe", "ch", 1)
+
+	// the subscriber reads nothing, so the messages are delivered until the
+	// socket buffers and the buffer of the subscriber are full
+	var dropped = false
+	for i := 0; i < 1000 && !dropped; i++ {
+		dropped = publisher.do("PUBLISH", "ch", message).Integer() == 0
+	}
+	if !dropped {
+		t.Fatal("expect the slow subscriber to be dropped")
+	}
+
+	// the connection of the dropped subscriber is closed
+	subscriber.netConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := io.Copy(io.Discard, subscriber.netConn)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		t.Errorf("expect the connection to be closed, but got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"badgerlit/sdk"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+const (
+	REPLICA_STATE_CONNECTING = "connecting"
+	REPLICA_STATE_SYNC       = "sync"
+	REPLICA_STATE_CONNECTED  = "connected"
+
+	// the primary sends heartbeats every second while nothing changes
+	replicaTimeout       = 5 * time.Second
+	replicaRetryInterval = time.Second
+)
+
+// replicationStatus is replied by the ReplicationStatus command.
+type replicationStatus struct {
+	Primary     string // empty unless the server is a replica
+	State       string
+	Version     uint64        // version of the primary which is applied
+	Lag         time.Duration // from the primary sending the last batch to applying it
+	LastContact time.Time
+	Replicas    int64 // number of the replicas which are streamed from the server
+}
+
+// replica keeps the storage up to date with the primary. It connects to the
+// primary over RESP, which streams the batches of the changes since the
+// version applied by the replica, and reconnects once the connection fails.
+type replica struct {
+	db      sdk.Storage
+	primary string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mutex       sync.Mutex
+	state       string
+	version     uint64
+	lag         time.Duration
+	lastContact time.Time
+}
+
+func startReplica(db sdk.Storage, primary string) *replica {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &replica{
+		db:      db,
+		primary: primary,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		state:   REPLICA_STATE_CONNECTING,
+	}
+	go r.run(ctx)
+	return r
+}
+
+// stop stops the replication, and waits until the batch being applied is
+// done.
+func (r *replica) stop() {
+	r.cancel()
+	<-r.done
+}
+
+func (r *replica) status() replicationStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return replicationStatus{
+		Primary:     r.primary,
+		State:       r.state,
+		Version:     r.version,
+		Lag:         r.lag,
+		LastContact: r.lastContact,
+	}
+}
+
+func (r *replica) setState(state string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.state = state
+}
+
+func (r *replica) run(ctx context.Context) {
+	defer close(r.done)
+
+	for {
+		err := r.sync(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("replication from %s: %v", r.primary, err)
+		r.setState(REPLICA_STATE_CONNECTING)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(replicaRetryInterval):
+		}
+	}
+}
+
+// sync applies the batches streamed by the primary until the connection
+// fails or ctx is done.
+func (r *replica) sync(ctx context.Context) error {
+	var dialer net.Dialer
+
+	netConn, err := dialer.DialContext(ctx, "tcp", r.primary)
+	if err != nil {
+		return err
+	}
+	defer netConn.Close()
+
+	// close the connection to stop reading once ctx is done
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			netConn.Close()
+		case <-stopped:
+		}
+	}()
+
+	since, err := r.db.ReplicationVersion(r.primary)
+	if err != nil {
+		return err
+	}
+
+	conn := resp.NewConn(netConn)
+	err = conn.WriteMultiBulk("REPLSYNC", strconv.FormatUint(since, 10))
+	if err != nil {
+		return err
+	}
+	r.setState(REPLICA_STATE_SYNC)
+
+	for {
+		netConn.SetReadDeadline(time.Now().Add(replicaTimeout))
+
+		v, _, err := conn.ReadValue()
+		if err != nil {
+			return err
+		}
+
+		switch v.Type() {
+		case resp.Error:
+			return v.Error()
+		case resp.SimpleString:
+			continue
+		case resp.Array:
+		default:
+			return fmt.Errorf("unexpected reply %q", v.String())
+		}
+
+		message := v.Array()
+		if len(message) != 5 || message[0].String() != "replicate" {
+			return fmt.Errorf("unexpected reply %q", v.String())
+		}
+
+		var (
+			batch   = message[1].Bytes()
+			version = uint64(message[2].Integer())
+			full    = message[3].Integer() == 1
+			sent    = time.UnixMilli(int64(message[4].Integer()))
+		)
+		if len(batch) > 0 || full {
+			err = r.db.ApplyReplication(r.primary, batch, version, full)
+			if err != nil {
+				return err
+			}
+		}
+
+		r.mutex.Lock()
+		r.state = REPLICA_STATE_CONNECTED
+		r.version = version
+		r.lastContact = time.Now()
+		r.lag = r.lastContact.Sub(sent)
+		r.mutex.Unlock()
+	}
+}
+
+// parseReplicaOf returns the address of the primary given by the arguments
+// of the ReplicaOf command, which is empty for NO ONE.
+func parseReplicaOf(host, port resp.Value) (string, error) {
+	if strings.ToUpper(host.String()) == "NO" && strings.ToUpper(port.String()) == "ONE" {
+		return "", nil
+	}
+
+	if _, err := strconv.ParseUint(port.String(), 10, 16); err != nil {
+		return "", errors.New("ERR Invalid master port")
+	}
+	return net.JoinHostPort(host.String(), port.String()), nil
+}
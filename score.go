@@ -0,0 +1,65 @@
+package main
+
+import (
+	"badgerlit/sdk"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/resp"
+)
+
+// parseScore parses the score of sorted set members, which might be
+// "inf", "+inf" or "-inf".
+func parseScore(arg resp.Value) (float64, error) {
+	score, err := strconv.ParseFloat(arg.String(), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, errors.New("ERR value is not a valid float")
+	}
+	return score, nil
+}
+
+// parseScoreBound parses the bound of score ranges. The bound is exclusive
+// if it is prefixed with '('.
+func parseScoreBound(arg resp.Value) (sdk.ScoreBound, error) {
+	var (
+		s     = arg.String()
+		bound = sdk.ScoreBound{}
+	)
+	if strings.HasPrefix(s, "(") {
+		bound.Exclusive = true
+		s = s[1:]
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) {
+		return bound, errors.New("ERR min or max is not a float")
+	}
+	bound.Value = value
+	return bound, nil
+}
+
+// formatScore formats the score in the shortest representation.
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// scoredMembersReply returns the reply of the sorted set members, which
+// contains the scores as well if withScores is set.
+func scoredMembersReply(members []sdk.ScoredMember, withScores bool) []resp.Value {
+	var reply = make([]resp.Value, 0, len(members))
+	for _, member := range members {
+		reply = append(reply, resp.BytesValue(member.Member))
+		if withScores {
+			reply = append(reply, resp.StringValue(formatScore(member.Score)))
+		}
+	}
+	return reply
+}
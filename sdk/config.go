@@ -3,16 +3,64 @@ package sdk
 import (
 	"fmt"
 	"log"
+	"net"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	ListenAddress      string        `yaml:"ListenAddress"`
-	Engine             string        `yaml:"Engine"`
-	DataPath           string        `yaml:"DataPath"`
-	KeyDiscardInterval time.Duration `yaml:"KeyDiscardInterval"`
-	KeyDiscardRatio    float64       `yaml:"KeyDiscardRatio"`
-	LogFlagsToken      []string      `yaml:"LogFlags"`
+	ListenAddress        string        `yaml:"ListenAddress"`
+	Engine               string        `yaml:"Engine"`
+	DataPath             string        `yaml:"DataPath"`
+	KeyDiscardInterval   time.Duration `yaml:"KeyDiscardInterval"`
+	KeyDiscardRatio      float64       `yaml:"KeyDiscardRatio"`
+	QueuePromoteInterval time.Duration `yaml:"QueuePromoteInterval"`
+	SubscriberBufferSize int           `yaml:"SubscriberBufferSize"`
+	NotifyKeyspaceEvents string        `yaml:"NotifyKeyspaceEvents"`
+	ExpirySweepInterval  time.Duration `yaml:"ExpirySweepInterval"`
+	LogFlagsToken        []string      `yaml:"LogFlags"`
+
+	// The overwritten and deleted versions of the keys are retained for at
+	// least HistoryRetention, so that CDC and the replicas are able to
+	// resume from a version within it without missing any change.
+	HistoryRetention time.Duration `yaml:"HistoryRetention"`
+
+	// The snapshots are taken every SnapshotInterval into SnapshotPath if
+	// the interval is positive. A full snapshot is followed by up to
+	// SnapshotIncrementalRetention incremental snapshots, and the latest
+	// SnapshotFullRetention full snapshots are kept with their incremental
+	// snapshots.
+	SnapshotInterval             time.Duration `yaml:"SnapshotInterval"`
+	SnapshotPath                 string        `yaml:"SnapshotPath"`
+	SnapshotFullRetention        int           `yaml:"SnapshotFullRetention"`
+	SnapshotIncrementalRetention int           `yaml:"SnapshotIncrementalRetention"`
+
+	// BACKUP writes the backups into BackupPath, and is disabled if the
+	// path is empty. The files are given by the paths relative to it.
+	BackupPath string `yaml:"BackupPath"`
+
+	// ReplicaOf is the address of the primary, host:port, if the server is
+	// a read-only replica.
+	ReplicaOf string `yaml:"ReplicaOf"`
+
+	// The server is the member RaftNodeID of the raft cluster if the id is
+	// set. RaftPeers lists all members as id=host:port, the addresses of
+	// their raft transports, which bootstrap the cluster once none of them
+	// has the raft state. The raft state is kept in RaftDataPath unless the
+	// engine is memory.
+	RaftNodeID   string   `yaml:"RaftNodeID"`
+	RaftPeers    []string `yaml:"RaftPeers"`
+	RaftDataPath string   `yaml:"RaftDataPath"`
+
+	// The server is the node ClusterNodeID of the sharded cluster if the id
+	// is set. ClusterNodes lists all nodes as "id host:port slots...", where
+	// the slots are single slots or ranges start-end. The owners of the
+	// slots changed by CLUSTER SETSLOT NODE are kept in ClusterStateFile,
+	// which overrides the slots of ClusterNodes once it exists.
+	ClusterNodeID    string   `yaml:"ClusterNodeID"`
+	ClusterNodes     []string `yaml:"ClusterNodes"`
+	ClusterStateFile string   `yaml:"ClusterStateFile"`
 }
 
 func (conf *Config) LogFlags() (int, error) {
@@ -57,6 +105,73 @@ func (conf *Config) LogFlags() (int, error) {
 	return value, err
 }
 
+// RaftMembers returns the members of the raft cluster parsed from RaftPeers.
+func (conf *Config) RaftMembers() ([]RaftMember, error) {
+	var members = make([]RaftMember, 0, len(conf.RaftPeers))
+	for _, peer := range conf.RaftPeers {
+		id, address, ok := strings.Cut(peer, "=")
+		if !ok || id == "" || address == "" {
+			return nil, fmt.Errorf("invalid RaftPeers '%s'", peer)
+		}
+		members = append(members, RaftMember{
+			ID:      id,
+			Address: address,
+		})
+	}
+	return members, nil
+}
+
+// ClusterTopology returns the nodes of the sharded cluster parsed from
+// ClusterNodes.
+func (conf *Config) ClusterTopology() ([]ClusterNode, error) {
+	var nodes = make([]ClusterNode, 0, len(conf.ClusterNodes))
+	for _, line := range conf.ClusterNodes {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid ClusterNodes '%s'", line)
+		}
+		if _, _, err := net.SplitHostPort(fields[1]); err != nil {
+			return nil, fmt.Errorf("invalid address of ClusterNodes '%s'", line)
+		}
+
+		node := ClusterNode{
+			ID:      fields[0],
+			Address: fields[1],
+		}
+		for _, field := range fields[2:] {
+			start, end, ok := strings.Cut(field, "-")
+			if !ok {
+				end = start
+			}
+
+			var (
+				r   SlotRange
+				err error
+			)
+			r.Start, err = strconv.Atoi(start)
+			if err != nil {
+				return nil, fmt.Errorf("invalid slots '%s' of ClusterNodes '%s'", field, line)
+			}
+			r.End, err = strconv.Atoi(end)
+			if err != nil {
+				return nil, fmt.Errorf("invalid slots '%s' of ClusterNodes '%s'", field, line)
+			}
+			if r.Start < 0 || r.End >= CLUSTER_SLOTS || r.Start > r.End {
+				return nil, fmt.Errorf("invalid slots '%s' of ClusterNodes '%s'", field, line)
+			}
+			node.Slots = append(node.Slots, r)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// KeyspaceEvents returns the flags of keyspace notifications, which is zero
+// if the notifications are disabled.
+func (conf *Config) KeyspaceEvents() (int, error) {
+	return ParseKeyspaceEvents(conf.NotifyKeyspaceEvents)
+}
+
 func (conf *Config) Validate() error {
 	switch conf.Engine {
 	case ENGINE_MEMORY:
@@ -69,5 +184,88 @@ func (conf *Config) Validate() error {
 		return fmt.Errorf("config error: unsupported Engine '%s'", conf.Engine)
 	}
 
+	if _, err := conf.KeyspaceEvents(); err != nil {
+		return fmt.Errorf("config error: %v", err)
+	}
+
+	if conf.SubscriberBufferSize <= 0 {
+		return fmt.Errorf("config error: SubscriberBufferSize must be positive")
+	}
+
+	if conf.SnapshotInterval > 0 {
+		if conf.SnapshotPath == "" {
+			return fmt.Errorf("config error: missing SnapshotPath")
+		}
+		if conf.SnapshotFullRetention <= 0 {
+			return fmt.Errorf("config error: SnapshotFullRetention must be positive")
+		}
+		if conf.SnapshotIncrementalRetention < 0 {
+			return fmt.Errorf("config error: SnapshotIncrementalRetention must not be negative")
+		}
+	}
+
+	if conf.RaftNodeID != "" {
+		members, err := conf.RaftMembers()
+		if err != nil {
+			return fmt.Errorf("config error: %v", err)
+		}
+
+		var found = false
+		for _, member := range members {
+			if member.ID == conf.RaftNodeID {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("config error: RaftNodeID '%s' is not in RaftPeers", conf.RaftNodeID)
+		}
+		if conf.Engine == ENGINE_FILE && conf.RaftDataPath == "" {
+			return fmt.Errorf("config error: missing RaftDataPath")
+		}
+		if conf.ReplicaOf != "" {
+			return fmt.Errorf("config error: ReplicaOf cannot mix with RaftNodeID")
+		}
+	}
+
+	if conf.ClusterNodeID != "" {
+		nodes, err := conf.ClusterTopology()
+		if err != nil {
+			return fmt.Errorf("config error: %v", err)
+		}
+
+		var (
+			found  = false
+			ids    = make(map[string]bool)
+			owners = make([]string, CLUSTER_SLOTS)
+		)
+		for _, node := range nodes {
+			if ids[node.ID] {
+				return fmt.Errorf("config error: duplicate node '%s' in ClusterNodes", node.ID)
+			}
+			ids[node.ID] = true
+			if node.ID == conf.ClusterNodeID {
+				found = true
+			}
+
+			for _, r := range node.Slots {
+				for slot := r.Start; slot <= r.End; slot++ {
+					if owners[slot] != "" {
+						return fmt.Errorf("config error: slot %d is owned by both '%s' and '%s'", slot, owners[slot], node.ID)
+					}
+					owners[slot] = node.ID
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("config error: ClusterNodeID '%s' is not in ClusterNodes", conf.ClusterNodeID)
+		}
+		if conf.RaftNodeID != "" {
+			return fmt.Errorf("config error: RaftNodeID cannot mix with ClusterNodeID")
+		}
+		if conf.ReplicaOf != "" {
+			return fmt.Errorf("config error: ReplicaOf cannot mix with ClusterNodeID")
+		}
+	}
+
 	return nil
 }
@@ -3,8 +3,42 @@ package sdk
 var (
 	_ Constraint[int64]   = IntegerConstraintFunc(nil)
 	_ Constraint[float64] = NumberConstraintFunc(nil)
+	_ Constraint[int64]   = BoundaryConstraint[int64]{}
+	_ Constraint[float64] = BoundaryConstraint[float64]{}
 )
 
+const (
+	OPERATOR_LESS             = "<"
+	OPERATOR_LESS_OR_EQUAL    = "<="
+	OPERATOR_GREATER          = ">"
+	OPERATOR_GREATER_OR_EQUAL = ">="
+	OPERATOR_NOT_EQUAL        = "!="
+)
+
+// -----------------------------------------
+// BoundaryConstraint compares the value with the boundary. Unlike the
+// constraint funcs, it can be encoded, e.g. to be proposed through raft.
+type BoundaryConstraint[T int64 | float64] struct {
+	Operator string `json:"operator"`
+	Boundary T      `json:"boundary"`
+}
+
+func (c BoundaryConstraint[T]) Check(v T) bool {
+	switch c.Operator {
+	case OPERATOR_LESS:
+		return v < c.Boundary
+	case OPERATOR_LESS_OR_EQUAL:
+		return v <= c.Boundary
+	case OPERATOR_GREATER:
+		return v > c.Boundary
+	case OPERATOR_GREATER_OR_EQUAL:
+		return v >= c.Boundary
+	case OPERATOR_NOT_EQUAL:
+		return v != c.Boundary
+	}
+	return false
+}
+
 // -----------------------------------------
 type IntegerConstraintFunc func(v int64) bool
 
@@ -12,27 +46,31 @@ func (fn IntegerConstraintFunc) Check(v int64) bool {
 	return fn(v)
 }
 
-func IntegerLessOrEqual(boundary int64) IntegerConstraintFunc {
-	return func(v int64) bool {
-		return v <= boundary
+func IntegerLessOrEqual(boundary int64) BoundaryConstraint[int64] {
+	return BoundaryConstraint[int64]{
+		Operator: OPERATOR_LESS_OR_EQUAL,
+		Boundary: boundary,
 	}
 }
 
-func IntegerGreaterOrEqual(boundary int64) IntegerConstraintFunc {
-	return func(v int64) bool {
-		return v >= boundary
+func IntegerGreaterOrEqual(boundary int64) BoundaryConstraint[int64] {
+	return BoundaryConstraint[int64]{
+		Operator: OPERATOR_GREATER_OR_EQUAL,
+		Boundary: boundary,
 	}
 }
 
-func IntegerNonNegativeValue() IntegerConstraintFunc {
-	return func(v int64) bool {
-		return v >= 0
+func IntegerNonNegativeValue() BoundaryConstraint[int64] {
+	return BoundaryConstraint[int64]{
+		Operator: OPERATOR_GREATER_OR_EQUAL,
+		Boundary: 0,
 	}
 }
 
-func IntegerNonZero() IntegerConstraintFunc {
-	return func(v int64) bool {
-		return v != 0
+func IntegerNonZero() BoundaryConstraint[int64] {
+	return BoundaryConstraint[int64]{
+		Operator: OPERATOR_NOT_EQUAL,
+		Boundary: 0,
 	}
 }
 
@@ -43,38 +81,44 @@ func (fn NumberConstraintFunc) Check(v float64) bool {
 	return fn(v)
 }
 
-func NumberLess(boundary float64) NumberConstraintFunc {
-	return func(v float64) bool {
-		return v < boundary
+func NumberLess(boundary float64) BoundaryConstraint[float64] {
+	return BoundaryConstraint[float64]{
+		Operator: OPERATOR_LESS,
+		Boundary: boundary,
 	}
 }
 
-func NumberLessOrEqual(boundary float64) NumberConstraintFunc {
-	return func(v float64) bool {
-		return v <= boundary
+func NumberLessOrEqual(boundary float64) BoundaryConstraint[float64] {
+	return BoundaryConstraint[float64]{
+		Operator: OPERATOR_LESS_OR_EQUAL,
+		Boundary: boundary,
 	}
 }
 
-func NumberGreater(boundary float64) NumberConstraintFunc {
-	return func(v float64) bool {
-		return v > boundary
+func NumberGreater(boundary float64) BoundaryConstraint[float64] {
+	return BoundaryConstraint[float64]{
+		Operator: OPERATOR_GREATER,
+		Boundary: boundary,
 	}
 }
 
-func NumberGreaterOrEqual(boundary float64) NumberConstraintFunc {
-	return func(v float64) bool {
-		return v >= boundary
+func NumberGreaterOrEqual(boundary float64) BoundaryConstraint[float64] {
+	return BoundaryConstraint[float64]{
+		Operator: OPERATOR_GREATER_OR_EQUAL,
+		Boundary: boundary,
 	}
 }
 
-func NumberNonNegativeValue() NumberConstraintFunc {
-	return func(v float64) bool {
-		return v >= 0
+func NumberNonNegativeValue() BoundaryConstraint[float64] {
+	return BoundaryConstraint[float64]{
+		Operator: OPERATOR_GREATER_OR_EQUAL,
+		Boundary: 0,
 	}
 }
 
-func NumberNonZero() NumberConstraintFunc {
-	return func(v float64) bool {
-		return v != 0
+func NumberNonZero() BoundaryConstraint[float64] {
+	return BoundaryConstraint[float64]{
+		Operator: OPERATOR_NOT_EQUAL,
+		Boundary: 0,
 	}
 }
@@ -2,6 +2,7 @@ package sdk
 
 import (
 	"context"
+	"io"
 	"log"
 	"time"
 )
@@ -11,19 +12,45 @@ const (
 	ErrDatabaseUnavailable = Error("database is unavailable")
 	ErrNil                 = Error("nil")
 	ErrViolateConstraints  = Error("violate constraints")
+	ErrTxnAborted          = Error("transaction aborted")
 
 	UNSET_LEASE = -1
 	NONE_TTL    = 0
 
+	TYPE_NONE    = "none"
+	TYPE_STRING  = "string"
+	TYPE_HASH    = "hash"
+	TYPE_LIST    = "list"
+	TYPE_SET     = "set"
+	TYPE_ZSET    = "zset"
+	TYPE_TTLSET  = "ttlset"
+	TYPE_LIMITER = "ratelimit"
+	TYPE_LOCK    = "lock"
+	TYPE_QUEUE   = "queue"
+
+	RATE_LIMIT_FIXED_WINDOW = "fixed_window"
+	RATE_LIMIT_SLIDING_LOG  = "sliding_log"
+	RATE_LIMIT_GCRA         = "gcra"
+
 	ENGINE_FILE   = "file"
 	ENGINE_MEMORY = "memory"
 
-	DefaultListenAddress      = ":8962"
-	DefaultEngine             = "file"
-	DefaultDataPath           = "./.data/dump"
-	DefaultKeyDiscardInterval = 90 * time.Second
-	DefaultKeyDiscardRatio    = 0.7
-	DefaultLogFlags           = log.Lmsgprefix | log.LstdFlags
+	CLUSTER_SLOTS = 16384
+
+	DefaultListenAddress        = ":8962"
+	DefaultEngine               = "file"
+	DefaultDataPath             = "./.data/dump"
+	DefaultKeyDiscardInterval   = 90 * time.Second
+	DefaultKeyDiscardRatio      = 0.7
+	DefaultQueuePromoteInterval = time.Second
+	DefaultSubscriberBufferSize = 1024
+	DefaultExpirySweepInterval  = time.Second
+	DefaultHistoryRetention     = 10 * time.Minute
+	DefaultLogFlags             = log.Lmsgprefix | log.LstdFlags
+
+	DefaultSnapshotFullRetention        = 2
+	DefaultSnapshotIncrementalRetention = 6
+	DefaultBackupPath                   = "./.data/backups"
 
 	LOG_FLAG_TOKEN_DATE      = "date"
 	LOG_FLAG_TOKEN_TIME      = "time"
@@ -38,15 +65,203 @@ type (
 		Start(ctx context.Context)
 		Stop(ctx context.Context)
 
+		Operations
+
+		// Listen registers the listener which is notified of the events of
+		// keys after the transaction which raised them is committed.
+		Listen(listener EventListener)
+
+		// Capture calls fn with the committed changes of the top-level keys
+		// in order of versions, until ctx is done or fn returns an error.
+		// The changes after opts.Since, or after opts.SinceTime, are
+		// replayed first if either is set. It returns ErrHistoryTooOld if
+		// they are older than the retained versions, see HistoryRetention of
+		// Config.
+		Capture(ctx context.Context, opts CaptureOptions, fn func(change Change) error) error
+
+		// Backup writes the versions of all keys since the version to w, and
+		// returns the version to pass as since for the next incremental
+		// backup. The full backup is written if since is zero.
+		Backup(w io.Writer, since uint64) (uint64, error)
+		// Restore loads the full backup followed by its incremental backups
+		// in order. It returns ErrDatabaseNotEmpty if the storage holds any
+		// keys unless force is true, which drops them first. It can only be
+		// called before the storage is started.
+		Restore(force bool, backups ...io.Reader) error
+		// SnapshotStatus returns the results of the scheduled snapshots.
+		SnapshotStatus() SnapshotStatus
+
+		// DumpKey returns the serialized value of the key without its time
+		// to live, which is restored by RestoreKey. It returns ErrNil if the
+		// key does not exist.
+		DumpKey(key []byte) ([]byte, error)
+		// RestoreKey creates the key from the serialized value, which
+		// expires after ttl unless ttl is zero. It returns ErrBusyKey if
+		// the key exists unless replace is true.
+		RestoreKey(key []byte, payload []byte, ttl time.Duration, replace bool) error
+
+		// ReadOnly reports whether the storage is a replica, which rejects
+		// the writes with ErrReadOnly.
+		ReadOnly() bool
+		SetReadOnly(readOnly bool) error
+		// Replicate calls fn with the batches of the changes since the
+		// version, or of all keys if full is true, and the version to pass
+		// as since to resume. The changes are split into the batches of
+		// bounded size, and only the first batch of a full sync is full. It
+		// falls back to a full sync if the changes since the version are no
+		// longer retained. It calls fn with an empty batch periodically
+		// while nothing changes, until ctx is done or fn returns an error.
+		Replicate(ctx context.Context, since uint64, fn func(batch []byte, version uint64, full bool) error) error
+		// ApplyReplication applies the batch of the primary to the replica,
+		// and records the version which is returned by ReplicationVersion.
+		ApplyReplication(primary string, batch []byte, version uint64, full bool) error
+		ReplicationVersion(primary string) (uint64, error)
+
+		// RaftStatus returns the state of the raft member, which is zero
+		// unless the storage is a member of the raft cluster.
+		RaftStatus() RaftStatus
+
+		// Watch returns the current versions of keys. The versions
+		// are checked by Multi before running its operations.
+		Watch(keys ...[]byte) ([]WatchedKey, error)
+		// Multi runs fn within a single transaction. It returns
+		// ErrTxnAborted if any of the watched keys had been modified, and
+		// ErrReadOnly if the storage is a replica and fn writes. fn is
+		// retried on conflict unless keys are watched, so it acts on ops
+		// only.
+		Multi(watches []WatchedKey, fn func(ops Operations) error) error
+	}
+
+	Operations interface {
 		Get(key []byte) ([]byte, error)
-		Set(key []byte, value []byte) error
-		IncrBy(key []byte, increment int64, constraints ...Constraint[int64]) (int64, error)
-		IncrByFloat(key []byte, increment float64, constraints ...Constraint[float64]) (float64, error)
+		Set(key []byte, value []byte, opts SetOptions) (ok bool, old []byte, err error)
+		MGet(keys ...[]byte) ([][]byte, error)
+		MSet(kvs ...KeyValue) error
+		MSetNX(kvs ...KeyValue) (bool, error)
+		// IncrBy increments the number at key. The key expires after lease if
+		// it is created by the increment, otherwise its expiry is retained.
+		// No expiry is applied if lease is not positive.
+		IncrBy(key []byte, increment int64, lease time.Duration, constraints ...Constraint[int64]) (int64, error)
+		IncrByFloat(key []byte, increment float64, lease time.Duration, constraints ...Constraint[float64]) (float64, error)
+		// Transfer moves amount from source to destination atomically. The constraints
+		// are checked against the new values of source and destination respectively.
+		Transfer(source, destination []byte, amount int64, sourceConstraints, destinationConstraints []Constraint[int64]) (int64, int64, error)
 
-		Scan(cursor []byte, opts ScanOptions) ([][]byte, error)
+		// Scan returns a page of keys starting from cursor, and the cursor of
+		// the next page. The next cursor is nil if there are no more keys.
+		// The page might be empty before the end, since the keys filtered
+		// out by Match or Type count against Limit.
+		Scan(cursor []byte, opts ScanOptions) (kvs [][]byte, next []byte, err error)
+		// CountKeysInSlot returns the number of the keys of the hash slot,
+		// see KeySlot.
+		CountKeysInSlot(slot int) (int64, error)
+		// SlotKeys returns up to count keys of the hash slot starting from
+		// cursor, or all of them if count is not positive, and the cursor
+		// of the next page. The next cursor is nil if there are no more keys.
+		SlotKeys(slot int, cursor []byte, count int) (keys [][]byte, next []byte, err error)
 		Ttl(key []byte) (ok bool, ttl int64, err error)
-		Exists(key []byte) (bool, error)
-		Del(key []byte) error
+		Type(key []byte) (string, error)
+
+		HSet(key []byte, fvs ...FieldValue) (int64, error)
+		HGet(key []byte, field []byte) ([]byte, error)
+		HDel(key []byte, fields ...[]byte) (int64, error)
+		HExists(key []byte, field []byte) (bool, error)
+		HLen(key []byte) (int64, error)
+		HGetAll(key []byte) ([]FieldValue, error)
+		HIncrBy(key []byte, field []byte, increment int64, constraints ...Constraint[int64]) (int64, error)
+		HIncrByFloat(key []byte, field []byte, increment float64, constraints ...Constraint[float64]) (float64, error)
+		HScan(key []byte, cursor []byte, opts ScanOptions) (fvs []FieldValue, next []byte, err error)
+
+		LPush(key []byte, values ...[]byte) (int64, error)
+		RPush(key []byte, values ...[]byte) (int64, error)
+		// LPop removes and returns up to count elements from the head of the
+		// list. It returns nil if the key does not exist.
+		LPop(key []byte, count int) ([][]byte, error)
+		// RPop removes and returns up to count elements from the tail of the
+		// list. It returns nil if the key does not exist.
+		RPop(key []byte, count int) ([][]byte, error)
+		// LMove pops an element from the source list and pushes it to the
+		// destination list. It returns ErrNil if the source list is empty.
+		LMove(source, destination []byte, fromLeft, toLeft bool) ([]byte, error)
+		LRange(key []byte, start, stop int64) ([][]byte, error)
+		LLen(key []byte) (int64, error)
+
+		SAdd(key []byte, members ...[]byte) (int64, error)
+		SRem(key []byte, members ...[]byte) (int64, error)
+		SIsMember(key []byte, member []byte) (bool, error)
+		SCard(key []byte) (int64, error)
+		// SMembers returns the members of the set in byte order, and so do
+		// SInter, SUnion and SDiff. The missing keys are empty sets.
+		SMembers(key []byte) ([][]byte, error)
+		SInter(keys ...[]byte) ([][]byte, error)
+		SUnion(keys ...[]byte) ([][]byte, error)
+		SDiff(keys ...[]byte) ([][]byte, error)
+
+		// ZAdd adds or updates the members of the sorted set. It returns the
+		// number of members added, or changed if opts.Changed is set.
+		ZAdd(key []byte, opts ZAddOptions, members ...ScoredMember) (int64, error)
+		ZIncrBy(key []byte, member []byte, increment float64, constraints ...Constraint[float64]) (float64, error)
+		ZRem(key []byte, members ...[]byte) (int64, error)
+		ZScore(key []byte, member []byte) (float64, error)
+		ZCard(key []byte) (int64, error)
+		// ZRange returns the members ranked from start to stop, which are
+		// ordered by score and then by member.
+		ZRange(key []byte, start, stop int64, reverse bool) ([]ScoredMember, error)
+		// ZRangeByScore returns the members with scores between min and max.
+		ZRangeByScore(key []byte, min, max ScoreBound, opts ZRangeOptions) ([]ScoredMember, error)
+		// ZRank returns the rank of the member. It returns ErrNil if the
+		// member does not exist.
+		//
+		// The members of lower scores are counted by seeking an index of
+		// the scores, but the members of the same score are iterated, so
+		// ZRank takes time in proportion to the ties of the score.
+		ZRank(key []byte, member []byte, reverse bool) (int64, error)
+
+		// TSAdd adds the members to the ttl set, each of which expires after
+		// lease. The expiry of the existing members is refreshed. It returns
+		// the number of members added.
+		TSAdd(key []byte, lease time.Duration, members ...[]byte) (int64, error)
+		TSRem(key []byte, members ...[]byte) (int64, error)
+		TSIsMember(key []byte, member []byte) (bool, error)
+		// TSCard counts the live members of the ttl set, which takes time in
+		// proportion to the number of members.
+		TSCard(key []byte) (int64, error)
+
+		// RateLimit takes opts.Cost from the rate limiter at key, which is
+		// created on demand. The request is denied without taking anything
+		// if the limit would be exceeded. It returns ErrInvalidRateLimit
+		// unless opts.Limit and opts.Period are positive, and opts.Period is
+		// at least a nanosecond per request for gcra.
+		RateLimit(key []byte, opts RateLimitOptions) (RateLimitResult, error)
+
+		// LockAcquire acquires the lock at key for owner, which is released
+		// after lease unless renewed. The owner holding the lock is able to
+		// acquire it again. It returns a fencing token, which is greater than
+		// the tokens of all prior acquisitions, or ok = false if the lock is
+		// held by another owner. The tokens are stored with the data, so a
+		// restored backup issues the tokens after the ones it holds again.
+		LockAcquire(key []byte, owner []byte, lease time.Duration) (token int64, ok bool, err error)
+		// LockRenew extends the lease of the lock if it is held by owner.
+		LockRenew(key []byte, owner []byte, lease time.Duration) (bool, error)
+		// LockRelease releases the lock if it is held by owner.
+		LockRelease(key []byte, owner []byte) (bool, error)
+
+		// QPush enqueues the messages, which become visible to receivers
+		// after delay. It returns the number of messages in the queue.
+		QPush(key []byte, delay time.Duration, messages ...[]byte) (int64, error)
+		// QReceive takes up to opts.Count visible messages in order, which
+		// are invisible to other receivers until acknowledged or until the
+		// visibility timeout elapses, after which they are delivered again.
+		QReceive(key []byte, opts QReceiveOptions) ([]QueueMessage, error)
+		// QAck deletes the messages of the receipts. The receipts are void
+		// once the messages are delivered again.
+		QAck(key []byte, receipts ...[]byte) (int64, error)
+		// QLen returns the number of messages in the queue, including the
+		// delayed and the in-flight ones.
+		QLen(key []byte) (int64, error)
+
+		Exists(keys ...[]byte) (int64, error)
+		Del(keys ...[]byte) (int64, error)
 		Expire(key []byte, lease time.Duration) (bool, error)
 		Persist(key []byte) (bool, error)
 	}
@@ -60,6 +275,148 @@ type (
 		PrefetchSize   int
 		Prefix         []byte
 		Reverse        bool
+		Limit          int    // maximum number of keys examined, including the filtered ones; no limit if <= 0
+		EndKey         []byte // stop before reaching EndKey; optional
+		Match          []byte // glob-style pattern of keys; optional
+		Type           string // data type of values; optional
+	}
+
+	KeyEvent struct {
+		Event string // name of the event, e.g. "lpush"
+		Key   []byte
+	}
+
+	EventListener func(event KeyEvent)
+
+	CaptureOptions struct {
+		Prefixes   [][]byte  // prefixes of the captured keys; all keys if empty
+		Since      uint64    // replay the changes after the version; none if zero
+		SinceTime  time.Time // replay the changes committed after the time instead; none if zero
+		BufferSize int       // maximum number of changes not yet passed to fn; no limit if <= 0
+	}
+
+	// Change is a committed write of a top-level key. The replayed changes
+	// include every version, since the versions are retained for
+	// HistoryRetention of Config.
+	Change struct {
+		Key       []byte
+		Type      string // data type of the key; TYPE_NONE if deleted
+		Value     []byte // value of strings; nil for other types
+		Version   uint64
+		ExpiresAt uint64 // in unix seconds; zero if the key never expires
+	}
+
+	SnapshotStatus struct {
+		LastSuccess time.Time // zero if no snapshot succeeded
+		LastFailure time.Time // zero if no snapshot failed
+		LastError   string
+		LastVersion uint64 // version of the last successful snapshot
+		Successes   int64
+		Failures    int64
+	}
+
+	RaftStatus struct {
+		NodeID        string
+		State         string // Follower, Candidate, Leader or Shutdown
+		LeaderID      string
+		LeaderAddress string
+		AppliedIndex  uint64
+		Members       []RaftMember
+	}
+
+	RaftMember struct {
+		ID      string
+		Address string
+	}
+
+	ClusterNode struct {
+		ID      string
+		Address string
+		Slots   []SlotRange
+	}
+
+	// SlotRange is the range of the hash slots from Start to End inclusive.
+	SlotRange struct {
+		Start int
+		End   int
+	}
+
+	ScoredMember struct {
+		Member []byte
+		Score  float64
+	}
+
+	// ScoreBound is the bound of a score range. Use math.Inf for unbounded
+	// ranges.
+	ScoreBound struct {
+		Value     float64
+		Exclusive bool
+	}
+
+	ZAddOptions struct {
+		IfNotExists bool // add new members only
+		IfExists    bool // update existing members only
+		GreaterThan bool // update if the new score is greater
+		LessThan    bool // update if the new score is less
+		Changed     bool // count the updated members as well
+	}
+
+	ZRangeOptions struct {
+		Reverse bool
+		Offset  int64
+		Count   int64 // zero or negative means all
+	}
+
+	RateLimitOptions struct {
+		Algorithm string        // one of the RATE_LIMIT_* algorithms
+		Limit     int64         // number of requests allowed per period
+		Period    time.Duration // length of the window
+		Cost      int64         // number of requests taken by this request
+	}
+
+	RateLimitResult struct {
+		Allowed    bool
+		Remaining  int64         // number of requests left
+		RetryAfter time.Duration // zero if allowed, negative if never
+		ResetAfter time.Duration // time until the limiter is fully reset
+	}
+
+	QReceiveOptions struct {
+		Count       int           // maximum number of messages to receive
+		Visibility  time.Duration // visibility timeout of received messages
+		MaxReceives int64         // dead-letter messages received more times; no limit if <= 0
+		DeadLetter  []byte        // queue of dead-lettered messages; discarded if nil
+	}
+
+	QueueMessage struct {
+		ID       int64
+		Receipt  []byte // handle of the delivery to acknowledge
+		Receives int64  // number of times the message has been received
+		Body     []byte
+	}
+
+	WatchedKey struct {
+		Key     []byte
+		Version uint64
+	}
+
+	KeyValue struct {
+		Key   []byte
+		Value []byte
+	}
+
+	FieldValue struct {
+		Field []byte
+		Value []byte
+	}
+
+	SetOptions struct {
+		Lease       time.Duration // EX/PX: expire after the lease
+		ExpireAt    time.Time     // EXAT/PXAT: expire at the specified time
+		KeepTTL     bool          // KEEPTTL: retain the time to live of the existing key
+		IfNotExists bool          // NX: only set the key if it does not already exist
+		IfExists    bool          // XX: only set the key if it already exists
+		ReturnOld   bool          // GET: return the old value stored at key
 	}
 
 	Constraint[T comparable] interface {
@@ -1,5 +1,23 @@
 package sdk
 
+const (
+	ErrWrongType = Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrNaN       = Error("resulting score is not a number (NaN)")
+
+	ErrUnknownAlgorithm = Error("unknown rate limit algorithm")
+	ErrInvalidRateLimit = Error("ERR invalid rate limit period or limit")
+	ErrSlowConsumer     = Error("consumer is too slow to keep up with the changes")
+	ErrHistoryTooOld    = Error("changes since the version or time are no longer retained")
+	ErrDatabaseNotEmpty = Error("database is not empty")
+	ErrDatabaseRunning  = Error("database is running")
+	ErrReadOnly         = Error("READONLY You can't write against a read only replica.")
+	ErrNotReplica       = Error("database is not a replica")
+	ErrNotLeader        = Error("NOTLEADER the node is not the raft leader")
+	ErrRaftUnsupported  = Error("ERR the command is not supported by raft members")
+	ErrBusyKey          = Error("BUSYKEY Target key name already exists.")
+	ErrInvalidDump      = Error("ERR DUMP payload version or checksum are wrong")
+)
+
 var (
 	_ error = Error("")
 )
@@ -0,0 +1,79 @@
+package sdk
+
+import "fmt"
+
+// The flags of keyspace notifications, which are configured by the same
+// characters as the notify-keyspace-events option of Redis.
+const (
+	NOTIFY_KEYSPACE = 1 << iota // K: publish to __keyspace@0__:<key>
+	NOTIFY_KEYEVENT             // E: publish to __keyevent@0__:<event>
+	NOTIFY_GENERIC              // g: del, expire, persist
+	NOTIFY_STRING               // $: set, incrby, decrby, incrbyfloat
+	NOTIFY_LIST                 // l: lpush, rpush, lpop, rpop
+	NOTIFY_SET                  // s: sadd, srem, tsadd, tsrem
+	NOTIFY_HASH                 // h: hset, hdel, hincrby, hincrbyfloat
+	NOTIFY_ZSET                 // z: zadd, zincr, zrem
+	NOTIFY_EXPIRED              // x: expired
+
+	NOTIFY_ALL = NOTIFY_GENERIC | NOTIFY_STRING | NOTIFY_LIST | NOTIFY_SET | NOTIFY_HASH | NOTIFY_ZSET | NOTIFY_EXPIRED // A
+)
+
+// ParseKeyspaceEvents parses the flags of keyspace notifications. The
+// notifications are disabled if neither K nor E is present.
+func ParseKeyspaceEvents(flags string) (int, error) {
+	var value int = 0
+
+	for _, c := range flags {
+		switch c {
+		case 'K':
+			value |= NOTIFY_KEYSPACE
+		case 'E':
+			value |= NOTIFY_KEYEVENT
+		case 'g':
+			value |= NOTIFY_GENERIC
+		case '$':
+			value |= NOTIFY_STRING
+		case 'l':
+			value |= NOTIFY_LIST
+		case 's':
+			value |= NOTIFY_SET
+		case 'h':
+			value |= NOTIFY_HASH
+		case 'z':
+			value |= NOTIFY_ZSET
+		case 'x':
+			value |= NOTIFY_EXPIRED
+		case 'A':
+			value |= NOTIFY_ALL
+		default:
+			return 0, fmt.Errorf("unsupported keyspace event flag '%c'", c)
+		}
+	}
+
+	if value&(NOTIFY_KEYSPACE|NOTIFY_KEYEVENT) == 0 {
+		return 0, nil
+	}
+	return value, nil
+}
+
+// KeyspaceEventClass returns the class flag of the event, or zero if the
+// event is not notified.
+func KeyspaceEventClass(event string) int {
+	switch event {
+	case "del", "expire", "persist", "restore":
+		return NOTIFY_GENERIC
+	case "set", "incrby", "decrby", "incrbyfloat":
+		return NOTIFY_STRING
+	case "lpush", "rpush", "lpop", "rpop":
+		return NOTIFY_LIST
+	case "sadd", "srem", "tsadd", "tsrem":
+		return NOTIFY_SET
+	case "hset", "hdel", "hincrby", "hincrbyfloat":
+		return NOTIFY_HASH
+	case "zadd", "zincr", "zrem":
+		return NOTIFY_ZSET
+	case "expired":
+		return NOTIFY_EXPIRED
+	}
+	return 0
+}
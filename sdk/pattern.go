@@ -0,0 +1,137 @@
+package sdk
+
+// MatchPattern reports whether s matches the glob-style pattern. The
+// syntax is the same as the Redis KEYS command: '*' matches any sequence
+// of bytes, '?' matches any single byte, '[abc]', '[^abc]' and '[a-z]'
+// match a single byte in (or not in) the brackets, and '\' escapes the
+// next byte.
+//
+// The pattern is matched iteratively, and only the last '*' is backtracked,
+// since a later '*' matches whatever an earlier one would leave over. So the
+// time is bounded by len(pattern) * len(s) for any pattern.
+func MatchPattern(pattern, s []byte) bool {
+	var (
+		p, i = 0, 0
+		star = -1 // position in pattern after the last '*'; -1 if none
+		mark = 0  // position in s where the bytes of the last '*' end
+	)
+
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				for p < len(pattern) && pattern[p] == '*' {
+					p++
+				}
+				star, mark = p, i
+				continue
+			case '?':
+				p++
+				i++
+				continue
+			case '[':
+				if ok, n := matchClass(pattern[p:], s[i]); ok {
+					p += n
+					i++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) {
+					if pattern[p+1] == s[i] {
+						p += 2
+						i++
+						continue
+					}
+					break
+				}
+				fallthrough
+			default:
+				if pattern[p] == s[i] {
+					p++
+					i++
+					continue
+				}
+			}
+		}
+
+		// let the last '*' match one more byte, and retry the rest
+		if star < 0 {
+			return false
+		}
+		mark++
+		p, i = star, mark
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// PatternPrefix returns the longest literal prefix of the glob-style
+// pattern. All strings matching the pattern start with the prefix.
+func PatternPrefix(pattern []byte) []byte {
+	var prefix []byte
+
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?', '[':
+			return prefix
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+		}
+		prefix = append(prefix, pattern[i])
+	}
+	return prefix
+}
+
+// matchClass matches c with the bracket expression at the beginning of
+// pattern. It returns the length of the bracket expression as well.
+func matchClass(pattern []byte, c byte) (bool, int) {
+	var (
+		i     = 1
+		not   = false
+		match = false
+	)
+
+	if i < len(pattern) && pattern[i] == '^' {
+		not = true
+		i++
+	}
+
+	for ; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == ']':
+			if not {
+				match = !match
+			}
+			return match, i + 1
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			if pattern[i] == c {
+				match = true
+			}
+		case i+2 < len(pattern) && pattern[i+1] == '-':
+			start, end := pattern[i], pattern[i+2]
+			if start > end {
+				start, end = end, start
+			}
+			if c >= start && c <= end {
+				match = true
+			}
+			i += 2
+		default:
+			if pattern[i] == c {
+				match = true
+			}
+		}
+	}
+
+	// unterminated bracket expression matches up to the end of pattern
+	if not {
+		match = !match
+	}
+	return match, len(pattern)
+}
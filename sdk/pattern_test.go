@@ -0,0 +1,72 @@
+package sdk_test
+
+import (
+	"badgerlit/sdk"
+	"strings"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"*", "", true},
+		{"*", "foo", true},
+		{"foo", "foo", true},
+		{"foo", "foobar", false},
+		{"foo*", "foobar", true},
+		{"*bar", "foobar", true},
+		{"f*o*r", "foobar", true},
+		{"f*o*z", "foobar", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"session:*:user:42", "session:abc:user:42", true},
+		{"session:*:user:42", "session:abc:user:421", false},
+		{"h[a-b]*", "hb", true},
+		{"*\\", "foo\\", true},
+		{"a*b*c", "abxbxc", true},
+		{"a*b*c", "abxbx", false},
+		{"**a", "bba", true},
+		{"*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 1000), false},
+		{"*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 1000) + "b", true},
+	}
+
+	for _, c := range cases {
+		got := sdk.MatchPattern([]byte(c.pattern), []byte(c.s))
+		if got != c.want {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", c.pattern, c.s, got, c.want)
+		}
+	}
+}
+
+func TestPatternPrefix(t *testing.T) {
+	cases := []struct {
+		pattern string
+		want    string
+	}{
+		{"*", ""},
+		{"foo", "foo"},
+		{"foo*", "foo"},
+		{"session:*:user:42", "session:"},
+		{"h?llo", "h"},
+		{"h[ae]llo", "h"},
+		{"h\\*llo*", "h*llo"},
+	}
+
+	for _, c := range cases {
+		got := string(sdk.PatternPrefix([]byte(c.pattern)))
+		if got != c.want {
+			t.Errorf("PatternPrefix(%q) = %q, want %q", c.pattern, got, c.want)
+		}
+	}
+}
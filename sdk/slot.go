@@ -0,0 +1,30 @@
+package sdk
+
+import "bytes"
+
+// KeySlot returns the hash slot of the key, which is the CRC16 of the key,
+// or of its hash tag enclosed in the first {...}, modulo CLUSTER_SLOTS.
+func KeySlot(key []byte) int {
+	if start := bytes.IndexByte(key, '{'); start >= 0 {
+		if end := bytes.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) % CLUSTER_SLOTS
+}
+
+// crc16 is CRC-16/XMODEM, which is used by Redis Cluster.
+func crc16(data []byte) uint16 {
+	var crc uint16 = 0
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,28 @@
+package sdk_test
+
+import (
+	"badgerlit/sdk"
+	"testing"
+)
+
+func TestKeySlot(t *testing.T) {
+	cases := []struct {
+		key      string
+		expected int
+	}{
+		// the CRC-16/XMODEM check value is 0x31c3
+		{"123456789", 0x31c3},
+		{"", 0},
+		{"{user1000}.following", sdk.KeySlot([]byte("user1000"))},
+		{"{user1000}.followers", sdk.KeySlot([]byte("user1000"))},
+		{"foo{bar}{zap}", sdk.KeySlot([]byte("bar"))},
+		{"foo{{bar}}zap", sdk.KeySlot([]byte("{bar"))},
+		{"foo{}{bar}", 8363},
+		{"foo{bar", 15278},
+	}
+	for _, c := range cases {
+		if slot := sdk.KeySlot([]byte(c.key)); slot != c.expected {
+			t.Errorf("%q: expect slot %d, but got %d", c.key, c.expected, slot)
+		}
+	}
+}
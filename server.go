@@ -0,0 +1,255 @@
+package main
+
+import (
+	"badgerlit/sdk"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tidwall/resp"
+)
+
+type (
+	// ReplyWriter writes the reply of a command.
+	ReplyWriter interface {
+		WriteValue(v resp.Value) error
+		WriteSimpleString(s string) error
+		WriteBytes(b []byte) error
+		WriteString(s string) error
+		WriteNull() error
+		WriteError(err error) error
+		WriteInteger(i int) error
+		WriteArray(vals []resp.Value) error
+	}
+
+	// CommandFunc handles a command with the specified sdk.Operations.
+	// Returning false will close the connection.
+	CommandFunc func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool
+)
+
+type Server struct {
+	db       sdk.Storage
+	blocking *blockingRegistry
+	pubsub   *pubsubRegistry
+
+	// keyspaceEvents is the flags of keyspace notifications.
+	keyspaceEvents int
+
+	// replica is nil unless the server is a replica, and replicas is the
+	// number of the replicas of the server.
+	replicaMutex sync.Mutex
+	replica      *replica
+	replicas     atomic.Int64
+
+	// cluster is nil unless the server is a node of the sharded cluster.
+	cluster *cluster
+
+	// backupPath is the directory of the backups written by BACKUP, which
+	// is disabled if the path is empty.
+	backupPath string
+
+	mutex            sync.RWMutex
+	handlers         map[string]CommandFunc
+	blockingHandlers map[string]BlockingCommandFunc
+}
+
+func NewServer(db sdk.Storage, conf *sdk.Config) *Server {
+	s := &Server{
+		db:               db,
+		blocking:         newBlockingRegistry(),
+		pubsub:           newPubsubRegistry(conf.SubscriberBufferSize),
+		backupPath:       conf.BackupPath,
+		handlers:         make(map[string]CommandFunc),
+		blockingHandlers: make(map[string]BlockingCommandFunc),
+	}
+	db.Listen(s.blocking.listen)
+
+	// NOTE: the flags had been validated with the config
+	s.keyspaceEvents, _ = conf.KeyspaceEvents()
+	if s.keyspaceEvents != 0 {
+		db.Listen(s.notify)
+	}
+
+	if conf.ClusterNodeID != "" {
+		c, err := newCluster(conf)
+		if err != nil {
+			panic(err)
+		}
+		s.cluster = c
+	}
+	return s
+}
+
+// HandleFunc registers the handler function for the given command.
+func (s *Server) HandleFunc(command string, handler CommandFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.handlers[strings.ToUpper(command)] = handler
+}
+
+// HandleBlockingFunc registers the handler function for the given blocking
+// command.
+func (s *Server) HandleBlockingFunc(command string, handler BlockingCommandFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	command = strings.ToUpper(command)
+	s.blockingHandlers[command] = handler
+	s.handlers[command] = func(conn ReplyWriter, db sdk.Operations, args []resp.Value) bool {
+		_, _, blocked := handler(conn, db, args)
+		if blocked {
+			conn.WriteNull()
+		}
+		return true
+	}
+}
+
+// Publish posts the message to the channel. It returns the number of the
+// subscribers which received the message.
+func (s *Server) Publish(channel []byte, message []byte) int {
+	return s.pubsub.publish(channel, message)
+}
+
+// ReplicaOf makes the server a read-only replica of the primary, or
+// promotes the replica to a primary if primary is empty.
+func (s *Server) ReplicaOf(primary string) error {
+	s.replicaMutex.Lock()
+	defer s.replicaMutex.Unlock()
+
+	if s.replica != nil {
+		if s.replica.primary == primary {
+			return nil
+		}
+		s.replica.stop()
+		s.replica = nil
+	}
+
+	if primary == "" {
+		return s.db.SetReadOnly(false)
+	}
+
+	err := s.db.SetReadOnly(true)
+	if err != nil {
+		return err
+	}
+	s.replica = startReplica(s.db, primary)
+	return nil
+}
+
+// ReplicationStatus returns the status of the replication.
+func (s *Server) ReplicationStatus() replicationStatus {
+	s.replicaMutex.Lock()
+	defer s.replicaMutex.Unlock()
+
+	var status replicationStatus
+	if s.replica != nil {
+		status = s.replica.status()
+	}
+	status.Replicas = s.replicas.Load()
+	return status
+}
+
+// notify is the sdk.EventListener which publishes the events of keys to the
+// keyspace and keyevent channels.
+func (s *Server) notify(event sdk.KeyEvent) {
+	if s.keyspaceEvents&sdk.KeyspaceEventClass(event.Event) == 0 {
+		return
+	}
+
+	if s.keyspaceEvents&sdk.NOTIFY_KEYSPACE != 0 {
+		channel := append([]byte("__keyspace@0__:"), event.Key...)
+		s.Publish(channel, []byte(event.Event))
+	}
+	if s.keyspaceEvents&sdk.NOTIFY_KEYEVENT != 0 {
+		channel := []byte("__keyevent@0__:" + event.Event)
+		s.Publish(channel, event.Key)
+	}
+}
+
+// ListenAndServe listens on the TCP network address addr for incoming connections.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts incoming connections on the listener l, which is closed
+// once Serve returns.
+func (s *Server) Serve(l net.Listener) error {
+	defer l.Close()
+
+	go s.blocking.run()
+
+	// NOTE: the connections are accepted here instead of by resp.Server, so
+	// that the sessions own the connections, and are able to close them
+	// while pushing messages to the subscribers.
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+
+			session := newSession(s, conn)
+			session.serve()
+		}()
+	}
+}
+
+func (s *Server) handler(command string) CommandFunc {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.handlers[command]
+}
+
+func (s *Server) blockingHandler(command string) BlockingCommandFunc {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.blockingHandlers[command]
+}
+
+// replyBuffer keeps the reply of a queued command.
+type replyBuffer struct {
+	value resp.Value
+}
+
+func (r *replyBuffer) WriteValue(v resp.Value) error {
+	r.value = v
+	return nil
+}
+
+func (r *replyBuffer) WriteSimpleString(s string) error {
+	return r.WriteValue(resp.SimpleStringValue(s))
+}
+
+func (r *replyBuffer) WriteBytes(b []byte) error {
+	return r.WriteValue(resp.BytesValue(b))
+}
+
+func (r *replyBuffer) WriteString(s string) error {
+	return r.WriteValue(resp.StringValue(s))
+}
+
+func (r *replyBuffer) WriteNull() error {
+	return r.WriteValue(resp.NullValue())
+}
+
+func (r *replyBuffer) WriteError(err error) error {
+	return r.WriteValue(resp.ErrorValue(err))
+}
+
+func (r *replyBuffer) WriteInteger(i int) error {
+	return r.WriteValue(resp.IntegerValue(i))
+}
+
+func (r *replyBuffer) WriteArray(vals []resp.Value) error {
+	return r.WriteValue(resp.ArrayValue(vals))
+}
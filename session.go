@@ -0,0 +1,606 @@
+package main
+
+import (
+	"badgerlit/sdk"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+// serverCommands act on the server instead of the operations of the
+// transaction. They are not allowed inside MULTI, since the queued commands
+// might be run more than once on conflict, or not at all.
+var serverCommands = map[string]bool{
+	"BACKUP":         true,
+	"CLUSTER":        true,
+	"DUMP":           true,
+	"MIGRATE":        true,
+	"PUBLISH":        true,
+	"REPLICAOF":      true,
+	"RESTORE":        true,
+	"RESTORE-ASKING": true,
+	"SHUTDOWN":       true,
+}
+
+// Session keeps the state of a client connection.
+type Session struct {
+	server  *Server
+	conn    *resp.Conn
+	netConn net.Conn
+
+	// closed is closed when the connection cannot be read any more, and
+	// done is closed when the session ends.
+	closed chan struct{}
+	done   chan struct{}
+	err    error
+
+	multi   bool
+	dirty   bool
+	queue   [][]resp.Value
+	watches []sdk.WatchedKey
+
+	// asking is set by ASKING for the next command, which is served even if
+	// its slot is importing to the node of the cluster.
+	asking bool
+
+	// subscriber is created when the session subscribes for the first time.
+	subscriber *subscriber
+
+	// stream streams the captured changes or the replication batches while
+	// the session is streaming, and is closed, with streamErr set, once the
+	// streaming ends.
+	stream     chan resp.Value
+	streamErr  error
+	stopStream context.CancelFunc
+}
+
+func newSession(server *Server, conn net.Conn) *Session {
+	return &Session{
+		server:  server,
+		conn:    resp.NewConn(conn),
+		netConn: conn,
+		closed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (s *Session) serve() {
+	defer close(s.done)
+	defer func() {
+		if s.subscriber != nil {
+			s.server.pubsub.unsubscribeAll(s.subscriber)
+		}
+		if s.stopStream != nil {
+			s.stopStream()
+		}
+	}()
+
+	var commands = make(chan []resp.Value)
+	go s.read(commands)
+
+	for {
+		// NOTE: the messages are written by the session as well as the
+		// replies, so that they never interleave.
+		var (
+			messages <-chan resp.Value
+			dropped  <-chan struct{}
+		)
+		if s.subscriber != nil {
+			messages = s.subscriber.messages
+			dropped = s.subscriber.dropped
+		}
+
+		select {
+		case args, ok := <-commands:
+			if !ok {
+				if !errors.Is(s.err, io.EOF) {
+					s.conn.WriteError(errors.New("ERR " + s.err.Error()))
+				}
+				return
+			}
+			if !s.dispatch(args) {
+				return
+			}
+		case message := <-messages:
+			s.conn.WriteValue(message)
+		case <-dropped:
+			return
+		case message, ok := <-s.stream:
+			if !ok {
+				if s.streamErr != nil {
+					s.conn.WriteError(errors.New("ERR " + s.streamErr.Error()))
+				}
+				s.stream = nil
+				s.stopStream = nil
+				continue
+			}
+			s.conn.WriteValue(message)
+		}
+	}
+}
+
+// read reads the commands of the connection, so that the session is able to
+// find out the connection is closed while the client is blocked.
+func (s *Session) read(commands chan<- []resp.Value) {
+	defer close(commands)
+
+	for {
+		v, _, _, err := s.conn.ReadMultiBulk()
+		if err != nil {
+			s.err = err
+			close(s.closed)
+			return
+		}
+		args := v.Array()
+		if len(args) == 0 {
+			continue
+		}
+		select {
+		case commands <- args:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Session) dispatch(args []resp.Value) bool {
+	var (
+		name    = args[0].String()
+		command = strings.ToUpper(name)
+	)
+
+	if s.subscriber != nil && s.subscriber.count() > 0 {
+		switch command {
+		case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "QUIT":
+		case "PING":
+			var message = []byte{}
+			if len(args) > 1 {
+				message = args[1].Bytes()
+			}
+			s.conn.WriteArray([]resp.Value{
+				resp.StringValue("pong"),
+				resp.BytesValue(message),
+			})
+			return true
+		default:
+			s.conn.WriteError(errors.New("ERR Can't execute '" + name + "': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context"))
+			return true
+		}
+	}
+
+	if s.stream != nil {
+		switch command {
+		case "QUIT":
+		case "PING":
+			s.conn.WriteSimpleString("PONG")
+			return true
+		default:
+			s.conn.WriteError(errors.New("ERR Can't execute '" + name + "': only PING / QUIT are allowed while streaming"))
+			return true
+		}
+	}
+
+	if s.server.cluster != nil {
+		var asking = s.asking || command == "RESTORE-ASKING"
+		s.asking = false
+
+		err := s.server.cluster.route(s.server.db, command, args, asking)
+		if err != nil {
+			if s.multi {
+				s.dirty = true
+			}
+			s.conn.WriteError(err)
+			return true
+		}
+	}
+
+	switch command {
+	case "ASKING":
+		if s.server.cluster == nil {
+			s.conn.WriteError(errors.New("ERR This instance has cluster support disabled"))
+		} else {
+			s.asking = true
+			s.conn.WriteSimpleString("OK")
+		}
+		return true
+	case "CDC":
+		if s.multi {
+			s.conn.WriteError(errors.New("ERR CDC inside MULTI is not allowed"))
+		} else {
+			s.capture(args[1:])
+		}
+		return true
+	case "REPLSYNC":
+		if s.multi {
+			s.conn.WriteError(errors.New("ERR REPLSYNC inside MULTI is not allowed"))
+		} else if len(args) != 2 {
+			s.conn.WriteError(errors.New("ERR wrong number of arguments for '" + name + "' command"))
+		} else {
+			s.replicate(args[1])
+		}
+		return true
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		if s.multi {
+			s.conn.WriteError(errors.New("ERR " + command + " inside MULTI is not allowed"))
+		} else if len(args) < 2 {
+			s.conn.WriteError(errors.New("ERR wrong number of arguments for '" + name + "' command"))
+		} else {
+			s.subscribe(args[1:], command == "PSUBSCRIBE")
+		}
+		return true
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		if s.multi {
+			s.conn.WriteError(errors.New("ERR " + command + " inside MULTI is not allowed"))
+		} else {
+			s.unsubscribe(args[1:], command == "PUNSUBSCRIBE")
+		}
+		return true
+	case "MULTI":
+		if s.multi {
+			s.conn.WriteError(errors.New("ERR MULTI calls can not be nested"))
+		} else {
+			s.multi = true
+			s.conn.WriteSimpleString("OK")
+		}
+		return true
+	case "EXEC":
+		if !s.multi {
+			s.conn.WriteError(errors.New("ERR EXEC without MULTI"))
+		} else {
+			s.exec()
+		}
+		return true
+	case "DISCARD":
+		if !s.multi {
+			s.conn.WriteError(errors.New("ERR DISCARD without MULTI"))
+		} else {
+			s.reset()
+			s.conn.WriteSimpleString("OK")
+		}
+		return true
+	case "WATCH":
+		if s.multi {
+			s.conn.WriteError(errors.New("ERR WATCH inside MULTI is not allowed"))
+		} else if len(args) < 2 {
+			s.conn.WriteError(errors.New("ERR wrong number of arguments for 'Watch' command"))
+		} else {
+			s.watch(args[1:])
+		}
+		return true
+	case "UNWATCH":
+		// NOTE: UNWATCH is queued inside MULTI, where it does nothing, since
+		// EXEC unwatches the keys anyway.
+		if s.multi {
+			s.queue = append(s.queue, args)
+			s.conn.WriteSimpleString("QUEUED")
+		} else {
+			s.watches = nil
+			s.conn.WriteSimpleString("OK")
+		}
+		return true
+	}
+
+	handler := s.server.handler(command)
+	if handler == nil {
+		switch command {
+		case "QUIT":
+			s.conn.WriteSimpleString("OK")
+			return false
+		case "PING":
+			s.conn.WriteSimpleString("PONG")
+			return true
+		}
+
+		if s.multi {
+			s.dirty = true
+		}
+		s.conn.WriteError(errors.New("ERR unknown command '" + name + "'"))
+		return true
+	}
+
+	if s.multi {
+		if serverCommands[command] {
+			s.dirty = true
+			s.conn.WriteError(errors.New("ERR " + command + " inside MULTI is not allowed"))
+			return true
+		}
+		s.queue = append(s.queue, args)
+		s.conn.WriteSimpleString("QUEUED")
+		return true
+	}
+	if blockingHandler := s.server.blockingHandler(command); blockingHandler != nil {
+		return s.block(blockingHandler, args)
+	}
+	return handler(s.conn, s.server.db, args)
+}
+
+// block handles the blocking command, and waits until it is served, timed
+// out or the connection is closed.
+func (s *Session) block(handler BlockingCommandFunc, args []resp.Value) bool {
+	var registry = s.server.blocking
+
+	w, timeout := registry.block(s.conn, s.server.db, handler, args)
+	if w == nil {
+		return true
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case reply := <-w.reply:
+		s.conn.WriteValue(reply)
+	case <-expired:
+		if registry.cancel(w) {
+			s.conn.WriteNull()
+		} else {
+			s.conn.WriteValue(<-w.reply)
+		}
+	case <-s.closed:
+		registry.cancel(w)
+		return false
+	}
+	return true
+}
+
+// subscribe subscribes the session to the channels, or to the patterns if
+// pattern is true, and replies each of them with the number of the
+// subscriptions.
+func (s *Session) subscribe(names []resp.Value, pattern bool) {
+	var kind = "subscribe"
+	if pattern {
+		kind = "psubscribe"
+	}
+
+	if s.subscriber == nil {
+		s.subscriber = s.server.pubsub.newSubscriber(s.netConn)
+	}
+	for _, name := range names {
+		count := s.server.pubsub.subscribe(s.subscriber, name.String(), pattern)
+		s.conn.WriteArray([]resp.Value{
+			resp.StringValue(kind),
+			resp.BytesValue(name.Bytes()),
+			resp.IntegerValue(count),
+		})
+	}
+}
+
+// unsubscribe unsubscribes the session from the channels, or from the
+// patterns if pattern is true. All of them are unsubscribed if names is
+// empty.
+func (s *Session) unsubscribe(names []resp.Value, pattern bool) {
+	var kind = "unsubscribe"
+	if pattern {
+		kind = "punsubscribe"
+	}
+
+	if len(names) == 0 && s.subscriber != nil {
+		subscriptions := s.subscriber.channels
+		if pattern {
+			subscriptions = s.subscriber.patterns
+		}
+		for name := range subscriptions {
+			names = append(names, resp.StringValue(name))
+		}
+	}
+	if len(names) == 0 {
+		var count = 0
+		if s.subscriber != nil {
+			count = s.subscriber.count()
+		}
+		s.conn.WriteArray([]resp.Value{
+			resp.StringValue(kind),
+			resp.NullValue(),
+			resp.IntegerValue(count),
+		})
+		return
+	}
+
+	for _, name := range names {
+		var count = 0
+		if s.subscriber != nil {
+			count = s.server.pubsub.unsubscribe(s.subscriber, name.String(), pattern)
+		}
+		s.conn.WriteArray([]resp.Value{
+			resp.StringValue(kind),
+			resp.BytesValue(name.Bytes()),
+			resp.IntegerValue(count),
+		})
+	}
+}
+
+// capture replies OK and then streams the changes of the keys with the
+// prefixes, which are committed after the version given by SINCE, or after
+// the unix time in milliseconds given by SINCETIME, or after the command if
+// both are absent, until the session ends.
+func (s *Session) capture(args []resp.Value) {
+	var opts = sdk.CaptureOptions{
+		BufferSize: s.server.pubsub.bufferSize,
+	}
+
+	for i := 0; i < len(args); i++ {
+		param := strings.ToUpper(args[i].String())
+
+		// is EOF?
+		if i+1 >= len(args) {
+			s.conn.WriteError(errors.New("ERR syntax error"))
+			return
+		}
+		i++
+
+		switch param {
+		case "SINCE":
+			since, err := strconv.ParseUint(args[i].String(), 10, 64)
+			if err != nil {
+				s.conn.WriteError(errors.New("ERR version is not an integer or out of range"))
+				return
+			}
+			opts.Since = since
+		case "SINCETIME":
+			ms, err := strconv.ParseInt(args[i].String(), 10, 64)
+			if err != nil || ms <= 0 {
+				s.conn.WriteError(errors.New("ERR time is not a positive integer or out of range"))
+				return
+			}
+			opts.SinceTime = time.UnixMilli(ms)
+		case "PREFIX":
+			opts.Prefixes = append(opts.Prefixes, args[i].Bytes())
+		default:
+			s.conn.WriteError(errors.New("ERR syntax error"))
+			return
+		}
+	}
+
+	s.startStream(s.server.pubsub.bufferSize, func(ctx context.Context, send func(resp.Value) error) error {
+		return s.server.db.Capture(ctx, opts, func(change sdk.Change) error {
+			var value = resp.NullValue()
+			if change.Value != nil {
+				value = resp.BytesValue(change.Value)
+			}
+
+			return send(resp.ArrayValue([]resp.Value{
+				resp.StringValue("change"),
+				resp.BytesValue(change.Key),
+				resp.StringValue(change.Type),
+				value,
+				resp.IntegerValue(int(change.Version)),
+				resp.IntegerValue(int(change.ExpiresAt)),
+			}))
+		})
+	})
+}
+
+// replicate replies OK and then streams the replication batches since the
+// version to the replica, until the session ends. Each of them is sent with
+// the time of the primary, so that the replica knows its lag.
+func (s *Session) replicate(arg resp.Value) {
+	since, err := strconv.ParseUint(arg.String(), 10, 64)
+	if err != nil {
+		s.conn.WriteError(errors.New("ERR version is not an integer or out of range"))
+		return
+	}
+
+	s.startStream(1, func(ctx context.Context, send func(resp.Value) error) error {
+		s.server.replicas.Add(1)
+		defer s.server.replicas.Add(-1)
+
+		return s.server.db.Replicate(ctx, since, func(batch []byte, version uint64, full bool) error {
+			var fullValue = 0
+			if full {
+				fullValue = 1
+			}
+
+			return send(resp.ArrayValue([]resp.Value{
+				resp.StringValue("replicate"),
+				resp.BytesValue(batch),
+				resp.IntegerValue(int(version)),
+				resp.IntegerValue(fullValue),
+				resp.IntegerValue(int(time.Now().UnixMilli())),
+			}))
+		})
+	})
+}
+
+// startStream replies OK and runs fn until the session ends. The messages
+// passed to send are written by the session.
+func (s *Session) startStream(bufferSize int, fn func(ctx context.Context, send func(resp.Value) error) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var stream = make(chan resp.Value, bufferSize)
+	s.stream = stream
+	s.stopStream = cancel
+	s.conn.WriteSimpleString("OK")
+
+	go func() {
+		defer close(stream)
+
+		err := fn(ctx, func(message resp.Value) error {
+			select {
+			case stream <- message:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		// NOTE: streamErr is read by the session after stream is closed
+		s.streamErr = err
+	}()
+}
+
+func (s *Session) watch(args []resp.Value) {
+	var (
+		keys = make([][]byte, 0, len(args))
+	)
+	for _, arg := range args {
+		keys = append(keys, arg.Bytes())
+	}
+
+	watches, err := s.server.db.Watch(keys...)
+	if err != nil {
+		s.conn.WriteError(err)
+		return
+	}
+	s.watches = append(s.watches, watches...)
+	s.conn.WriteSimpleString("OK")
+}
+
+func (s *Session) exec() {
+	var (
+		queue   = s.queue
+		watches = s.watches
+		dirty   = s.dirty
+	)
+	s.reset()
+
+	if dirty {
+		s.conn.WriteError(errors.New("EXECABORT Transaction discarded because of previous errors."))
+		return
+	}
+
+	var replies []resp.Value
+
+	err := s.server.db.Multi(watches, func(ops sdk.Operations) error {
+		// NOTE: fn might be retried on conflict, so the replies should be reset
+		replies = make([]resp.Value, 0, len(queue))
+		for _, args := range queue {
+			var (
+				reply   = &replyBuffer{}
+				command = strings.ToUpper(args[0].String())
+			)
+			if command == "UNWATCH" {
+				replies = append(replies, resp.SimpleStringValue("OK"))
+				continue
+			}
+			handler := s.server.handler(command)
+			handler(reply, ops, args)
+			replies = append(replies, reply.value)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, sdk.ErrTxnAborted) {
+			s.conn.WriteNull()
+		} else {
+			s.conn.WriteError(err)
+		}
+		return
+	}
+	s.conn.WriteArray(replies)
+}
+
+func (s *Session) reset() {
+	s.multi = false
+	s.dirty = false
+	s.queue = nil
+	s.watches = nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+// startTestServer serves a memory database with the handlers of the
+// commands, and returns the address of the server.
+func startTestServer(t *testing.T, conf sdk.Config) (*Server, string) {
+	conf.Engine = sdk.ENGINE_MEMORY
+	conf.KeyDiscardInterval = 5 * time.Second
+	conf.KeyDiscardRatio = 0.7
+	conf.QueuePromoteInterval = time.Second
+	if conf.SubscriberBufferSize == 0 {
+		conf.SubscriberBufferSize = sdk.DefaultSubscriberBufferSize
+	}
+
+	db := badger.New(&conf)
+	db.Start(context.Background())
+	t.Cleanup(func() { db.Stop(context.Background()) })
+
+	s := NewServer(db, &conf)
+	registerHandlers(s, db)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go s.Serve(l)
+
+	return s, l.Addr().String()
+}
+
+type testClient struct {
+	t       *testing.T
+	netConn net.Conn
+	conn    *resp.Conn
+}
+
+func dialTestServer(t *testing.T, addr string) *testClient {
+	netConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { netConn.Close() })
+
+	return &testClient{
+		t:       t,
+		netConn: netConn,
+		conn:    resp.NewConn(netConn),
+	}
+}
+
+// do sends the command, and returns its reply.
+func (c *testClient) do(args ...any) resp.Value {
+	c.t.Helper()
+
+	if err := c.conn.WriteMultiBulk(args[0].(string), args[1:]...); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.read()
+}
+
+// read returns the next reply or message.
+func (c *testClient) read() resp.Value {
+	c.t.Helper()
+
+	c.netConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	v, _, err := c.conn.ReadValue()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return v
+}
+
+func TestSession_Multi(t *testing.T) {
+	_, addr := startTestServer(t, sdk.Config{})
+
+	var (
+		client = dialTestServer(t, addr)
+		other  = dialTestServer(t, addr)
+	)
+
+	client.do("MULTI")
+	if v := client.do("SET", "a", "1"); v.String() != "QUEUED" {
+		t.Fatalf("expect QUEUED, but got %q", v.String())
+	}
+	client.do("GET", "a")
+	v := client.do("EXEC")
+	if replies := v.Array(); len(replies) != 2 || replies[0].String() != "OK" || replies[1].String() != "1" {
+		t.Errorf("expect [OK 1], but got %v", v)
+	}
+
+	// the transaction is aborted once the watched key is modified
+	client.do("WATCH", "a")
+	other.do("SET", "a", "2")
+	client.do("MULTI")
+	client.do("SET", "a", "3")
+	if v := client.do("EXEC"); !v.IsNull() {
+		t.Errorf("expect the aborted transaction, but got %v", v)
+	}
+	if v := client.do("GET", "a"); v.String() != "2" {
+		t.Errorf("expect a = %q, but got %q", "2", v.String())
+	}
+
+	// UNWATCH is queued inside MULTI, so the keys are still watched
+	client.do("WATCH", "a")
+	client.do("MULTI")
+	if v := client.do("UNWATCH"); v.String() != "QUEUED" {
+		t.Errorf("expect QUEUED, but got %v", v)
+	}
+	other.do("SET", "a", "2")
+	client.do("SET", "a", "3")
+	if v := client.do("EXEC"); !v.IsNull() {
+		t.Errorf("expect the aborted transaction, but got %v", v)
+	}
+	client.do("MULTI")
+	client.do("UNWATCH")
+	v = client.do("EXEC")
+	if replies := v.Array(); len(replies) != 1 || replies[0].String() != "OK" {
+		t.Errorf("expect [OK], but got %v", v)
+	}
+
+	// DISCARD drops the queued commands
+	client.do("MULTI")
+	client.do("SET", "a", "4")
+	client.do("DISCARD")
+	if v := client.do("GET", "a"); v.String() != "2" {
+		t.Errorf("expect a = %q, but got %q", "2", v.String())
+	}
+
+	// the commands acting on the server are rejected, and the transaction
+	// is discarded
+	client.do("MULTI")
+	client.do("SET", "a", "5")
+	if v := client.do("PUBLISH", "ch", "m"); v.Type() != resp.Error {
+		t.Errorf("expect PUBLISH to be rejected, but got %v", v)
+	}
+	if v := client.do("EXEC"); v.Type() != resp.Error || v.Error().Error() != "EXECABORT Transaction discarded because of previous errors." {
+		t.Errorf("expect EXECABORT, but got %v", v)
+	}
+	if v := client.do("GET", "a"); v.String() != "2" {
+		t.Errorf("expect a = %q, but got %q", "2", v.String())
+	}
+}
@@ -0,0 +1,125 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"io"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	__RESTORE_MAX_PENDING_WRITES = 256
+)
+
+// Backup implements sdk.Storage.
+func (db *DB) Backup(w io.Writer, since uint64) (uint64, error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	return backup(db.db, w, since)
+}
+
+// backup writes the versions of all keys since the version to w, and
+// returns the version to pass as since for the next incremental backup.
+func backup(db *badger.DB, w io.Writer, since uint64) (uint64, error) {
+	version, err := db.Backup(w, since)
+	if err != nil {
+		return 0, err
+	}
+
+	// NOTE: badger returns the version of the last written entry, which is
+	// zero if nothing is written. Despite its documentation, only the
+	// versions after since are written, so the version is not incremented.
+	if version < since {
+		return since, nil
+	}
+	return version, nil
+}
+
+// Restore implements sdk.Storage.
+func (db *DB) Restore(force bool, backups ...io.Reader) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.disposed {
+		return sdk.ErrDatabaseUnavailable
+	}
+	if db.running {
+		return sdk.ErrDatabaseRunning
+	}
+
+	if !force {
+		empty, err := db.empty()
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return sdk.ErrDatabaseNotEmpty
+		}
+	}
+
+	return db.load(backups...)
+}
+
+// load drops everything and loads the full backup followed by its
+// incremental backups in order.
+func (db *DB) load(backups ...io.Reader) error {
+	// NOTE: the system keys, including the sequence, are restored along
+	// with the others. The leased sequence is released and everything is
+	// dropped first, so that nothing written before wins over the backup.
+	err := db.seq.Load().Release()
+	if err != nil {
+		return err
+	}
+	err = db.db.DropAll()
+	if err == nil {
+		for _, r := range backups {
+			err = db.db.Load(r, __RESTORE_MAX_PENDING_WRITES)
+			if err != nil {
+				break
+			}
+		}
+	}
+	// the backups of an older format are upgraded as the database is
+	if err == nil {
+		err = migrate(db.db, db.logger)
+	}
+
+	seq, seqErr := db.db.GetSequence(__SEQUENCE_KEY, __SEQUENCE_BANDWIDTH)
+	if seqErr != nil {
+		return seqErr
+	}
+	db.seq.Store(seq)
+	return err
+}
+
+// SnapshotStatus implements sdk.Storage.
+func (db *DB) SnapshotStatus() sdk.SnapshotStatus {
+	if db.snapshotTask == nil {
+		return sdk.SnapshotStatus{}
+	}
+	return db.snapshotTask.Status()
+}
+
+// empty reports whether the database holds no keys but the system keys.
+func (db *DB) empty() (bool, error) {
+	var empty bool = true
+
+	err := db.db.View(func(txn *badger.Txn) error {
+		iterOpts := badger.DefaultIteratorOptions
+		iterOpts.PrefetchValues = false
+
+		iter := txn.NewIterator(iterOpts)
+		defer iter.Close()
+
+		// NOTE: the system namespace is ordered before the others
+		iter.Seek([]byte{__NAMESPACE_SYSTEM + 1})
+		empty = !iter.Valid()
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return empty, nil
+}
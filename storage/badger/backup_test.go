@@ -0,0 +1,94 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDB_Restore(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	source := badger.New(&config)
+	source.Start(context.Background())
+	defer source.Stop(context.Background())
+
+	var full, incremental bytes.Buffer
+
+	if _, _, err := source.Set([]byte("a"), []byte("1"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.HSet([]byte("h"), sdk.FieldValue{Field: []byte("f"), Value: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	since, err := source.Backup(&full, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := source.Set([]byte("a"), []byte("2"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Del([]byte("h")); err != nil {
+		t.Fatal(err)
+	}
+	next, err := source.Backup(&incremental, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next <= since {
+		t.Errorf("expect next version after %d, but got %d", since, next)
+	}
+
+	db := badger.New(&config)
+	defer db.Stop(context.Background())
+
+	if err := db.Restore(false, bytes.NewReader(full.Bytes()), bytes.NewReader(incremental.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	// the restored keys are not dropped unless forced
+	if err := db.Restore(false, bytes.NewReader(full.Bytes())); !errors.Is(err, sdk.ErrDatabaseNotEmpty) {
+		t.Fatalf("expect ErrDatabaseNotEmpty, but got %v", err)
+	}
+
+	db.Start(context.Background())
+
+	if err := db.Restore(true, bytes.NewReader(full.Bytes())); !errors.Is(err, sdk.ErrDatabaseRunning) {
+		t.Errorf("expect ErrDatabaseRunning, but got %v", err)
+	}
+
+	value, err := db.Get([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "2" {
+		t.Errorf("expect a = %q, but got %q", "2", value)
+	}
+	if typ, err := db.Type([]byte("h")); err != nil || typ != sdk.TYPE_NONE {
+		t.Errorf("expect h to be deleted, but got %q, %v", typ, err)
+	}
+
+	// the collections created after the restore never reuse the ids of the
+	// restored ones
+	if _, err := db.HSet([]byte("h2"), sdk.FieldValue{Field: []byte("f"), Value: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.HSet([]byte("h"), sdk.FieldValue{Field: []byte("g"), Value: []byte("w")}); err != nil {
+		t.Fatal(err)
+	}
+	fvs, err := db.HGetAll([]byte("h2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fvs) != 1 {
+		t.Errorf("expect 1 field of h2, but got %d", len(fvs))
+	}
+}
@@ -0,0 +1,323 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"bytes"
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+)
+
+const (
+	__CAPTURE_MARKER_INTERVAL = 10 * time.Millisecond
+)
+
+// capture buffers the changes published by badger, so that the badger
+// subscription never waits for the consumer, which would block the writes.
+type capture struct {
+	mutex   sync.Mutex
+	pending []sdk.Change
+	limit   int
+
+	signal     chan struct{}
+	subscribed chan struct{}
+	once       sync.Once
+}
+
+func newCapture(limit int) *capture {
+	return &capture{
+		limit:      limit,
+		signal:     make(chan struct{}, 1),
+		subscribed: make(chan struct{}),
+	}
+}
+
+// receive is the callback of the badger subscription.
+func (c *capture) receive(list *badger.KVList) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, kv := range list.Kv {
+		if bytes.Equal(kv.Key, __CAPTURE_KEY) {
+			c.once.Do(func() {
+				close(c.subscribed)
+			})
+			continue
+		}
+		c.pending = append(c.pending, decodeChange(kv))
+	}
+	if c.limit > 0 && len(c.pending) > c.limit {
+		return sdk.ErrSlowConsumer
+	}
+
+	select {
+	case c.signal <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// take returns and clears the pending changes.
+func (c *capture) take() []sdk.Change {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	changes := c.pending
+	c.pending = nil
+	return changes
+}
+
+// decodeChange returns the change of the top-level key published by badger.
+// NOTE: the Meta of the published pb.KV is the UserMeta of the entry, which
+// is zero for deletes.
+func decodeChange(kv *pb.KV) sdk.Change {
+	var meta byte = 0
+	if len(kv.Meta) > 0 {
+		meta = kv.Meta[0]
+	}
+
+	change := sdk.Change{
+		Key:       decodeKey(kv.Key),
+		Type:      typeName(meta),
+		Version:   kv.Version,
+		ExpiresAt: kv.ExpiresAt,
+	}
+	if meta == __TYPE_STRING {
+		change.Value = kv.Value
+		if change.Value == nil {
+			change.Value = []byte{}
+		}
+	}
+	return change
+}
+
+// capturePrefixes returns the prefixes without the ones which are covered
+// by others, so that no key matches more than one prefix.
+func capturePrefixes(prefixes [][]byte) [][]byte {
+	if len(prefixes) == 0 {
+		return [][]byte{{}}
+	}
+
+	sorted := append([][]byte{}, prefixes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+
+	var result [][]byte
+	for _, prefix := range sorted {
+		if len(result) > 0 && bytes.HasPrefix(prefix, result[len(result)-1]) {
+			continue
+		}
+		result = append(result, prefix)
+	}
+	return result
+}
+
+// Capture implements sdk.Storage. The badger subscription is set up before
+// the retained changes are replayed from a snapshot, and the changes which
+// are covered by the snapshot are skipped, so that nothing is missed or
+// passed twice in between.
+func (db *DB) Capture(ctx context.Context, opts sdk.CaptureOptions, fn func(change sdk.Change) error) error {
+	return db.stream(ctx, func(ctx context.Context) error {
+		return db.capture(ctx, opts, fn)
+	})
+}
+
+func (db *DB) capture(ctx context.Context, opts sdk.CaptureOptions, fn func(change sdk.Change) error) error {
+	var (
+		since  = opts.Since
+		replay = opts.Since > 0
+	)
+	if !opts.SinceTime.IsZero() {
+		version, ok := db.historyTask.versionAt(opts.SinceTime)
+		if !ok {
+			return sdk.ErrHistoryTooOld
+		}
+		since, replay = version, true
+	}
+	if replay && since < db.historyTask.retained() {
+		return sdk.ErrHistoryTooOld
+	}
+
+	var (
+		prefixes = capturePrefixes(opts.Prefixes)
+		matches  = make([]pb.Match, 0, len(prefixes)+1)
+		c        = newCapture(opts.BufferSize)
+		errc     = make(chan error, 1)
+	)
+	matches = append(matches, pb.Match{Prefix: __CAPTURE_KEY})
+	for _, prefix := range prefixes {
+		matches = append(matches, pb.Match{Prefix: encodeKey(prefix)})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		errc <- db.subscribe(ctx, c.receive, matches)
+	}()
+
+	// NOTE: the marker is written only if the database is writable, since
+	// the keys of replicas and raft members are written by the replication
+	// and raft only. Otherwise the changes which might have been committed
+	// before the subscription was set up are caught up with once the first
+	// change is received.
+	var subscribed = db.writable() == nil
+	if subscribed {
+		err := db.awaitCapture(ctx, c, errc)
+		if err != nil {
+			return err
+		}
+	}
+
+	var (
+		snapshot uint64
+		err      error
+	)
+	if replay {
+		var changes []sdk.Change
+
+		changes, snapshot, err = db.scanChanges(prefixes, since, math.MaxUint64)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			err = fn(change)
+			if err != nil {
+				return err
+			}
+		}
+	} else if !subscribed {
+		err = db.db.View(func(txn *badger.Txn) error {
+			snapshot = txn.ReadTs()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errc:
+			return err
+		case <-c.signal:
+			changes := c.take()
+			if !subscribed && len(changes) > 0 {
+				missed, _, err := db.scanChanges(prefixes, snapshot, changes[0].Version)
+				if err != nil {
+					return err
+				}
+				changes = append(missed, changes...)
+				subscribed = true
+			}
+
+			for _, change := range changes {
+				if change.Version <= snapshot {
+					continue
+				}
+				err = fn(change)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// subscribe subscribes to the changes of the keys which match until ctx is
+// done. Unlike badger, it never returns nil, since badger does so once it
+// is closed while the subscriber waits for more changes.
+func (db *DB) subscribe(ctx context.Context, cb func(kv *badger.KVList) error, matches []pb.Match) error {
+	err := db.db.Subscribe(ctx, cb, matches)
+	if err == nil {
+		return sdk.ErrDatabaseUnavailable
+	}
+	return err
+}
+
+// awaitCapture waits until the badger subscription is set up. Badger tells
+// nothing about it, so the marker key is written until it is received.
+func (db *DB) awaitCapture(ctx context.Context, c *capture, errc <-chan error) error {
+	ticker := time.NewTicker(__CAPTURE_MARKER_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		err := db.db.Update(func(txn *badger.Txn) error {
+			return txn.Set(__CAPTURE_KEY, nil)
+		})
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-c.subscribed:
+			return nil
+		case err := <-errc:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// scanChanges returns the retained versions of the keys with the prefixes,
+// which are newer than since and older than before, in order of versions,
+// and the version of the snapshot which they are read from.
+func (db *DB) scanChanges(prefixes [][]byte, since, before uint64) (changes []sdk.Change, snapshot uint64, err error) {
+	err = db.db.View(func(txn *badger.Txn) error {
+		snapshot = txn.ReadTs()
+
+		for _, prefix := range prefixes {
+			iterOpts := badger.DefaultIteratorOptions
+			iterOpts.PrefetchValues = false
+			iterOpts.AllVersions = true
+			iterOpts.Prefix = encodeKey(prefix)
+
+			iter := txn.NewIterator(iterOpts)
+			for iter.Rewind(); iter.Valid(); iter.Next() {
+				item := iter.Item()
+				if item.Version() <= since || item.Version() >= before {
+					continue
+				}
+
+				// NOTE: the deletes are the entries without data types
+				change := sdk.Change{
+					Key:       decodeKey(item.KeyCopy(nil)),
+					Type:      typeName(item.UserMeta()),
+					Version:   item.Version(),
+					ExpiresAt: item.ExpiresAt(),
+				}
+				if item.UserMeta() == __TYPE_STRING {
+					change.Value, err = item.ValueCopy(nil)
+					if err != nil {
+						iter.Close()
+						return err
+					}
+					if change.Value == nil {
+						change.Value = []byte{}
+					}
+				}
+				changes = append(changes, change)
+			}
+			iter.Close()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Version < changes[j].Version
+	})
+	return changes, snapshot, nil
+}
@@ -0,0 +1,284 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDB_Capture(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	if _, _, err := db.Set([]byte("user:1"), []byte("a"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	watches, err := db.Watch([]byte("user:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := watches[0].Version
+
+	if _, _, err := db.Set([]byte("user:1"), []byte("b"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.HSet([]byte("order:1"), sdk.FieldValue{Field: []byte("f"), Value: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Del([]byte("user:1")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var (
+		changes  = make(chan sdk.Change, 16)
+		captured = make(chan error, 1)
+	)
+	go func() {
+		captured <- db.Capture(ctx, sdk.CaptureOptions{
+			Prefixes: [][]byte{[]byte("user:")},
+			Since:    since,
+		}, func(change sdk.Change) error {
+			changes <- change
+			return nil
+		})
+	}()
+
+	var expected = []string{"user:1 string b", "user:1 none "}
+	for i := range expected {
+		select {
+		case change := <-changes:
+			if change.Version <= since {
+				t.Errorf("expect version after %d, but got %d", since, change.Version)
+			}
+			if actual := string(change.Key) + " " + change.Type + " " + string(change.Value); actual != expected[i] {
+				t.Errorf("expect change %q, but got %q", expected[i], actual)
+			}
+		case <-ctx.Done():
+			t.Fatal("expect replayed changes")
+		}
+	}
+
+	// the live changes are passed once the replayed changes are passed
+	if _, _, err := db.Set([]byte("order:2"), []byte("x"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Set([]byte("user:2"), []byte("c"), sdk.SetOptions{Lease: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case change := <-changes:
+		if string(change.Key) != "user:2" || string(change.Value) != "c" || change.ExpiresAt == 0 {
+			t.Errorf("expect change of user:2 with expiry, but got %+v", change)
+		}
+	case <-ctx.Done():
+		t.Fatal("expect live change")
+	}
+
+	cancel()
+	if err := <-captured; !errors.Is(err, context.Canceled) {
+		t.Errorf("expect context.Canceled, but got %v", err)
+	}
+}
+
+func TestDB_Capture_History(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+		HistoryRetention:   time.Millisecond,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	var started = time.Now()
+
+	if _, _, err := db.Set([]byte("user:1"), []byte("a"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	watches, err := db.Watch([]byte("user:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := watches[0].Version
+
+	// the versions are retained for HistoryRetention only, which is renewed
+	// every second, so user:1 is overwritten between the renewals
+	time.Sleep(1100 * time.Millisecond)
+	for _, value := range []string{"b", "c"} {
+		if _, _, err := db.Set([]byte("user:1"), []byte(value), sdk.SetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(2500 * time.Millisecond)
+
+	var resumed = time.Now()
+	if _, _, err := db.Set([]byte("user:2"), []byte("x"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, opts := range []sdk.CaptureOptions{
+		{Since: since},
+		{SinceTime: started.Add(-time.Second)},
+	} {
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		err := db.Capture(ctx, opts, func(change sdk.Change) error { return nil })
+		cancel()
+		if !errors.Is(err, sdk.ErrHistoryTooOld) {
+			t.Errorf("%+v: expect ErrHistoryTooOld, but got %v", opts, err)
+		}
+	}
+
+	// the changes are replayed from the time
+	var changes = make(chan sdk.Change, 16)
+	go db.Capture(ctx, sdk.CaptureOptions{SinceTime: resumed}, func(change sdk.Change) error {
+		changes <- change
+		return nil
+	})
+	select {
+	case change := <-changes:
+		if string(change.Key) != "user:2" || string(change.Value) != "x" {
+			t.Errorf("expect change of user:2, but got %+v", change)
+		}
+	case <-ctx.Done():
+		t.Fatal("expect replayed changes")
+	}
+}
+
+func TestDB_Capture_ReadOnly(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	primary := badger.New(&config)
+	primary.Start(context.Background())
+	defer primary.Stop(context.Background())
+
+	replica := badger.New(&config)
+	replica.Start(context.Background())
+	defer replica.Stop(context.Background())
+
+	if err := replica.SetReadOnly(true); err != nil {
+		t.Fatal(err)
+	}
+
+	// version returns the latest version of the replica
+	version := func() uint64 {
+		var buf bytes.Buffer
+		version, err := replica.Backup(&buf, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return version
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var (
+		before  = version()
+		changes = make(chan sdk.Change, 16)
+	)
+	go replica.Capture(ctx, sdk.CaptureOptions{}, func(change sdk.Change) error {
+		changes <- change
+		return nil
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	// the capture writes nothing to the replica
+	if after := version(); after != before {
+		t.Errorf("expect version %d, but got %d", before, after)
+	}
+
+	if _, _, err := primary.Set([]byte("user:1"), []byte("a"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var batch bytes.Buffer
+	if _, err := primary.Backup(&batch, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.ApplyReplication("primary", batch.Bytes(), 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case change := <-changes:
+		if string(change.Key) != "user:1" || string(change.Value) != "a" {
+			t.Errorf("expect change of user:1, but got %+v", change)
+		}
+	case <-ctx.Done():
+		t.Fatal("expect the replicated change")
+	}
+}
+
+func TestDB_Capture_Stop(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var (
+		changes  = make(chan sdk.Change, 16)
+		captured = make(chan error, 1)
+	)
+	go func() {
+		captured <- db.Capture(ctx, sdk.CaptureOptions{}, func(change sdk.Change) error {
+			changes <- change
+			return nil
+		})
+	}()
+
+	// the key is written until the capture is subscribed
+	for subscribed := false; !subscribed; {
+		if _, _, err := db.Set([]byte("a"), []byte("1"), sdk.SetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-changes:
+			subscribed = true
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("expect the change to be captured")
+		}
+	}
+
+	// the capture ends with an error once the database is stopped
+	db.Stop(context.Background())
+
+	select {
+	case err := <-captured:
+		if !errors.Is(err, sdk.ErrDatabaseUnavailable) {
+			t.Errorf("expect ErrDatabaseUnavailable, but got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("expect the capture to end")
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
@@ -17,15 +17,35 @@ var (
 )
 
 type DB struct {
-	db *badger.DB
+	db  *badger.DB
+	seq atomic.Pointer[badger.Sequence] // replaced once the database is restored or promoted
 
-	keyDiscardTask *KeyDiscardTask
+	// readOnly is set while the database is a replica, whose keys are
+	// written by the replication only.
+	readOnly atomic.Bool
+
+	keyDiscardTask   *KeyDiscardTask
+	elementSweepTask *ElementSweepTask
+	queuePromoteTask *QueuePromoteTask
+	expirySweepTask  *ExpirySweepTask // nil unless the expired keys are notified
+	snapshotTask     *SnapshotTask    // nil unless the snapshots are scheduled
+	historyTask      *HistoryTask     // retains the versions for resuming the captures and replicas
+	raft             *raftNode        // nil unless the database is a raft member
 
 	logger badger.Logger
 
+	listenersMutex sync.RWMutex
+	listeners      []sdk.EventListener
+
 	mutex    sync.Mutex
 	running  bool
 	disposed bool
+
+	// streams counts the running captures and replications, which are
+	// cancelled once stopping is closed, and waited for before badger is
+	// closed.
+	streams  sync.WaitGroup
+	stopping chan struct{}
 }
 
 func New(config *sdk.Config) *DB {
@@ -59,6 +79,13 @@ func New(config *sdk.Config) *DB {
 	if err != nil {
 		panic(err)
 	}
+	if err = migrate(badgerDB, logger); err != nil {
+		panic(err)
+	}
+	seq, err := badgerDB.GetSequence(__SEQUENCE_KEY, __SEQUENCE_BANDWIDTH)
+	if err != nil {
+		panic(err)
+	}
 
 	keyDiscardTask := &KeyDiscardTask{
 		BadgerDB:           badgerDB,
@@ -68,11 +95,88 @@ func New(config *sdk.Config) *DB {
 	}
 	keyDiscardTask.init()
 
-	return &DB{
-		db:             badgerDB,
-		keyDiscardTask: keyDiscardTask,
-		logger:         logger,
+	elementSweepTask := &ElementSweepTask{
+		BadgerDB:      badgerDB,
+		SweepInterval: config.KeyDiscardInterval,
+		Logger:        logger,
+	}
+	elementSweepTask.init()
+
+	promoteInterval := config.QueuePromoteInterval
+	if promoteInterval <= 0 {
+		promoteInterval = sdk.DefaultQueuePromoteInterval
+	}
+	queuePromoteTask := &QueuePromoteTask{
+		BadgerDB:        badgerDB,
+		PromoteInterval: promoteInterval,
+		Logger:          logger,
+	}
+	queuePromoteTask.init()
+
+	historyRetention := config.HistoryRetention
+	if historyRetention <= 0 {
+		historyRetention = sdk.DefaultHistoryRetention
+	}
+	historyTask := &HistoryTask{
+		BadgerDB:  badgerDB,
+		Retention: historyRetention,
+		Logger:    logger,
+	}
+	historyTask.init()
+
+	db := &DB{
+		db:               badgerDB,
+		keyDiscardTask:   keyDiscardTask,
+		elementSweepTask: elementSweepTask,
+		queuePromoteTask: queuePromoteTask,
+		historyTask:      historyTask,
+		logger:           logger,
+		stopping:         make(chan struct{}),
+	}
+	db.seq.Store(seq)
+	elementSweepTask.Paused = db.paused
+	queuePromoteTask.Paused = db.paused
+
+	// NOTE: the expired keys are swept actively only if they are notified,
+	// otherwise they are left to badger.
+	keyspaceEvents, err := config.KeyspaceEvents()
+	if err != nil {
+		logger.Errorf("%v", err)
+	}
+	if keyspaceEvents&sdk.NOTIFY_EXPIRED != 0 {
+		sweepInterval := config.ExpirySweepInterval
+		if sweepInterval <= 0 {
+			sweepInterval = sdk.DefaultExpirySweepInterval
+		}
+		db.expirySweepTask = &ExpirySweepTask{
+			BadgerDB:      badgerDB,
+			SweepInterval: sweepInterval,
+			Notify:        db.notify,
+			Paused:        db.paused,
+			Logger:        logger,
+		}
+		db.expirySweepTask.init()
+	}
+
+	if config.SnapshotInterval > 0 {
+		db.snapshotTask = &SnapshotTask{
+			BadgerDB:             badgerDB,
+			SnapshotInterval:     config.SnapshotInterval,
+			SnapshotPath:         config.SnapshotPath,
+			FullRetention:        config.SnapshotFullRetention,
+			IncrementalRetention: config.SnapshotIncrementalRetention,
+			Logger:               logger,
+		}
+		db.snapshotTask.init()
+	}
+
+	if config.RaftNodeID != "" {
+		db.raft, err = newRaftNode(db, config, logger)
+		if err != nil {
+			panic(err)
+		}
 	}
+	return db
 }
 
 // Start implements sdk.Storage.
@@ -90,6 +194,20 @@ func (db *DB) Start(ctx context.Context) {
 	db.logger.Infof("Ready")
 
 	db.keyDiscardTask.run()
+	db.elementSweepTask.run()
+	db.queuePromoteTask.run()
+	db.historyTask.run()
+	if db.expirySweepTask != nil {
+		db.expirySweepTask.run()
+	}
+	if db.snapshotTask != nil {
+		db.snapshotTask.run()
+	}
+	if db.raft != nil {
+		if err := db.raft.start(); err != nil {
+			panic(err)
+		}
+	}
 	db.running = true
 }
 
@@ -103,305 +221,472 @@ func (db *DB) Stop(ctx context.Context) {
 
 		db.disposed = true
 		db.running = false
+		close(db.stopping)
+		db.streams.Wait()
+		if db.raft != nil {
+			db.raft.stop()
+		}
 		db.keyDiscardTask.stop()
+		db.elementSweepTask.stop()
+		db.queuePromoteTask.stop()
+		if db.expirySweepTask != nil {
+			db.expirySweepTask.stop()
+		}
+		if db.snapshotTask != nil {
+			db.snapshotTask.stop()
+		}
+		db.historyTask.stop()
 
+		db.seq.Load().Release()
 		db.db.Close()
 		db.logger.Infof("Stopped")
 	}
 }
 
-// Del implements sdk.Storage.
-func (db *DB) Del(key []byte) error {
+// stream runs fn, which streams the changes until ctx is done, and makes
+// Stop wait for it. ctx is also cancelled once the database is stopping,
+// and then ErrDatabaseUnavailable is returned.
+func (db *DB) stream(ctx context.Context, fn func(ctx context.Context) error) error {
+	db.mutex.Lock()
 	if !db.running {
+		db.mutex.Unlock()
 		return sdk.ErrDatabaseUnavailable
 	}
+	db.streams.Add(1)
+	db.mutex.Unlock()
 
-	err := db.db.Update(func(txn *badger.Txn) error {
-		return txn.Delete(key)
-	})
-	return err
+	defer db.streams.Done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-db.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := fn(ctx)
+	select {
+	case <-db.stopping:
+		return sdk.ErrDatabaseUnavailable
+	default:
+		return err
+	}
 }
 
-// Exists implements sdk.Storage.
-func (db *DB) Exists(key []byte) (bool, error) {
-	if !db.running {
-		return false, sdk.ErrDatabaseUnavailable
+func (db *DB) newTx(txn *badger.Txn) *Tx {
+	return &Tx{
+		txn: txn,
+		seq: db.seq.Load(),
 	}
+}
+
+// writable returns the error of the writes if they are not allowed.
+func (db *DB) writable() error {
+	if db.raft != nil {
+		// only the writes proposed through raft are allowed
+		return sdk.ErrRaftUnsupported
+	}
+	if db.readOnly.Load() {
+		return sdk.ErrReadOnly
+	}
+	return nil
+}
 
-	err := db.db.View(func(txn *badger.Txn) error {
-		_, err := txn.Get(key)
+// paused reports whether the tasks writing the keys are paused, since the
+// keys are written by the replication or raft only.
+func (db *DB) paused() bool {
+	return db.raft != nil || db.readOnly.Load()
+}
+
+// update runs fn within a read-write transaction, and sends the events to
+// the listeners after the transaction is committed.
+func (db *DB) update(fn func(tx *Tx) error) error {
+	if err := db.writable(); err != nil {
 		return err
-	})
+	}
+
+	var tx *Tx
 
+	err := db.db.Update(func(txn *badger.Txn) error {
+		tx = db.newTx(txn)
+		return fn(tx)
+	})
 	if err != nil {
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			return false, nil
+		return err
+	}
+
+	db.notify(tx.events)
+	return nil
+}
+
+// view runs fn within a read-only transaction. The reads of a raft member
+// wait until they are linearizable, and are rejected unless the member is
+// the leader.
+func (db *DB) view(fn func(tx *Tx) error) error {
+	if db.raft != nil {
+		if err := db.raft.readIndex(); err != nil {
+			return err
 		}
-		return false, err
 	}
-	return true, nil
+
+	return db.db.View(func(txn *badger.Txn) error {
+		return fn(db.newTx(txn))
+	})
 }
 
-// Expire implements sdk.Storage.
-func (db *DB) Expire(key []byte, lease time.Duration) (bool, error) {
-	if !db.running {
-		return false, sdk.ErrDatabaseUnavailable
+// updateRetry runs fn within a read-write transaction, which is retried
+// until it is committed without conflict.
+func (db *DB) updateRetry(fn func(txn *badger.Txn) error) error {
+	if err := db.writable(); err != nil {
+		return err
 	}
 
-	err := db.db.Update(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
-		if err != nil {
-			return err
+	for {
+		err := db.db.Update(fn)
+		if errors.Is(err, badger.ErrConflict) {
+			continue
 		}
+		return err
+	}
+}
 
-		return item.Value(func(val []byte) error {
-			entry := badger.NewEntry(item.Key(), val).
-				WithDiscard().
-				WithTTL(lease)
+func (db *DB) notify(events []sdk.KeyEvent) {
+	if len(events) == 0 {
+		return
+	}
 
-			return txn.SetEntry(entry)
-		})
-	})
+	db.listenersMutex.RLock()
+	defer db.listenersMutex.RUnlock()
 
-	if err != nil {
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			return false, nil
+	for _, event := range events {
+		for _, listener := range db.listeners {
+			listener(event)
 		}
-		return false, err
 	}
-	return true, nil
 }
 
-// Get implements sdk.Storage.
-func (db *DB) Get(key []byte) ([]byte, error) {
+// Del implements sdk.Storage.
+func (db *DB) Del(keys ...[]byte) (count int64, err error) {
 	if !db.running {
-		return nil, sdk.ErrDatabaseUnavailable
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+	if db.raft != nil {
+		return db.raft.del(keys)
 	}
 
-	var reply []byte
+	err = db.update(func(tx *Tx) error {
+		count, err = tx.Del(keys...)
+		return err
+	})
+	return count, err
+}
 
-	err := db.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
-		if err != nil {
-			return err
-		}
+// Exists implements sdk.Storage.
+func (db *DB) Exists(keys ...[]byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
 
-		return item.Value(func(val []byte) error {
-			reply = val
-			return nil
-		})
+	err = db.view(func(tx *Tx) error {
+		count, err = tx.Exists(keys...)
+		return err
 	})
+	return count, err
+}
 
-	if err != nil {
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			return nil, sdk.ErrNil
-		}
-		return nil, err
+// Expire implements sdk.Storage.
+func (db *DB) Expire(key []byte, lease time.Duration) (ok bool, err error) {
+	if !db.running {
+		return false, sdk.ErrDatabaseUnavailable
 	}
-	return reply, nil
+	if db.raft != nil {
+		return db.raft.expire(key, lease)
+	}
+
+	err = db.update(func(tx *Tx) error {
+		ok, err = tx.Expire(key, lease)
+		return err
+	})
+	return ok, err
 }
 
-// IncrBy implements sdk.Storage.
-func (db *DB) IncrBy(key []byte, increment int64, constraints ...sdk.Constraint[int64]) (int64, error) {
+// Get implements sdk.Storage.
+func (db *DB) Get(key []byte) (reply []byte, err error) {
 	if !db.running {
-		return 0, sdk.ErrDatabaseUnavailable
+		return nil, sdk.ErrDatabaseUnavailable
 	}
 
-	var result int64 = 0
+	err = db.view(func(tx *Tx) error {
+		reply, err = tx.Get(key)
+		return err
+	})
+	return reply, err
+}
 
-	err := db.db.Update(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
-		if err != nil {
-			if !errors.Is(err, badger.ErrKeyNotFound) {
-				return err
-			}
-		}
+// IncrBy implements sdk.Storage.
+func (db *DB) IncrBy(key []byte, increment int64, lease time.Duration, constraints ...sdk.Constraint[int64]) (result int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+	if db.raft != nil {
+		return db.raft.incrBy(key, increment, lease, constraints)
+	}
 
-		var value []byte
-		{
-			var number int64 = 0
+	err = db.update(func(tx *Tx) error {
+		result, err = tx.IncrBy(key, increment, lease, constraints...)
+		return err
+	})
+	return result, err
+}
 
-			if item != nil {
-				err = item.Value(func(val []byte) error {
-					n, err := strconv.ParseInt(string(val), 10, 64)
-					if err != nil {
-						return sdk.ErrNonInteger
-					}
+// IncrByFloat implements sdk.Storage.
+func (db *DB) IncrByFloat(key []byte, increment float64, lease time.Duration, constraints ...sdk.Constraint[float64]) (result float64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
 
-					number = n
-					return nil
-				})
-				if err != nil {
-					return err
-				}
-			}
+	err = db.update(func(tx *Tx) error {
+		result, err = tx.IncrByFloat(key, increment, lease, constraints...)
+		return err
+	})
+	return result, err
+}
 
-			// add increment & export
-			result = number + increment
+// Listen implements sdk.Storage.
+func (db *DB) Listen(listener sdk.EventListener) {
+	db.listenersMutex.Lock()
+	defer db.listenersMutex.Unlock()
 
-			// check
-			for _, constraint := range constraints {
-				ok := constraint.Check(result)
-				if !ok {
-					return sdk.ErrViolateConstraints
-				}
-			}
+	db.listeners = append(db.listeners, listener)
+}
 
-			// export
-			value = []byte(strconv.FormatInt(result, 10))
-		}
+// MGet implements sdk.Storage.
+func (db *DB) MGet(keys ...[]byte) (reply [][]byte, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
 
-		entry := badger.NewEntry(key, value).WithDiscard()
-		return txn.SetEntry(entry)
+	err = db.view(func(tx *Tx) error {
+		reply, err = tx.MGet(keys...)
+		return err
 	})
-	return result, err
+	return reply, err
 }
 
-// IncrByFloat implements sdk.Storage.
-func (db *DB) IncrByFloat(key []byte, increment float64, constraints ...sdk.Constraint[float64]) (float64, error) {
+// MSet implements sdk.Storage.
+func (db *DB) MSet(kvs ...sdk.KeyValue) error {
 	if !db.running {
-		return 0, sdk.ErrDatabaseUnavailable
+		return sdk.ErrDatabaseUnavailable
+	}
+	if err := db.writable(); err != nil {
+		return err
 	}
 
-	var result float64 = 0
+	wb := db.db.NewWriteBatch()
+	defer wb.Cancel()
 
-	err := db.db.Update(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
+	var events = make([]sdk.KeyEvent, 0, len(kvs))
+	for _, kv := range kvs {
+		entry := badger.NewEntry(encodeKey(kv.Key), kv.Value).
+			WithMeta(__TYPE_STRING).
+			WithDiscard()
+
+		err := wb.SetEntry(entry)
 		if err != nil {
-			if !errors.Is(err, badger.ErrKeyNotFound) {
-				return err
-			}
+			return err
 		}
+		err = wb.SetEntry(badger.NewEntry(slotKey(kv.Key), nil).WithDiscard())
+		if err != nil {
+			return err
+		}
+		events = append(events, sdk.KeyEvent{
+			Event: "set",
+			Key:   kv.Key,
+		})
+	}
 
-		var value []byte
-		{
-			var number float64 = 0
+	err := wb.Flush()
+	if err != nil {
+		return err
+	}
+	db.notify(events)
+	return nil
+}
 
-			if item != nil {
-				err = item.Value(func(val []byte) error {
-					n, err := strconv.ParseFloat(string(val), 64)
-					if err != nil {
-						return sdk.ErrNonInteger
-					}
+// MSetNX implements sdk.Storage.
+func (db *DB) MSetNX(kvs ...sdk.KeyValue) (ok bool, err error) {
+	if !db.running {
+		return false, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		ok, err = tx.MSetNX(kvs...)
+		return err
+	})
+	return ok, err
+}
+
+// Multi implements sdk.Storage.
+func (db *DB) Multi(watches []sdk.WatchedKey, fn func(ops sdk.Operations) error) error {
+	if !db.running {
+		return sdk.ErrDatabaseUnavailable
+	}
+	if db.raft != nil {
+		return sdk.ErrRaftUnsupported
+	}
+
+	// NOTE: the transaction of a replica is read-only, which fails with
+	// ErrReadOnly once fn writes.
+	var (
+		readOnly = db.readOnly.Load()
+		run      = db.db.Update
+	)
+	if readOnly {
+		run = db.db.View
+	}
+
+	for {
+		var tx *Tx
+
+		err := run(func(txn *badger.Txn) error {
+			// check watched keys
+			for _, watch := range watches {
+				var version uint64 = 0
 
-					number = n
-					return nil
-				})
+				item, err := txn.Get(encodeKey(watch.Key))
 				if err != nil {
-					return err
+					if !errors.Is(err, badger.ErrKeyNotFound) {
+						return err
+					}
+				} else {
+					version = item.Version()
 				}
-			}
-
-			// add increment & export
-			result = number + increment
 
-			// check
-			for _, constraint := range constraints {
-				ok := constraint.Check(result)
-				if !ok {
-					return sdk.ErrViolateConstraints
+				if version != watch.Version {
+					return sdk.ErrTxnAborted
 				}
 			}
 
-			// export
-			value = []byte(strconv.FormatFloat(result, 'f', 4, 64))
+			tx = db.newTx(txn)
+			if readOnly {
+				tx.seq = nil
+			}
+			err := fn(tx)
+			if err != nil {
+				return err
+			}
+			return tx.err
+		})
+		if err == nil {
+			db.notify(tx.events)
 		}
 
-		entry := badger.NewEntry(key, value).WithDiscard()
-		return txn.SetEntry(entry)
-	})
-	return result, err
+		if errors.Is(err, badger.ErrConflict) {
+			// the watched keys were modified by another transaction
+			if len(watches) > 0 {
+				return sdk.ErrTxnAborted
+			}
+			continue
+		}
+		return err
+	}
 }
 
 // Persist implements sdk.Storage.
-func (db *DB) Persist(key []byte) (bool, error) {
+func (db *DB) Persist(key []byte) (ok bool, err error) {
 	if !db.running {
 		return false, sdk.ErrDatabaseUnavailable
 	}
 
-	err := db.db.Update(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
-		if err != nil {
-			return err
-		}
+	err = db.update(func(tx *Tx) error {
+		ok, err = tx.Persist(key)
+		return err
+	})
+	return ok, err
+}
 
-		return item.Value(func(val []byte) error {
-			entry := badger.NewEntry(item.Key(), val).
-				WithDiscard()
+// Scan implements sdk.Storage.
+func (db *DB) Scan(cursor []byte, opts sdk.ScanOptions) (kvs [][]byte, next []byte, err error) {
+	if !db.running {
+		return nil, nil, sdk.ErrDatabaseUnavailable
+	}
 
-			return txn.SetEntry(entry)
-		})
+	err = db.view(func(tx *Tx) error {
+		kvs, next, err = tx.Scan(cursor, opts)
+		return err
 	})
-
 	if err != nil {
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			return false, nil
-		}
-		return false, err
+		return nil, nil, err
 	}
-	return true, nil
+	return kvs, next, nil
 }
 
-// Scan implements sdk.Storage.
-func (db *DB) Scan(cursor []byte, opts sdk.ScanOptions) ([][]byte, error) {
+// Set implements sdk.Storage.
+func (db *DB) Set(key []byte, value []byte, opts sdk.SetOptions) (ok bool, old []byte, err error) {
 	if !db.running {
-		return nil, sdk.ErrDatabaseUnavailable
+		return false, nil, sdk.ErrDatabaseUnavailable
+	}
+	if db.raft != nil {
+		return db.raft.set(key, value, opts)
 	}
 
-	var kvs [][]byte
-
-	err := db.db.View(func(txn *badger.Txn) error {
-		iterOpts := badger.DefaultIteratorOptions
-		ScanOptionsWrapper(opts).apply(&iterOpts)
-
-		iter := txn.NewIterator(iterOpts)
-		defer iter.Close()
-
-		if len(cursor) == 0 {
-			iter.Rewind()
-		} else {
-			iter.Seek(cursor)
-		}
-
-		for ; iter.Valid(); iter.Next() {
-			item := iter.Item()
+	err = db.update(func(tx *Tx) error {
+		ok, old, err = tx.Set(key, value, opts)
+		return err
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	return ok, old, nil
+}
 
-			if iterOpts.PrefetchValues {
-				if item.ValueSize() == 0 {
-					continue
-				}
+// Transfer implements sdk.Storage.
+func (db *DB) Transfer(source, destination []byte, amount int64, sourceConstraints, destinationConstraints []sdk.Constraint[int64]) (sourceValue, destinationValue int64, err error) {
+	if !db.running {
+		return 0, 0, sdk.ErrDatabaseUnavailable
+	}
 
-				var val []byte = make([]byte, item.ValueSize())
+	err = db.update(func(tx *Tx) error {
+		sourceValue, destinationValue, err = tx.Transfer(source, destination, amount, sourceConstraints, destinationConstraints)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return sourceValue, destinationValue, nil
+}
 
-				_, err := item.ValueCopy(val)
-				if err != nil {
-					return err
-				}
+// CountKeysInSlot implements sdk.Storage.
+func (db *DB) CountKeysInSlot(slot int) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
 
-				kvs = append(kvs, item.KeyCopy(nil), val)
-			} else {
-				item.Key()
-				kvs = append(kvs, item.KeyCopy(nil))
-			}
-		}
-		return nil
+	err = db.view(func(tx *Tx) error {
+		count, err = tx.CountKeysInSlot(slot)
+		return err
 	})
-	return kvs, err
+	return count, err
 }
 
-// Set implements sdk.Storage.
-func (db *DB) Set(key []byte, value []byte) error {
+// SlotKeys implements sdk.Storage.
+func (db *DB) SlotKeys(slot int, cursor []byte, count int) (keys [][]byte, next []byte, err error) {
 	if !db.running {
-		return sdk.ErrDatabaseUnavailable
+		return nil, nil, sdk.ErrDatabaseUnavailable
 	}
 
-	err := db.db.Update(func(txn *badger.Txn) error {
-		entry := badger.NewEntry(key, value).
-			WithDiscard()
-
-		return txn.SetEntry(entry)
+	err = db.view(func(tx *Tx) error {
+		keys, next, err = tx.SlotKeys(slot, cursor, count)
+		return err
 	})
-	return err
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys, next, nil
 }
 
 // Ttl implements sdk.Storage.
@@ -410,32 +695,56 @@ func (db *DB) Ttl(key []byte) (ok bool, ttl int64, err error) {
 		return false, 0, sdk.ErrDatabaseUnavailable
 	}
 
-	var expireAt uint64
+	err = db.view(func(tx *Tx) error {
+		ok, ttl, err = tx.Ttl(key)
+		return err
+	})
+	return ok, ttl, err
+}
 
-	err = db.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(key)
-		if err != nil {
-			return err
-		}
+// Type implements sdk.Storage.
+func (db *DB) Type(key []byte) (reply string, err error) {
+	if !db.running {
+		return sdk.TYPE_NONE, sdk.ErrDatabaseUnavailable
+	}
 
-		expireAt = item.ExpiresAt()
-		return nil
+	err = db.view(func(tx *Tx) error {
+		reply, err = tx.Type(key)
+		return err
 	})
+	return reply, err
+}
 
-	if err != nil {
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			return false, sdk.NONE_TTL, nil
-		}
-		return false, sdk.NONE_TTL, err
+// Watch implements sdk.Storage.
+func (db *DB) Watch(keys ...[]byte) ([]sdk.WatchedKey, error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
 	}
 
-	if expireAt == 0 {
-		return true, sdk.UNSET_LEASE, nil
-	}
+	var watches = make([]sdk.WatchedKey, 0, len(keys))
+
+	err := db.view(func(tx *Tx) error {
+		for _, key := range keys {
+			var version uint64 = 0
+
+			item, err := tx.txn.Get(encodeKey(key))
+			if err != nil {
+				if !errors.Is(err, badger.ErrKeyNotFound) {
+					return err
+				}
+			} else {
+				version = item.Version()
+			}
 
-	var now uint64 = uint64(time.Now().Unix())
-	if now > expireAt {
-		return false, sdk.NONE_TTL, nil
+			watches = append(watches, sdk.WatchedKey{
+				Key:     append([]byte{}, key...),
+				Version: version,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return true, int64(expireAt - now), nil
+	return watches, nil
 }
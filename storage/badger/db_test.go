@@ -4,6 +4,7 @@ import (
 	"badgerlit/sdk"
 	"badgerlit/storage/badger"
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -13,7 +14,7 @@ import (
 func TestDB(t *testing.T) {
 	config := sdk.Config{
 		Engine:             "file",
-		DataPath:           "./.data/dump",
+		DataPath:           t.TempDir(),
 		KeyDiscardInterval: 5 * time.Second,
 		KeyDiscardRatio:    0.7,
 		LogFlagsToken:      strings.Split("default,msgprefix", ","),
@@ -26,7 +27,7 @@ func TestDB(t *testing.T) {
 
 	go func() {
 		db.Start(ctx)
-		err := db.Set([]byte("foo"), []byte("FOO"))
+		_, _, err := db.Set([]byte("foo"), []byte("FOO"), sdk.SetOptions{})
 		if err != nil {
 			fmt.Printf("%+v\n", err)
 		}
@@ -42,3 +43,413 @@ func TestDB(t *testing.T) {
 		db.Stop(context.Background())
 	}
 }
+
+func TestDB_SetOptions(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	// NX and XX
+	if ok, _, err := db.Set([]byte("a"), []byte("1"), sdk.SetOptions{IfExists: true}); err != nil || ok {
+		t.Errorf("expect XX to skip the missing key, but got %v, %v", ok, err)
+	}
+	if ok, _, err := db.Set([]byte("a"), []byte("1"), sdk.SetOptions{IfNotExists: true}); err != nil || !ok {
+		t.Errorf("expect NX to set the missing key, but got %v, %v", ok, err)
+	}
+	if ok, _, err := db.Set([]byte("a"), []byte("2"), sdk.SetOptions{IfNotExists: true}); err != nil || ok {
+		t.Errorf("expect NX to skip the existing key, but got %v, %v", ok, err)
+	}
+
+	// GET
+	ok, old, err := db.Set([]byte("a"), []byte("2"), sdk.SetOptions{IfExists: true, ReturnOld: true})
+	if err != nil || !ok || string(old) != "1" {
+		t.Errorf("expect the old value %q, but got %v, %q, %v", "1", ok, old, err)
+	}
+	if _, old, err := db.Set([]byte("b"), []byte("1"), sdk.SetOptions{ReturnOld: true}); err != nil || old != nil {
+		t.Errorf("expect no old value, but got %q, %v", old, err)
+	}
+
+	// EX and KEEPTTL
+	if _, _, err := db.Set([]byte("a"), []byte("3"), sdk.SetOptions{Lease: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Set([]byte("a"), []byte("4"), sdk.SetOptions{KeepTTL: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ttl, err := db.Ttl([]byte("a")); err != nil || ttl < 3590 {
+		t.Errorf("expect KEEPTTL to keep the ttl, but got %d, %v", ttl, err)
+	}
+	if _, _, err := db.Set([]byte("a"), []byte("5"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ttl, err := db.Ttl([]byte("a")); err != nil || ttl != -1 {
+		t.Errorf("expect the ttl to be cleared, but got %d, %v", ttl, err)
+	}
+
+	// EXAT
+	if _, _, err := db.Set([]byte("c"), []byte("1"), sdk.SetOptions{ExpireAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ttl, err := db.Ttl([]byte("c")); err != nil || ttl < 3590 {
+		t.Errorf("expect the ttl of EXAT, but got %d, %v", ttl, err)
+	}
+
+	// PX and PXAT: the sub-second leases are rounded up to the second, so
+	// that the keys never expire before the lease
+	if _, _, err := db.Set([]byte("d"), []byte("1"), sdk.SetOptions{Lease: 300 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Set([]byte("e"), []byte("1"), sdk.SetOptions{ExpireAt: time.Now().Add(300 * time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.Exists([]byte("d"), []byte("e")); err != nil || n != 2 {
+		t.Errorf("expect the keys not to expire before the lease, but got %d, %v", n, err)
+	}
+	time.Sleep(1300 * time.Millisecond)
+	if n, err := db.Exists([]byte("d"), []byte("e")); err != nil || n != 0 {
+		t.Errorf("expect the keys to expire, but got %d, %v", n, err)
+	}
+}
+
+func TestDB_MultiKey(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	err := db.MSet(
+		sdk.KeyValue{Key: []byte("a"), Value: []byte("1")},
+		sdk.KeyValue{Key: []byte("b"), Value: []byte("2")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := db.MGet([]byte("a"), []byte("x"), []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 3 || string(values[0]) != "1" || values[1] != nil || string(values[2]) != "2" {
+		t.Errorf("expect [1 nil 2], but got %q", values)
+	}
+
+	// MSetNX sets none of the keys if any of them exists
+	ok, err := db.MSetNX(
+		sdk.KeyValue{Key: []byte("b"), Value: []byte("3")},
+		sdk.KeyValue{Key: []byte("c"), Value: []byte("3")},
+	)
+	if err != nil || ok {
+		t.Errorf("expect MSetNX to fail, but got %v, %v", ok, err)
+	}
+	if n, err := db.Exists([]byte("c")); err != nil || n != 0 {
+		t.Errorf("expect c not to be set, but got %d, %v", n, err)
+	}
+	ok, err = db.MSetNX(
+		sdk.KeyValue{Key: []byte("c"), Value: []byte("3")},
+		sdk.KeyValue{Key: []byte("d"), Value: []byte("4")},
+	)
+	if err != nil || !ok {
+		t.Errorf("expect MSetNX to succeed, but got %v, %v", ok, err)
+	}
+
+	// the keys are counted as many times as they are given
+	if n, err := db.Exists([]byte("a"), []byte("a"), []byte("x"), []byte("d")); err != nil || n != 3 {
+		t.Errorf("expect 3, but got %d, %v", n, err)
+	}
+	if n, err := db.Del([]byte("a"), []byte("x"), []byte("c")); err != nil || n != 2 {
+		t.Errorf("expect 2 keys deleted, but got %d, %v", n, err)
+	}
+	if n, err := db.Exists([]byte("a"), []byte("b"), []byte("c"), []byte("d")); err != nil || n != 2 {
+		t.Errorf("expect 2, but got %d, %v", n, err)
+	}
+}
+
+func TestDB_Transfer(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	if _, _, err := db.Set([]byte("a"), []byte("10"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	source, destination, err := db.Transfer([]byte("a"), []byte("b"), 4, nil, nil)
+	if err != nil || source != 6 || destination != 4 {
+		t.Errorf("expect 6, 4, but got %d, %d, %v", source, destination, err)
+	}
+
+	// the violated constraint leaves both counters untouched
+	_, _, err = db.Transfer([]byte("a"), []byte("b"), 7,
+		[]sdk.Constraint[int64]{sdk.IntegerGreaterOrEqual(0)}, nil)
+	if !errors.Is(err, sdk.ErrViolateConstraints) {
+		t.Errorf("expect ErrViolateConstraints, but got %v", err)
+	}
+	_, _, err = db.Transfer([]byte("a"), []byte("b"), 1,
+		nil, []sdk.Constraint[int64]{sdk.IntegerLessOrEqual(4)})
+	if !errors.Is(err, sdk.ErrViolateConstraints) {
+		t.Errorf("expect ErrViolateConstraints, but got %v", err)
+	}
+	values, err := db.MGet([]byte("a"), []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(values[0]) != "6" || string(values[1]) != "4" {
+		t.Errorf("expect a = 6, b = 4, but got %q", values)
+	}
+
+	// non-integer values are rejected
+	if _, _, err := db.Set([]byte("c"), []byte("x"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Transfer([]byte("c"), []byte("a"), 1, nil, nil); !errors.Is(err, sdk.ErrNonInteger) {
+		t.Errorf("expect ErrNonInteger, but got %v", err)
+	}
+}
+
+func TestDB_Multi(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	err := db.Multi(nil, func(ops sdk.Operations) error {
+		if _, _, err := ops.Set([]byte("a"), []byte("1"), sdk.SetOptions{}); err != nil {
+			return err
+		}
+		// the writes are visible within the transaction
+		value, err := ops.Get([]byte("a"))
+		if err != nil {
+			return err
+		}
+		if string(value) != "1" {
+			t.Errorf("expect a = %q, but got %q", "1", value)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the transaction is aborted once the watched key is modified
+	watches, err := db.Watch([]byte("a"), []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Set([]byte("b"), []byte("1"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Multi(watches, func(ops sdk.Operations) error {
+		_, _, err := ops.Set([]byte("a"), []byte("2"), sdk.SetOptions{})
+		return err
+	})
+	if !errors.Is(err, sdk.ErrTxnAborted) {
+		t.Errorf("expect ErrTxnAborted, but got %v", err)
+	}
+	if value, err := db.Get([]byte("a")); err != nil || string(value) != "1" {
+		t.Errorf("expect a = %q, but got %q, %v", "1", value, err)
+	}
+
+	// the unmodified watched keys let the transaction commit
+	watches, err = db.Watch([]byte("a"), []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Multi(watches, func(ops sdk.Operations) error {
+		_, _, err := ops.Set([]byte("a"), []byte("3"), sdk.SetOptions{})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// replicas serve the read-only transactions, and reject the others
+	// even if the error of the write is ignored
+	if err := db.SetReadOnly(true); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Multi(nil, func(ops sdk.Operations) error {
+		value, err := ops.Get([]byte("a"))
+		if err != nil || string(value) != "3" {
+			t.Errorf("expect a = %q, but got %q, %v", "3", value, err)
+		}
+		return err
+	})
+	if err != nil {
+		t.Errorf("expect the read-only transaction to commit, but got %v", err)
+	}
+	for _, write := range []func(ops sdk.Operations){
+		func(ops sdk.Operations) { ops.Set([]byte("a"), []byte("4"), sdk.SetOptions{}) },
+		func(ops sdk.Operations) {
+			ops.HSet([]byte("h"), sdk.FieldValue{Field: []byte("f"), Value: []byte("v")})
+		},
+	} {
+		err = db.Multi(nil, func(ops sdk.Operations) error {
+			write(ops)
+			return nil
+		})
+		if !errors.Is(err, sdk.ErrReadOnly) {
+			t.Errorf("expect ErrReadOnly, but got %v", err)
+		}
+	}
+}
+
+func TestDB_Scan(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	for i := 0; i < 20; i++ {
+		if _, _, err := db.Set([]byte(fmt.Sprintf("a%02d", i)), []byte("1"), sdk.SetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.HSet([]byte("a99"), sdk.FieldValue{Field: []byte("f"), Value: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the limit bounds the keys examined, so the sparse matches take pages
+	var (
+		keys   [][]byte
+		cursor []byte
+		pages  = 0
+	)
+	for {
+		page, next, err := db.Scan(cursor, sdk.ScanOptions{Limit: 5, Type: sdk.TYPE_HASH})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) > 0 && next != nil {
+			t.Errorf("expect the match on the last page, but got %q", page)
+		}
+		keys = append(keys, page...)
+		pages++
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	if pages != 5 {
+		t.Errorf("expect 5 pages, but got %d", pages)
+	}
+	if len(keys) != 1 || string(keys[0]) != "a99" {
+		t.Errorf("expect [a99], but got %q", keys)
+	}
+
+	keys, next, err := db.Scan(nil, sdk.ScanOptions{Limit: 5, Match: []byte("a1*")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 5 || string(keys[0]) != "a10" || string(next) != "a15" {
+		t.Errorf("expect a10..a14 and the cursor a15, but got %q, %q", keys, next)
+	}
+}
+
+func TestDB_SlotKeys(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	// the keys of the slot are written by several data types, and some of
+	// them are deleted or expire
+	if _, _, err := db.Set([]byte("{tag}string"), []byte("1"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MSet(sdk.KeyValue{Key: []byte("{tag}mset"), Value: []byte("1")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.HSet([]byte("{tag}hash"), sdk.FieldValue{Field: []byte("f"), Value: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.LockAcquire([]byte("{tag}lock"), []byte("owner"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SAdd([]byte("{tag}deleted"), []byte("m")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SRem([]byte("{tag}deleted"), []byte("m")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Set([]byte("{tag}expired"), []byte("1"), sdk.SetOptions{Lease: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Set([]byte("{tag}persisted"), []byte("1"), sdk.SetOptions{Lease: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Persist([]byte("{tag}persisted")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, _, err := db.Set([]byte(fmt.Sprintf("other:%d", i)), []byte("1"), sdk.SetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(2 * time.Second)
+
+	var (
+		slot     = sdk.KeySlot([]byte("tag"))
+		expected = "{tag}hash,{tag}lock,{tag}mset,{tag}persisted,{tag}string"
+	)
+	count, err := db.CountKeysInSlot(slot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("expect 5 keys of the slot, but got %d", count)
+	}
+
+	// the keys are paged from the cursor
+	var (
+		keys   []string
+		cursor []byte
+	)
+	for {
+		page, next, err := db.SlotKeys(slot, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range page {
+			keys = append(keys, string(key))
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	if got := strings.Join(keys, ","); got != expected {
+		t.Errorf("expect %q, but got %q", expected, got)
+	}
+}
@@ -0,0 +1,202 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"encoding/binary"
+	"hash/crc32"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+)
+
+// The dump of a key is the version byte, the pb.KVList of the key and its
+// elements, and the crc32 checksum of both. The first KV holds the value of
+// the top-level key, and the others hold the elements keyed by their badger
+// keys without the data prefix, since the elements are restored with the id
+// of a new collection.
+const (
+	__DUMP_VERSION byte = 1
+)
+
+// DumpKey implements sdk.Storage.
+func (db *DB) DumpKey(key []byte) (payload []byte, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		item, err := tx.lookup(key, 0)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return sdk.ErrNil
+		}
+
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		list := &pb.KVList{
+			Kv: []*pb.KV{{
+				Value:    value,
+				UserMeta: []byte{item.UserMeta()},
+			}},
+		}
+
+		if hasMetadata(item.UserMeta()) {
+			m, err := decodeMetadata(value)
+			if err != nil {
+				return err
+			}
+
+			iterOpts := badger.DefaultIteratorOptions
+			iterOpts.Prefix = dataPrefix(key, m.id)
+
+			iter := tx.txn.NewIterator(iterOpts)
+			defer iter.Close()
+
+			for iter.Rewind(); iter.Valid(); iter.Next() {
+				element := iter.Item()
+
+				val, err := element.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				list.Kv = append(list.Kv, &pb.KV{
+					Key:       element.KeyCopy(nil)[len(iterOpts.Prefix):],
+					Value:     val,
+					UserMeta:  []byte{element.UserMeta()},
+					ExpiresAt: element.ExpiresAt(),
+				})
+			}
+		}
+
+		buf, err := list.Marshal()
+		if err != nil {
+			return err
+		}
+		payload = append([]byte{__DUMP_VERSION}, buf...)
+		payload = binary.BigEndian.AppendUint32(payload, crc32.ChecksumIEEE(payload))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// RestoreKey implements sdk.Storage.
+func (db *DB) RestoreKey(key []byte, payload []byte, ttl time.Duration, replace bool) error {
+	if !db.running {
+		return sdk.ErrDatabaseUnavailable
+	}
+
+	list, err := decodeDump(payload)
+	if err != nil {
+		return err
+	}
+
+	return db.update(func(tx *Tx) error {
+		item, err := tx.lookup(key, 0)
+		if err != nil {
+			return tx.check(err)
+		}
+		if item != nil && !replace {
+			return sdk.ErrBusyKey
+		}
+
+		var (
+			value = list.Kv[0].Value
+			meta  = list.Kv[0].UserMeta[0]
+			id    uint64
+		)
+
+		// NOTE: the elements are restored with the id of a new collection,
+		// and the elements of the replaced one are left to the sweep.
+		if hasMetadata(meta) {
+			m, err := decodeMetadata(value)
+			if err != nil {
+				return err
+			}
+			n, err := tx.newMetadata()
+			if err != nil {
+				return tx.check(err)
+			}
+			m.id, id = n.id, n.id
+			value = m.encode()
+		}
+
+		entry := badger.NewEntry(encodeKey(key), value).
+			WithMeta(meta).
+			WithDiscard()
+		if ttl > 0 {
+			entry.ExpiresAt = expiresAt(time.Now().Add(ttl))
+		}
+		err = tx.setKey(entry)
+		if err != nil {
+			return tx.check(err)
+		}
+
+		for _, kv := range list.Kv[1:] {
+			entry := badger.NewEntry(append(dataPrefix(key, id), kv.Key...), kv.Value).
+				WithMeta(kv.UserMeta[0]).
+				WithDiscard()
+			entry.ExpiresAt = kv.ExpiresAt
+
+			err = tx.txn.SetEntry(entry)
+			if err != nil {
+				return tx.check(err)
+			}
+
+			// the schedule of the delayed and in-flight messages is rebuilt,
+			// since it is keyed by the id of the queue
+			if meta == __TYPE_QUEUE && len(kv.Key) == 9 && kv.Key[0] == __QUEUE_MESSAGE {
+				msg, err := decodeMessage(kv.Value)
+				if err != nil {
+					return err
+				}
+				if msg.visibleAt > 0 {
+					entry := badger.NewEntry(scheduleKey(msg.visibleAt, key, id, decodeSequence(kv.Key[1:])), nil).
+						WithDiscard()
+					err = tx.txn.SetEntry(entry)
+					if err != nil {
+						return tx.check(err)
+					}
+				}
+			}
+		}
+		tx.emit("restore", key)
+		return nil
+	})
+}
+
+func decodeDump(payload []byte) (*pb.KVList, error) {
+	if len(payload) < 5 || payload[0] != __DUMP_VERSION {
+		return nil, sdk.ErrInvalidDump
+	}
+
+	var (
+		body     = payload[:len(payload)-4]
+		checksum = binary.BigEndian.Uint32(payload[len(payload)-4:])
+	)
+	if crc32.ChecksumIEEE(body) != checksum {
+		return nil, sdk.ErrInvalidDump
+	}
+
+	list := &pb.KVList{}
+	err := list.Unmarshal(body[1:])
+	if err != nil {
+		return nil, sdk.ErrInvalidDump
+	}
+	if len(list.Kv) == 0 {
+		return nil, sdk.ErrInvalidDump
+	}
+	for _, kv := range list.Kv {
+		if len(kv.UserMeta) != 1 {
+			return nil, sdk.ErrInvalidDump
+		}
+	}
+	return list, nil
+}
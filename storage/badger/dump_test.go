@@ -0,0 +1,107 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDB_DumpKey(t *testing.T) {
+	config := sdk.Config{
+		Engine:               "memory",
+		KeyDiscardInterval:   5 * time.Second,
+		KeyDiscardRatio:      0.7,
+		QueuePromoteInterval: 10 * time.Millisecond,
+	}
+
+	source := badger.New(&config)
+	source.Start(context.Background())
+	defer source.Stop(context.Background())
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	// move dumps the key of source and restores it on db
+	move := func(key string, ttl time.Duration) {
+		payload, err := source.DumpKey([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.RestoreKey([]byte(key), payload, ttl, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := source.Set([]byte("a"), []byte("1"), sdk.SetOptions{Lease: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.HSet([]byte("h"), sdk.FieldValue{Field: []byte("f"), Value: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.QPush([]byte("q"), 0, []byte("m1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.QPush([]byte("q"), 50*time.Millisecond, []byte("m2")); err != nil {
+		t.Fatal(err)
+	}
+	move("a", time.Hour)
+	move("h", 0)
+	move("q", 0)
+
+	value, err := db.Get([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "1" {
+		t.Errorf("expect a = %q, but got %q", "1", value)
+	}
+	if ok, ttl, err := db.Ttl([]byte("a")); err != nil || !ok || ttl <= 0 {
+		t.Errorf("expect a to expire, but got %v, %d, %v", ok, ttl, err)
+	}
+	value, err = db.HGet([]byte("h"), []byte("f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "v" {
+		t.Errorf("expect h.f = %q, but got %q", "v", value)
+	}
+
+	// the delayed message becomes visible on its schedule
+	messages, err := db.QReceive([]byte("q"), sdk.QReceiveOptions{Count: 2, Visibility: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || string(messages[0].Body) != "m1" {
+		t.Fatalf("expect m1, but got %v", messages)
+	}
+	time.Sleep(100 * time.Millisecond)
+	messages, err = db.QReceive([]byte("q"), sdk.QReceiveOptions{Count: 2, Visibility: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || string(messages[0].Body) != "m2" {
+		t.Fatalf("expect m2, but got %v", messages)
+	}
+
+	payload, err := source.DumpKey([]byte("h"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RestoreKey([]byte("h"), payload, 0, false); !errors.Is(err, sdk.ErrBusyKey) {
+		t.Errorf("expect ErrBusyKey, but got %v", err)
+	}
+	if err := db.RestoreKey([]byte("h"), payload, 0, true); err != nil {
+		t.Error(err)
+	}
+	payload[len(payload)-1] ^= 0xff
+	if err := db.RestoreKey([]byte("x"), payload, 0, false); !errors.Is(err, sdk.ErrInvalidDump) {
+		t.Errorf("expect ErrInvalidDump, but got %v", err)
+	}
+	if _, err := source.DumpKey([]byte("x")); !errors.Is(err, sdk.ErrNil) {
+		t.Errorf("expect ErrNil, but got %v", err)
+	}
+}
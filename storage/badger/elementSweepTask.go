@@ -0,0 +1,173 @@
+package badger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// ElementSweepTask deletes the elements of collections which had been
+// deleted, overwritten or expired.
+type ElementSweepTask struct {
+	BadgerDB *badger.DB
+
+	SweepInterval time.Duration
+
+	// Paused reports whether the task is skipped, e.g. while the database
+	// is a read-only replica.
+	Paused func() bool
+	Logger badger.Logger
+
+	mutex       sync.Mutex
+	done        chan struct{}
+	stopped     chan struct{}
+	initialized bool
+	running     bool
+	disposed    bool
+}
+
+func (task *ElementSweepTask) init() {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if task.initialized {
+		return
+	}
+
+	task.done = make(chan struct{})
+	task.stopped = make(chan struct{})
+	task.initialized = true
+}
+
+func (task *ElementSweepTask) run() {
+	if !task.initialized {
+		panic(fmt.Sprintf("%T don't be initialized yet", task))
+	}
+
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if task.running || task.disposed {
+		return
+	}
+	task.running = true
+
+	ticker := time.NewTicker(task.SweepInterval)
+
+	go func() {
+		defer close(task.stopped)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-task.done:
+				return
+			case <-ticker.C:
+				if task.Paused != nil && task.Paused() {
+					continue
+				}
+				count, err := task.sweep()
+				if err != nil {
+					task.Logger.Errorf("sweep elements: %v", err)
+				} else if count > 0 {
+					task.Logger.Infof("Swept %d elements", count)
+				}
+			}
+		}
+	}()
+}
+
+// stop stops the task, and waits until the sweep being run is done,
+// since badger fails or panics once it is closed.
+func (task *ElementSweepTask) stop() {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if !task.disposed {
+		task.disposed = true
+		close(task.done)
+		if task.running {
+			<-task.stopped
+		}
+	}
+}
+
+func (task *ElementSweepTask) sweep() (int, error) {
+	var count int = 0
+
+	wb := task.BadgerDB.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := task.BadgerDB.View(func(txn *badger.Txn) error {
+		iterOpts := badger.DefaultIteratorOptions
+		iterOpts.PrefetchValues = false
+		iterOpts.Prefix = []byte{__NAMESPACE_DATA}
+
+		iter := txn.NewIterator(iterOpts)
+		defer iter.Close()
+
+		var prefix []byte
+		for iter.Rewind(); iter.Valid(); {
+			k := iter.Item().Key()
+
+			if prefix == nil || !bytes.HasPrefix(k, prefix) {
+				key, id, _, ok := decodeDataKey(k)
+				if !ok {
+					iter.Next()
+					continue
+				}
+				prefix = dataPrefix(key, id)
+
+				alive, err := task.alive(txn, key, id)
+				if err != nil {
+					return err
+				}
+				if alive {
+					// skip the elements of the collection
+					iter.Seek(prefixUpperBound(prefix))
+					continue
+				}
+			}
+
+			err := wb.Delete(iter.Item().KeyCopy(nil))
+			if err != nil {
+				return err
+			}
+			count++
+			iter.Next()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, wb.Flush()
+}
+
+// alive reports whether the collection at key with the id still exists.
+func (task *ElementSweepTask) alive(txn *badger.Txn, key []byte, id uint64) (bool, error) {
+	item, err := txn.Get(encodeKey(key))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !hasMetadata(item.UserMeta()) {
+		return false, nil
+	}
+
+	var m metadata
+	err = item.Value(func(val []byte) error {
+		m, err = decodeMetadata(val)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return m.id == id, nil
+}
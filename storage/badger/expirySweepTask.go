@@ -0,0 +1,238 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	__EXPIRY_SWEEP_BATCH = 1000
+	// __EXPIRY_SWEEP_SCAN is the number of the top-level keys examined per
+	// tick. The scan is resumed from where it stopped on the next tick.
+	__EXPIRY_SWEEP_SCAN = 10000
+)
+
+// ExpirySweepTask deletes the expired top-level keys and notifies of them.
+// Badger hides the expired entries when they are read but never tells when
+// they expire, so the keys are found by scanning all versions, which still
+// include the expired entries. The expired keys are deleted, so that they
+// are notified only once.
+type ExpirySweepTask struct {
+	BadgerDB *badger.DB
+
+	SweepInterval time.Duration
+
+	Notify func(events []sdk.KeyEvent)
+	// Paused reports whether the task is skipped, e.g. while the database
+	// is a read-only replica.
+	Paused func() bool
+	Logger badger.Logger
+
+	// cursor is the key which the next scan starts from, and is accessed
+	// by the goroutine of the task only.
+	cursor []byte
+
+	mutex       sync.Mutex
+	done        chan struct{}
+	stopped     chan struct{}
+	initialized bool
+	running     bool
+	disposed    bool
+}
+
+func (task *ExpirySweepTask) init() {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if task.initialized {
+		return
+	}
+
+	task.done = make(chan struct{})
+	task.stopped = make(chan struct{})
+	task.initialized = true
+}
+
+func (task *ExpirySweepTask) run() {
+	if !task.initialized {
+		panic(fmt.Sprintf("%T don't be initialized yet", task))
+	}
+
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if task.running || task.disposed {
+		return
+	}
+	task.running = true
+
+	ticker := time.NewTicker(task.SweepInterval)
+
+	go func() {
+		defer close(task.stopped)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-task.done:
+				return
+			case <-ticker.C:
+				if task.Paused != nil && task.Paused() {
+					continue
+				}
+				err := task.sweep()
+				if err != nil {
+					task.Logger.Errorf("sweep expired keys: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (task *ExpirySweepTask) stop() {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if !task.disposed {
+		task.disposed = true
+		close(task.done)
+		if task.running {
+			<-task.stopped
+		}
+	}
+}
+
+func (task *ExpirySweepTask) sweep() error {
+	keys, next, err := task.scan(uint64(time.Now().Unix()), task.cursor)
+	if err != nil {
+		return err
+	}
+	task.cursor = next
+
+	for len(keys) > 0 {
+		var batch [][]byte
+		if len(keys) > __EXPIRY_SWEEP_BATCH {
+			batch, keys = keys[:__EXPIRY_SWEEP_BATCH], keys[__EXPIRY_SWEEP_BATCH:]
+		} else {
+			batch, keys = keys, nil
+		}
+
+		events, err := task.delete(batch)
+		if err != nil {
+			// NOTE: the next scan starts from the failed batch instead, so
+			// that its keys and the ones after are found again.
+			task.cursor = batch[0]
+			if errors.Is(err, badger.ErrConflict) {
+				return nil
+			}
+			return err
+		}
+		task.Notify(events)
+	}
+	return nil
+}
+
+// scan returns the badger keys whose latest versions had expired at now,
+// among up to __EXPIRY_SWEEP_SCAN keys starting from cursor. It returns the
+// key to resume from, or nil if the end is reached.
+func (task *ExpirySweepTask) scan(now uint64, cursor []byte) (keys [][]byte, next []byte, err error) {
+	err = task.BadgerDB.View(func(txn *badger.Txn) error {
+		iterOpts := badger.DefaultIteratorOptions
+		iterOpts.PrefetchValues = false
+		iterOpts.AllVersions = true
+		iterOpts.Prefix = []byte{__NAMESPACE_KEY}
+
+		iter := txn.NewIterator(iterOpts)
+		defer iter.Close()
+
+		var (
+			last  []byte
+			count int = 0
+		)
+		if cursor == nil {
+			iter.Rewind()
+		} else {
+			iter.Seek(cursor)
+		}
+		for ; iter.Valid(); iter.Next() {
+			item := iter.Item()
+
+			// NOTE: the versions of a key are iterated from the latest one
+			if last != nil && string(item.Key()) == string(last) {
+				continue
+			}
+			if count >= __EXPIRY_SWEEP_SCAN {
+				next = item.KeyCopy(nil)
+				return nil
+			}
+			last = item.KeyCopy(last[:0])
+			count++
+
+			if expired(item, now) {
+				keys = append(keys, item.KeyCopy(nil))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys, next, nil
+}
+
+// delete deletes the keys which are still expired, and returns the events
+// of them.
+func (task *ExpirySweepTask) delete(keys [][]byte) ([]sdk.KeyEvent, error) {
+	var events []sdk.KeyEvent
+
+	err := task.BadgerDB.Update(func(txn *badger.Txn) error {
+		events = events[:0]
+
+		var (
+			now      = uint64(time.Now().Unix())
+			iterOpts = badger.IteratorOptions{AllVersions: true}
+		)
+		iter := txn.NewIterator(iterOpts)
+		defer iter.Close()
+
+		for _, k := range keys {
+			// NOTE: the key is skipped unless its latest version is the
+			// expired one, e.g. if it had been deleted or written again.
+			iter.Seek(k)
+			if !iter.Valid() || !bytes.Equal(iter.Item().Key(), k) || !expired(iter.Item(), now) {
+				continue
+			}
+
+			err := txn.Delete(k)
+			if err != nil {
+				return err
+			}
+			err = txn.Delete(slotKey(decodeKey(k)))
+			if err != nil {
+				return err
+			}
+			events = append(events, sdk.KeyEvent{
+				Event: "expired",
+				Key:   decodeKey(k),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// expired reports whether the version of item had expired at now. The
+// tombstones of the deleted keys never expire.
+func expired(item *badger.Item, now uint64) bool {
+	expiresAt := item.ExpiresAt()
+	return expiresAt > 0 && expiresAt <= now
+}
@@ -0,0 +1,65 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDB_Listen_Expired(t *testing.T) {
+	config := sdk.Config{
+		Engine:               "memory",
+		KeyDiscardInterval:   5 * time.Second,
+		KeyDiscardRatio:      0.7,
+		NotifyKeyspaceEvents: "Ex",
+		ExpirySweepInterval:  50 * time.Millisecond,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	var (
+		mutex  sync.Mutex
+		events []string
+	)
+	db.Listen(func(event sdk.KeyEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		events = append(events, event.Event+" "+string(event.Key))
+	})
+
+	if _, _, err := db.Set([]byte("session"), []byte("1"), sdk.SetOptions{Lease: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Set([]byte("forever"), []byte("1"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// the key deleted before its expiry never expires
+	if _, _, err := db.Set([]byte("deleted"), []byte("1"), sdk.SetOptions{Lease: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Del([]byte("deleted")); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2500 * time.Millisecond)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var expected = []string{"set session", "expire session", "set forever", "set deleted", "expire deleted", "del deleted", "expired session"}
+	if len(events) != len(expected) {
+		t.Fatalf("expect events %q, but got %q", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("expect events %q, but got %q", expected, events)
+			break
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"errors"
+	"strconv"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// HDel implements sdk.Operations.
+func (tx *Tx) HDel(key []byte, fields ...[]byte) (int64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_HASH)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		return 0, nil
+	}
+
+	var count int64 = 0
+	for _, field := range fields {
+		k := dataKey(key, m.id, field)
+
+		_, err := tx.txn.Get(k)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			}
+			return 0, tx.check(err)
+		}
+
+		err = tx.txn.Delete(k)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		count++
+	}
+
+	m.length -= count
+	err = tx.setMetadata(key, __TYPE_HASH, m, item)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	if count > 0 {
+		tx.emit("hdel", key)
+		if m.length <= 0 {
+			tx.emit("del", key)
+		}
+	}
+	return count, nil
+}
+
+// HExists implements sdk.Operations.
+func (tx *Tx) HExists(key []byte, field []byte) (bool, error) {
+	_, err := tx.HGet(key, field)
+	if err != nil {
+		if errors.Is(err, sdk.ErrNil) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// HGet implements sdk.Operations.
+func (tx *Tx) HGet(key []byte, field []byte) ([]byte, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_HASH)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	if item == nil {
+		return nil, sdk.ErrNil
+	}
+
+	item, err = tx.txn.Get(dataKey(key, m.id, field))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, sdk.ErrNil
+		}
+		return nil, tx.check(err)
+	}
+
+	reply, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	return reply, nil
+}
+
+// HGetAll implements sdk.Operations.
+func (tx *Tx) HGetAll(key []byte) ([]sdk.FieldValue, error) {
+	fvs, _, err := tx.HScan(key, nil, sdk.ScanOptions{})
+	return fvs, err
+}
+
+// HIncrBy implements sdk.Operations.
+func (tx *Tx) HIncrBy(key []byte, field []byte, increment int64, constraints ...sdk.Constraint[int64]) (int64, error) {
+	var result int64 = 0
+
+	err := tx.updateField(key, field, func(val []byte) ([]byte, error) {
+		var number int64 = 0
+
+		if val != nil {
+			n, err := strconv.ParseInt(string(val), 10, 64)
+			if err != nil {
+				return nil, sdk.ErrNonInteger
+			}
+			number = n
+		}
+
+		// add increment & export
+		result = number + increment
+
+		// check
+		for _, constraint := range constraints {
+			ok := constraint.Check(result)
+			if !ok {
+				return nil, sdk.ErrViolateConstraints
+			}
+		}
+
+		// export
+		return []byte(strconv.FormatInt(result, 10)), nil
+	})
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	tx.emit("hincrby", key)
+	return result, nil
+}
+
+// HIncrByFloat implements sdk.Operations.
+func (tx *Tx) HIncrByFloat(key []byte, field []byte, increment float64, constraints ...sdk.Constraint[float64]) (float64, error) {
+	var result float64 = 0
+
+	err := tx.updateField(key, field, func(val []byte) ([]byte, error) {
+		var number float64 = 0
+
+		if val != nil {
+			n, err := strconv.ParseFloat(string(val), 64)
+			if err != nil {
+				return nil, sdk.ErrNonInteger
+			}
+			number = n
+		}
+
+		// add increment & export
+		result = number + increment
+
+		// check
+		for _, constraint := range constraints {
+			ok := constraint.Check(result)
+			if !ok {
+				return nil, sdk.ErrViolateConstraints
+			}
+		}
+
+		// export
+		return []byte(strconv.FormatFloat(result, 'f', 4, 64)), nil
+	})
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	tx.emit("hincrbyfloat", key)
+	return result, nil
+}
+
+// HLen implements sdk.Operations.
+func (tx *Tx) HLen(key []byte) (int64, error) {
+	_, m, err := tx.lookupMetadata(key, __TYPE_HASH)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	return m.length, nil
+}
+
+// HScan implements sdk.Operations.
+func (tx *Tx) HScan(key []byte, cursor []byte, opts sdk.ScanOptions) (fvs []sdk.FieldValue, next []byte, err error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_HASH)
+	if err != nil {
+		return nil, nil, tx.check(err)
+	}
+	if item == nil {
+		return nil, nil, nil
+	}
+
+	opts.PrefetchValues = true
+	next, err = tx.scanElements(dataPrefix(key, m.id), cursor, opts, func(field []byte, item *badger.Item) error {
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		fvs = append(fvs, sdk.FieldValue{
+			Field: field,
+			Value: value,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, tx.check(err)
+	}
+	return fvs, next, nil
+}
+
+// HSet implements sdk.Operations.
+func (tx *Tx) HSet(key []byte, fvs ...sdk.FieldValue) (int64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_HASH)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		m, err = tx.newMetadata()
+		if err != nil {
+			return 0, tx.check(err)
+		}
+	}
+
+	var count int64 = 0
+	for _, fv := range fvs {
+		k := dataKey(key, m.id, fv.Field)
+
+		_, err := tx.txn.Get(k)
+		if err != nil {
+			if !errors.Is(err, badger.ErrKeyNotFound) {
+				return 0, tx.check(err)
+			}
+			count++
+		}
+
+		entry := badger.NewEntry(k, fv.Value).
+			WithDiscard()
+
+		err = tx.txn.SetEntry(entry)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+	}
+
+	m.length += count
+	err = tx.setMetadata(key, __TYPE_HASH, m, item)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	if len(fvs) > 0 {
+		tx.emit("hset", key)
+	}
+	return count, nil
+}
+
+// updateField replaces the value of the hash field with the value returned
+// by fn. The val passed to fn is nil if the field does not exist.
+func (tx *Tx) updateField(key []byte, field []byte, fn func(val []byte) ([]byte, error)) error {
+	item, m, err := tx.lookupMetadata(key, __TYPE_HASH)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		m, err = tx.newMetadata()
+		if err != nil {
+			return err
+		}
+	}
+
+	var (
+		k   = dataKey(key, m.id, field)
+		val []byte
+	)
+
+	fieldItem, err := tx.txn.Get(k)
+	if err != nil {
+		if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+		m.length++
+	} else {
+		val, err = fieldItem.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			val = []byte{}
+		}
+	}
+
+	value, err := fn(val)
+	if err != nil {
+		return err
+	}
+
+	entry := badger.NewEntry(k, value).
+		WithDiscard()
+
+	err = tx.txn.SetEntry(entry)
+	if err != nil {
+		return err
+	}
+	return tx.setMetadata(key, __TYPE_HASH, m, item)
+}
+
+// HDel implements sdk.Storage.
+func (db *DB) HDel(key []byte, fields ...[]byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		count, err = tx.HDel(key, fields...)
+		return err
+	})
+	return count, err
+}
+
+// HExists implements sdk.Storage.
+func (db *DB) HExists(key []byte, field []byte) (ok bool, err error) {
+	if !db.running {
+		return false, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		ok, err = tx.HExists(key, field)
+		return err
+	})
+	return ok, err
+}
+
+// HGet implements sdk.Storage.
+func (db *DB) HGet(key []byte, field []byte) (reply []byte, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		reply, err = tx.HGet(key, field)
+		return err
+	})
+	return reply, err
+}
+
+// HGetAll implements sdk.Storage.
+func (db *DB) HGetAll(key []byte) (fvs []sdk.FieldValue, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		fvs, err = tx.HGetAll(key)
+		return err
+	})
+	return fvs, err
+}
+
+// HIncrBy implements sdk.Storage.
+func (db *DB) HIncrBy(key []byte, field []byte, increment int64, constraints ...sdk.Constraint[int64]) (result int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		result, err = tx.HIncrBy(key, field, increment, constraints...)
+		return err
+	})
+	return result, err
+}
+
+// HIncrByFloat implements sdk.Storage.
+func (db *DB) HIncrByFloat(key []byte, field []byte, increment float64, constraints ...sdk.Constraint[float64]) (result float64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		result, err = tx.HIncrByFloat(key, field, increment, constraints...)
+		return err
+	})
+	return result, err
+}
+
+// HLen implements sdk.Storage.
+func (db *DB) HLen(key []byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		count, err = tx.HLen(key)
+		return err
+	})
+	return count, err
+}
+
+// HScan implements sdk.Storage.
+func (db *DB) HScan(key []byte, cursor []byte, opts sdk.ScanOptions) (fvs []sdk.FieldValue, next []byte, err error) {
+	if !db.running {
+		return nil, nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		fvs, next, err = tx.HScan(key, cursor, opts)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return fvs, next, nil
+}
+
+// HSet implements sdk.Storage.
+func (db *DB) HSet(key []byte, fvs ...sdk.FieldValue) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		count, err = tx.HSet(key, fvs...)
+		return err
+	})
+	return count, err
+}
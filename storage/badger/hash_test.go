@@ -0,0 +1,195 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDB_Hash(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	var h = []byte("hash:h")
+
+	count, err := db.HSet(h,
+		sdk.FieldValue{Field: []byte("a"), Value: []byte("1")},
+		sdk.FieldValue{Field: []byte("b"), Value: []byte("2")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expect 2 fields added, but got %d", count)
+	}
+
+	// the existing field is replaced, but not counted
+	count, err = db.HSet(h,
+		sdk.FieldValue{Field: []byte("b"), Value: []byte("3")},
+		sdk.FieldValue{Field: []byte("c"), Value: []byte("4")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expect 1 field added, but got %d", count)
+	}
+	value, err := db.HGet(h, []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "3" {
+		t.Errorf("expect b = %q, but got %q", "3", value)
+	}
+	if _, err := db.HGet(h, []byte("x")); !errors.Is(err, sdk.ErrNil) {
+		t.Errorf("expect ErrNil, but got %v", err)
+	}
+	if length, err := db.HLen(h); err != nil || length != 3 {
+		t.Errorf("expect 3 fields, but got %d, %v", length, err)
+	}
+
+	// HIncrBy
+	n, err := db.HIncrBy(h, []byte("a"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 11 {
+		t.Errorf("expect a = 11, but got %d", n)
+	}
+	n, err = db.HIncrBy(h, []byte("n"), -2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != -2 {
+		t.Errorf("expect n = -2, but got %d", n)
+	}
+	if _, err := db.HIncrBy(h, []byte("a"), 10, sdk.IntegerLessOrEqual(20)); !errors.Is(err, sdk.ErrViolateConstraints) {
+		t.Errorf("expect ErrViolateConstraints, but got %v", err)
+	}
+	if _, err := db.HSet(h, sdk.FieldValue{Field: []byte("s"), Value: []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.HIncrBy(h, []byte("s"), 1); !errors.Is(err, sdk.ErrNonInteger) {
+		t.Errorf("expect ErrNonInteger, but got %v", err)
+	}
+
+	// HGetAll returns the fields in order
+	fvs, err := db.HGetAll(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"a", "11", "b", "3", "c", "4", "n", "-2", "s", "x"}
+	if len(fvs) != len(expected)/2 {
+		t.Fatalf("expect %d fields, but got %d", len(expected)/2, len(fvs))
+	}
+	for i, fv := range fvs {
+		if string(fv.Field) != expected[2*i] || string(fv.Value) != expected[2*i+1] {
+			t.Errorf("expect %s = %q, but got %s = %q", expected[2*i], expected[2*i+1], fv.Field, fv.Value)
+		}
+	}
+
+	// HScan pages through the fields
+	var (
+		fields []string
+		cursor []byte
+	)
+	for {
+		fvs, next, err := db.HScan(h, cursor, sdk.ScanOptions{Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fvs) > 2 {
+			t.Errorf("expect at most 2 fields, but got %d", len(fvs))
+		}
+		for _, fv := range fvs {
+			fields = append(fields, string(fv.Field))
+		}
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	if len(fields) != 5 || fields[0] != "a" || fields[4] != "s" {
+		t.Errorf("expect [a b c n s], but got %v", fields)
+	}
+	fvs, _, err = db.HScan(h, nil, sdk.ScanOptions{Match: []byte("[bc]")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fvs) != 2 || string(fvs[0].Field) != "b" || string(fvs[1].Field) != "c" {
+		t.Errorf("expect [b c], but got %v", fvs)
+	}
+
+	// the limit bounds the fields examined, so the sparse matches take pages
+	sparse := []byte("sparse")
+	for i := 0; i < 20; i++ {
+		if _, err := db.HSet(sparse, sdk.FieldValue{Field: []byte(fmt.Sprintf("f%02d", i)), Value: []byte("v")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.HSet(sparse, sdk.FieldValue{Field: []byte("x"), Value: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	var pages = 0
+	fields, cursor = nil, nil
+	for {
+		fvs, next, err := db.HScan(sparse, cursor, sdk.ScanOptions{Limit: 5, Match: []byte("x*")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fvs) > 0 && next != nil {
+			t.Errorf("expect the match on the last page, but got %v", fvs)
+		}
+		for _, fv := range fvs {
+			fields = append(fields, string(fv.Field))
+		}
+		pages++
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	if pages != 5 {
+		t.Errorf("expect 5 pages, but got %d", pages)
+	}
+	if len(fields) != 1 || fields[0] != "x" {
+		t.Errorf("expect [x], but got %v", fields)
+	}
+
+	// HDel removes the key with its last field
+	count, err = db.HDel(h, []byte("a"), []byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expect 1 field deleted, but got %d", count)
+	}
+	if ok, err := db.HExists(h, []byte("a")); err != nil || ok {
+		t.Errorf("expect a to be deleted, but got %v, %v", ok, err)
+	}
+	if _, err := db.HDel(h, []byte("b"), []byte("c"), []byte("n"), []byte("s")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.Exists(h); err != nil || n != 0 {
+		t.Errorf("expect the hash to be deleted, but got %d, %v", n, err)
+	}
+
+	// a string is not a hash
+	if _, _, err := db.Set(h, []byte("v"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.HGet(h, []byte("a")); !errors.Is(err, sdk.ErrWrongType) {
+		t.Errorf("expect ErrWrongType, but got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package badger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	__HISTORY_CLOCK_INTERVAL = time.Second
+)
+
+// HistoryTask retains the versions of the keys for a while, so that the
+// captures and the replicas are able to resume from a version without
+// missing the versions in between. Badger discards the versions which are
+// overwritten or deleted once no transaction reads them, so the task keeps
+// a read-only transaction open, which is renewed every Retention. The older
+// versions are discarded once the transaction is renewed, and the versions
+// since the renewal of the previous one are retained, i.e. for at least
+// Retention.
+//
+// The task also records the version read every __HISTORY_CLOCK_INTERVAL,
+// which maps the times to the versions, since the versions of badger carry
+// no time. Nothing is retained across restarts.
+type HistoryTask struct {
+	BadgerDB *badger.DB
+
+	Retention time.Duration
+
+	Logger badger.Logger
+
+	// NOTE: pinned keeps the previous and the current read-only
+	// transactions, and clock keeps the versions read since the previous
+	// one, in order.
+	historyMutex sync.Mutex
+	pinned       []*badger.Txn
+	pinnedAt     time.Time
+	clock        []historyCheckpoint
+
+	mutex       sync.Mutex
+	done        chan struct{}
+	stopped     chan struct{}
+	initialized bool
+	running     bool
+	disposed    bool
+}
+
+type historyCheckpoint struct {
+	at      time.Time
+	version uint64
+}
+
+func (task *HistoryTask) init() {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if task.initialized {
+		return
+	}
+
+	task.done = make(chan struct{})
+	task.stopped = make(chan struct{})
+	task.initialized = true
+
+	task.tick(time.Now())
+}
+
+func (task *HistoryTask) run() {
+	if !task.initialized {
+		panic(fmt.Sprintf("%T don't be initialized yet", task))
+	}
+
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if task.running || task.disposed {
+		return
+	}
+	task.running = true
+
+	ticker := time.NewTicker(__HISTORY_CLOCK_INTERVAL)
+
+	go func() {
+		defer close(task.stopped)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-task.done:
+				return
+			case now := <-ticker.C:
+				task.tick(now)
+			}
+		}
+	}()
+}
+
+func (task *HistoryTask) stop() {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if !task.disposed {
+		task.disposed = true
+		close(task.done)
+		if task.running {
+			<-task.stopped
+		}
+
+		task.historyMutex.Lock()
+		defer task.historyMutex.Unlock()
+
+		for _, txn := range task.pinned {
+			txn.Discard()
+		}
+		task.pinned = nil
+	}
+}
+
+// tick records the version read at now, and renews the pinned transaction
+// once it is older than Retention.
+func (task *HistoryTask) tick(now time.Time) {
+	txn := task.BadgerDB.NewTransaction(false)
+
+	task.historyMutex.Lock()
+	defer task.historyMutex.Unlock()
+
+	task.clock = append(task.clock, historyCheckpoint{
+		at:      now,
+		version: txn.ReadTs(),
+	})
+
+	if len(task.pinned) > 0 && now.Sub(task.pinnedAt) < task.Retention {
+		txn.Discard()
+		return
+	}
+
+	task.pinned = append(task.pinned, txn)
+	task.pinnedAt = now
+	if len(task.pinned) > 2 {
+		task.pinned[0].Discard()
+		task.pinned = task.pinned[1:]
+	}
+
+	// the versions before the previous transaction are no longer retained
+	var floor = task.pinned[0].ReadTs()
+	for len(task.clock) > 1 && task.clock[0].version < floor {
+		task.clock = task.clock[1:]
+	}
+}
+
+// retained returns the version after which all versions are retained.
+func (task *HistoryTask) retained() uint64 {
+	task.historyMutex.Lock()
+	defer task.historyMutex.Unlock()
+
+	// NOTE: badger discards the versions before the oldest read timestamp
+	// only, so the versions from the read timestamp on are retained.
+	var floor = task.pinned[0].ReadTs()
+	if floor > 0 {
+		floor--
+	}
+	return floor
+}
+
+// versionAt returns the version read at or before t, after which all
+// changes committed after t are. It returns ok = false if t is older than
+// the retained versions.
+func (task *HistoryTask) versionAt(t time.Time) (version uint64, ok bool) {
+	task.historyMutex.Lock()
+	defer task.historyMutex.Unlock()
+
+	for _, checkpoint := range task.clock {
+		if checkpoint.at.After(t) {
+			break
+		}
+		version, ok = checkpoint.version, true
+	}
+	return version, ok
+}
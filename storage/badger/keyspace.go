@@ -0,0 +1,304 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// The badger keys are grouped into namespaces by their first byte.
+const (
+	__NAMESPACE_SYSTEM   byte = 0x00 // system keys, e.g. the format version
+	__NAMESPACE_KEY      byte = 'k'  // top-level keys
+	__NAMESPACE_DATA     byte = 'd'  // elements of collections, e.g. hash fields
+	__NAMESPACE_SCHEDULE byte = 't'  // time-keyed index of queue messages
+	__NAMESPACE_FENCE    byte = 'f'  // last fencing tokens of locks
+	__NAMESPACE_SLOT     byte = 's'  // top-level keys by hash slot
+)
+
+const (
+	__METADATA_SIZE      = 32
+	__SEQUENCE_BANDWIDTH = 1000
+)
+
+var (
+	__SEQUENCE_KEY = []byte{__NAMESPACE_SYSTEM, 's', 'e', 'q'}
+	__CAPTURE_KEY  = []byte{__NAMESPACE_SYSTEM, 'c', 'd', 'c'}
+
+	errInvalidMetadata = errors.New("invalid metadata")
+)
+
+// The data types are kept in the UserMeta byte of top-level keys.
+const (
+	__TYPE_STRING  byte = 1
+	__TYPE_HASH    byte = 2
+	__TYPE_LIST    byte = 3
+	__TYPE_SET     byte = 4
+	__TYPE_ZSET    byte = 5
+	__TYPE_TTLSET  byte = 6
+	__TYPE_LIMITER byte = 7
+	__TYPE_LOCK    byte = 8
+	__TYPE_QUEUE   byte = 9
+)
+
+// The elements of sorted sets are kept in two index spaces and a count
+// index, which are told apart by the first byte of the element.
+const (
+	__ZSET_MEMBER byte = 'm' // member → score
+	__ZSET_SCORE  byte = 's' // score + member → nothing, ordered by score
+	__ZSET_COUNT  byte = 'c' // length + score prefix → number of members
+)
+
+// The elements of queues are kept in two index spaces as well.
+const (
+	__QUEUE_MESSAGE byte = 'm' // message id → message
+	__QUEUE_READY   byte = 'r' // message id → nothing, visible messages in order
+)
+
+// metadata is the value of top-level keys which hold collections. The
+// elements are stored in the data namespace one badger key each, and are
+// identified by the key and the id of the collection. A new id is assigned
+// whenever the collection is created, so the elements which remain after
+// the collection was deleted or expired are never visible again.
+type metadata struct {
+	id     uint64 // id of the collection
+	length int64  // number of elements, which is not kept for ttl sets
+	head   int64  // sequence number of the first element of lists
+	tail   int64  // sequence number next to the last element of lists
+}
+
+func decodeMetadata(buf []byte) (metadata, error) {
+	if len(buf) != __METADATA_SIZE {
+		return metadata{}, errInvalidMetadata
+	}
+	return metadata{
+		id:     binary.BigEndian.Uint64(buf[0:]),
+		length: int64(binary.BigEndian.Uint64(buf[8:])),
+		head:   int64(binary.BigEndian.Uint64(buf[16:])),
+		tail:   int64(binary.BigEndian.Uint64(buf[24:])),
+	}, nil
+}
+
+func (m metadata) encode() []byte {
+	buf := make([]byte, __METADATA_SIZE)
+	binary.BigEndian.PutUint64(buf[0:], m.id)
+	binary.BigEndian.PutUint64(buf[8:], uint64(m.length))
+	binary.BigEndian.PutUint64(buf[16:], uint64(m.head))
+	binary.BigEndian.PutUint64(buf[24:], uint64(m.tail))
+	return buf
+}
+
+// expiresAt returns the ExpiresAt of badger, which is in unix seconds, for
+// the time t. It is rounded up, since badger expires the key once the second
+// is reached, and a sub-second lease would otherwise expire at once.
+func expiresAt(t time.Time) uint64 {
+	return uint64((t.UnixNano() + int64(time.Second) - 1) / int64(time.Second))
+}
+
+// encodeKey returns the badger key of the top-level key.
+func encodeKey(key []byte) []byte {
+	buf := make([]byte, 0, len(key)+1)
+	buf = append(buf, __NAMESPACE_KEY)
+	return append(buf, key...)
+}
+
+// decodeKey returns the top-level key of the badger key.
+func decodeKey(key []byte) []byte {
+	return key[1:]
+}
+
+// slotPrefix returns the common prefix of the badger keys which index the
+// top-level keys of the hash slot.
+func slotPrefix(slot int) []byte {
+	return binary.BigEndian.AppendUint16([]byte{__NAMESPACE_SLOT}, uint16(slot))
+}
+
+// slotKey returns the badger key which indexes the top-level key by its hash
+// slot. It expires along with the top-level key.
+func slotKey(key []byte) []byte {
+	return append(slotPrefix(sdk.KeySlot(key)), key...)
+}
+
+// fenceKey returns the badger key of the last fencing token of the lock at
+// the top-level key, which outlives the lock itself.
+func fenceKey(key []byte) []byte {
+	buf := make([]byte, 0, len(key)+1)
+	buf = append(buf, __NAMESPACE_FENCE)
+	return append(buf, key...)
+}
+
+// dataPrefix returns the common prefix of the badger keys of the elements
+// of the collection, which is 'd' + len(key) + key + id.
+func dataPrefix(key []byte, id uint64) []byte {
+	buf := make([]byte, 0, len(key)+13)
+	buf = append(buf, __NAMESPACE_DATA)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(key)))
+	buf = append(buf, key...)
+	return binary.BigEndian.AppendUint64(buf, id)
+}
+
+// dataKey returns the badger key of the element of the collection.
+func dataKey(key []byte, id uint64, element []byte) []byte {
+	return append(dataPrefix(key, id), element...)
+}
+
+// encodeSequence encodes the sequence number of a list element, so that the
+// byte order of the encoded numbers is the same as the numeric order.
+func encodeSequence(seq int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(seq)^(1<<63))
+}
+
+func decodeSequence(buf []byte) int64 {
+	return int64(binary.BigEndian.Uint64(buf) ^ (1 << 63))
+}
+
+// encodeScore encodes the score of a sorted set member, so that the byte
+// order of the encoded scores is the same as the numeric order.
+func encodeScore(score float64) []byte {
+	if score == 0 {
+		// NOTE: -0 and +0 are the same score
+		score = 0
+	}
+	bits := math.Float64bits(score)
+	if bits&(1<<63) == 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return binary.BigEndian.AppendUint64(nil, bits)
+}
+
+func decodeScore(buf []byte) float64 {
+	bits := binary.BigEndian.Uint64(buf)
+	if bits&(1<<63) != 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
+
+// zsetMemberKey returns the badger key which maps the member to its score.
+func zsetMemberKey(key []byte, id uint64, member []byte) []byte {
+	return append(append(dataPrefix(key, id), __ZSET_MEMBER), member...)
+}
+
+// zsetScorePrefix returns the common prefix of the badger keys which order
+// the members by score.
+func zsetScorePrefix(key []byte, id uint64) []byte {
+	return append(dataPrefix(key, id), __ZSET_SCORE)
+}
+
+// zsetScoreKey returns the badger key which orders the member by score.
+func zsetScoreKey(key []byte, id uint64, score float64, member []byte) []byte {
+	return append(append(zsetScorePrefix(key, id), encodeScore(score)...), member...)
+}
+
+// zsetCountKey returns the badger key which counts the members whose
+// encoded scores start with prefix. The counters of every prefix length
+// make a tree over the encoded scores, so that ranks are found by seeking.
+func zsetCountKey(key []byte, id uint64, prefix []byte) []byte {
+	return append(append(dataPrefix(key, id), __ZSET_COUNT, byte(len(prefix))), prefix...)
+}
+
+// zsetCountPrefix returns the common prefix of the counters of the prefixes
+// which are one byte longer than parent.
+func zsetCountPrefix(key []byte, id uint64, parent []byte) []byte {
+	return append(append(dataPrefix(key, id), __ZSET_COUNT, byte(len(parent)+1)), parent...)
+}
+
+// queueMessageKey returns the badger key of the message of the queue.
+func queueMessageKey(key []byte, id uint64, seq int64) []byte {
+	return append(append(dataPrefix(key, id), __QUEUE_MESSAGE), encodeSequence(seq)...)
+}
+
+// queueReadyPrefix returns the common prefix of the badger keys of the
+// visible messages of the queue.
+func queueReadyPrefix(key []byte, id uint64) []byte {
+	return append(dataPrefix(key, id), __QUEUE_READY)
+}
+
+// queueReadyKey returns the badger key which makes the message visible.
+func queueReadyKey(key []byte, id uint64, seq int64) []byte {
+	return append(queueReadyPrefix(key, id), encodeSequence(seq)...)
+}
+
+// scheduleKey returns the badger key which schedules the message of the
+// queue to become visible at the time, which is 't' + time + the badger key
+// of the message without the namespace. The schedule keys are ordered by
+// time, so the due messages of all queues are found by a single seek.
+func scheduleKey(at int64, key []byte, id uint64, seq int64) []byte {
+	buf := make([]byte, 0, len(key)+30)
+	buf = append(buf, __NAMESPACE_SCHEDULE)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(at))
+	return append(buf, queueMessageKey(key, id, seq)[1:]...)
+}
+
+// decodeScheduleKey splits the schedule key into the time, the key and the
+// id of the queue, and the message id.
+func decodeScheduleKey(buf []byte) (at int64, key []byte, id uint64, seq int64, ok bool) {
+	if len(buf) < 9 || buf[0] != __NAMESPACE_SCHEDULE {
+		return 0, nil, 0, 0, false
+	}
+	at = int64(binary.BigEndian.Uint64(buf[1:]))
+
+	key, id, element, ok := decodeDataKey(append([]byte{__NAMESPACE_DATA}, buf[9:]...))
+	if !ok || len(element) != 9 || element[0] != __QUEUE_MESSAGE {
+		return 0, nil, 0, 0, false
+	}
+	seq = decodeSequence(element[1:])
+	return at, key, id, seq, true
+}
+
+// decodeDataKey splits the badger key of an element into the key and the
+// id of the collection, and the element.
+func decodeDataKey(buf []byte) (key []byte, id uint64, element []byte, ok bool) {
+	if len(buf) < 5 || buf[0] != __NAMESPACE_DATA {
+		return nil, 0, nil, false
+	}
+	size := int(binary.BigEndian.Uint32(buf[1:]))
+	if len(buf) < 13+size {
+		return nil, 0, nil, false
+	}
+	key = buf[5 : 5+size]
+	id = binary.BigEndian.Uint64(buf[5+size:])
+	element = buf[13+size:]
+	return key, id, element, true
+}
+
+// hasMetadata reports whether the top-level keys of the data type hold the
+// metadata of collections.
+func hasMetadata(meta byte) bool {
+	switch meta {
+	case __TYPE_STRING, __TYPE_LOCK:
+		return false
+	}
+	return true
+}
+
+// typeName returns the name of the data type which is reported by TYPE.
+func typeName(meta byte) string {
+	switch meta {
+	case __TYPE_STRING:
+		return sdk.TYPE_STRING
+	case __TYPE_HASH:
+		return sdk.TYPE_HASH
+	case __TYPE_LIST:
+		return sdk.TYPE_LIST
+	case __TYPE_SET:
+		return sdk.TYPE_SET
+	case __TYPE_ZSET:
+		return sdk.TYPE_ZSET
+	case __TYPE_TTLSET:
+		return sdk.TYPE_TTLSET
+	case __TYPE_LIMITER:
+		return sdk.TYPE_LIMITER
+	case __TYPE_LOCK:
+		return sdk.TYPE_LOCK
+	case __TYPE_QUEUE:
+		return sdk.TYPE_QUEUE
+	}
+	return sdk.TYPE_NONE
+}
@@ -0,0 +1,318 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// LLen implements sdk.Operations.
+func (tx *Tx) LLen(key []byte) (int64, error) {
+	_, m, err := tx.lookupMetadata(key, __TYPE_LIST)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	return m.length, nil
+}
+
+// LMove implements sdk.Operations.
+func (tx *Tx) LMove(source, destination []byte, fromLeft, toLeft bool) ([]byte, error) {
+	// check the type of destination before any modification
+	_, err := tx.lookup(destination, __TYPE_LIST)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+
+	values, err := tx.pop(source, 1, fromLeft)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, sdk.ErrNil
+	}
+
+	_, err = tx.push(destination, values, toLeft)
+	if err != nil {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// LPop implements sdk.Operations.
+func (tx *Tx) LPop(key []byte, count int) ([][]byte, error) {
+	return tx.pop(key, count, true)
+}
+
+// LPush implements sdk.Operations.
+func (tx *Tx) LPush(key []byte, values ...[]byte) (int64, error) {
+	return tx.push(key, values, true)
+}
+
+// LRange implements sdk.Operations.
+func (tx *Tx) LRange(key []byte, start, stop int64) ([][]byte, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_LIST)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	if item == nil {
+		return nil, nil
+	}
+
+	// normalize the range
+	if start < 0 {
+		start += m.length
+	}
+	if stop < 0 {
+		stop += m.length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= m.length {
+		stop = m.length - 1
+	}
+	if start > stop {
+		return nil, nil
+	}
+
+	var (
+		prefix = dataPrefix(key, m.id)
+		values = make([][]byte, 0, stop-start+1)
+	)
+
+	iterOpts := badger.DefaultIteratorOptions
+	iterOpts.Prefix = prefix
+	if n := int(stop - start + 1); n < iterOpts.PrefetchSize {
+		iterOpts.PrefetchSize = n
+	}
+
+	iter := tx.txn.NewIterator(iterOpts)
+	defer iter.Close()
+
+	iter.Seek(dataKey(key, m.id, encodeSequence(m.head+start)))
+	for ; iter.Valid() && int64(len(values)) <= stop-start; iter.Next() {
+		value, err := iter.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, tx.check(err)
+		}
+		if value == nil {
+			value = []byte{}
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// RPop implements sdk.Operations.
+func (tx *Tx) RPop(key []byte, count int) ([][]byte, error) {
+	return tx.pop(key, count, false)
+}
+
+// RPush implements sdk.Operations.
+func (tx *Tx) RPush(key []byte, values ...[]byte) (int64, error) {
+	return tx.push(key, values, false)
+}
+
+// push inserts values at the head of the list if head is true, or at the
+// tail otherwise. It returns the length of the list after the push.
+func (tx *Tx) push(key []byte, values [][]byte, head bool) (int64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_LIST)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		m, err = tx.newMetadata()
+		if err != nil {
+			return 0, tx.check(err)
+		}
+	}
+
+	for _, value := range values {
+		var seq int64
+		if head {
+			m.head--
+			seq = m.head
+		} else {
+			seq = m.tail
+			m.tail++
+		}
+
+		entry := badger.NewEntry(dataKey(key, m.id, encodeSequence(seq)), value).
+			WithDiscard()
+
+		err = tx.txn.SetEntry(entry)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		m.length++
+	}
+
+	err = tx.setMetadata(key, __TYPE_LIST, m, item)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	if head {
+		tx.emit("lpush", key)
+	} else {
+		tx.emit("rpush", key)
+	}
+	return m.length, nil
+}
+
+// pop removes and returns up to count elements from the head of the list
+// if head is true, or from the tail otherwise.
+func (tx *Tx) pop(key []byte, count int, head bool) ([][]byte, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_LIST)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	if item == nil {
+		return nil, nil
+	}
+
+	if int64(count) > m.length {
+		count = int(m.length)
+	}
+
+	var values = make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		var seq int64
+		if head {
+			seq = m.head
+			m.head++
+		} else {
+			m.tail--
+			seq = m.tail
+		}
+
+		k := dataKey(key, m.id, encodeSequence(seq))
+
+		elementItem, err := tx.txn.Get(k)
+		if err != nil {
+			return nil, tx.check(err)
+		}
+		value, err := elementItem.ValueCopy(nil)
+		if err != nil {
+			return nil, tx.check(err)
+		}
+		if value == nil {
+			value = []byte{}
+		}
+
+		err = tx.txn.Delete(k)
+		if err != nil {
+			return nil, tx.check(err)
+		}
+		m.length--
+		values = append(values, value)
+	}
+
+	err = tx.setMetadata(key, __TYPE_LIST, m, item)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+
+	if len(values) > 0 {
+		if head {
+			tx.emit("lpop", key)
+		} else {
+			tx.emit("rpop", key)
+		}
+		if m.length <= 0 {
+			tx.emit("del", key)
+		}
+	}
+	return values, nil
+}
+
+// LLen implements sdk.Storage.
+func (db *DB) LLen(key []byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		count, err = tx.LLen(key)
+		return err
+	})
+	return count, err
+}
+
+// LMove implements sdk.Storage.
+func (db *DB) LMove(source, destination []byte, fromLeft, toLeft bool) (value []byte, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		value, err = tx.LMove(source, destination, fromLeft, toLeft)
+		return err
+	})
+	return value, err
+}
+
+// LPop implements sdk.Storage.
+func (db *DB) LPop(key []byte, count int) (values [][]byte, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		values, err = tx.LPop(key, count)
+		return err
+	})
+	return values, err
+}
+
+// LPush implements sdk.Storage.
+func (db *DB) LPush(key []byte, values ...[]byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		count, err = tx.LPush(key, values...)
+		return err
+	})
+	return count, err
+}
+
+// LRange implements sdk.Storage.
+func (db *DB) LRange(key []byte, start, stop int64) (values [][]byte, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		values, err = tx.LRange(key, start, stop)
+		return err
+	})
+	return values, err
+}
+
+// RPop implements sdk.Storage.
+func (db *DB) RPop(key []byte, count int) (values [][]byte, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		values, err = tx.RPop(key, count)
+		return err
+	})
+	return values, err
+}
+
+// RPush implements sdk.Storage.
+func (db *DB) RPush(key []byte, values ...[]byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		count, err = tx.RPush(key, values...)
+		return err
+	})
+	return count, err
+}
@@ -0,0 +1,109 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDB_List(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	var key = []byte("queue")
+
+	if _, err := db.RPush(key, []byte("a"), []byte("b"), []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	length, err := db.LPush(key, []byte("z"), []byte("y"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if length != 5 {
+		t.Errorf("expect length 5, but got %d", length)
+	}
+
+	values, err := db.LRange(key, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := toBytes("y", "z", "a", "b", "c"); !reflect.DeepEqual(values, expected) {
+		t.Errorf("expect %q, but got %q", expected, values)
+	}
+
+	values, err = db.LPop(key, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := toBytes("y"); !reflect.DeepEqual(values, expected) {
+		t.Errorf("expect %q, but got %q", expected, values)
+	}
+
+	values, err = db.RPop(key, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := toBytes("c", "b", "a", "z"); !reflect.DeepEqual(values, expected) {
+		t.Errorf("expect %q, but got %q", expected, values)
+	}
+
+	count, err := db.Exists(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expect the empty list to be deleted")
+	}
+
+	var (
+		events []sdk.KeyEvent
+		dest   = []byte("list:dest")
+	)
+	db.Listen(func(event sdk.KeyEvent) {
+		events = append(events, event)
+	})
+
+	_, err = db.RPush(key, []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := db.LMove(key, dest, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "a" {
+		t.Errorf("expect %q, but got %q", "a", value)
+	}
+	_, err = db.LMove(key, dest, true, false)
+	if err != sdk.ErrNil {
+		t.Errorf("expect %v, but got %v", sdk.ErrNil, err)
+	}
+	if expected := []string{"rpush", "lpop", "del", "rpush"}; len(events) != len(expected) {
+		t.Errorf("expect events %v, but got %v", expected, events)
+	} else {
+		for i := range expected {
+			if events[i].Event != expected[i] {
+				t.Errorf("expect events %v, but got %v", expected, events)
+				break
+			}
+		}
+	}
+}
+
+func toBytes(values ...string) [][]byte {
+	var reply = make([][]byte, 0, len(values))
+	for _, v := range values {
+		reply = append(reply, []byte(v))
+	}
+	return reply
+}
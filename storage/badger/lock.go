@@ -0,0 +1,214 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var (
+	errInvalidLock = errors.New("invalid lock")
+)
+
+// lock is the value of the top-level keys of locks. The lease is tracked
+// in nanoseconds by expiresAt, while the expiry of the badger entry is only
+// used to clean up the released locks.
+type lock struct {
+	token     int64 // fencing token of the acquisition
+	expiresAt int64 // in unix nanoseconds
+	owner     []byte
+}
+
+func decodeLock(buf []byte) (lock, error) {
+	if len(buf) < 16 {
+		return lock{}, errInvalidLock
+	}
+	return lock{
+		token:     int64(binary.BigEndian.Uint64(buf[0:])),
+		expiresAt: int64(binary.BigEndian.Uint64(buf[8:])),
+		owner:     append([]byte{}, buf[16:]...),
+	}, nil
+}
+
+func (l lock) encode() []byte {
+	buf := make([]byte, 16, 16+len(l.owner))
+	binary.BigEndian.PutUint64(buf[0:], uint64(l.token))
+	binary.BigEndian.PutUint64(buf[8:], uint64(l.expiresAt))
+	return append(buf, l.owner...)
+}
+
+// lookupLock returns the lock at key. The lock is nil if it is not held.
+func (tx *Tx) lookupLock(key []byte, now int64) (*lock, error) {
+	item, err := tx.lookup(key, __TYPE_LOCK)
+	if err != nil || item == nil {
+		return nil, err
+	}
+
+	var l lock
+	err = item.Value(func(val []byte) error {
+		l, err = decodeLock(val)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if l.expiresAt <= now {
+		return nil, nil
+	}
+	return &l, nil
+}
+
+func (tx *Tx) setLock(key []byte, l lock) error {
+	entry := badger.NewEntry(encodeKey(key), l.encode()).
+		WithMeta(__TYPE_LOCK).
+		WithDiscard()
+	entry.ExpiresAt = uint64((l.expiresAt + int64(time.Second) - 1) / int64(time.Second))
+
+	return tx.setKey(entry)
+}
+
+// lookupFence returns the last fencing token issued for the lock at key,
+// which is zero if none is issued.
+func (tx *Tx) lookupFence(key []byte) (int64, error) {
+	item, err := tx.txn.Get(fenceKey(key))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var token int64
+	err = item.Value(func(val []byte) error {
+		if len(val) != 8 {
+			return errInvalidLock
+		}
+		token = int64(binary.BigEndian.Uint64(val))
+		return nil
+	})
+	return token, err
+}
+
+// LockAcquire implements sdk.Operations.
+func (tx *Tx) LockAcquire(key []byte, owner []byte, lease time.Duration) (int64, bool, error) {
+	var now = time.Now().UnixNano()
+
+	l, err := tx.lookupLock(key, now)
+	if err != nil {
+		return 0, false, tx.check(err)
+	}
+	if l != nil && !bytes.Equal(l.owner, owner) {
+		return 0, false, nil
+	}
+
+	// NOTE: the last token is kept apart from the lock, which is deleted
+	// once released, and is written in the same transaction, so the tokens
+	// of the key never go back unless the data itself does, e.g. restored
+	// from a backup.
+	last, err := tx.lookupFence(key)
+	if err != nil {
+		return 0, false, tx.check(err)
+	}
+	if l != nil && l.token > last {
+		last = l.token
+	}
+	token := last + 1
+
+	entry := badger.NewEntry(fenceKey(key), binary.BigEndian.AppendUint64(nil, uint64(token))).
+		WithDiscard()
+	err = tx.txn.SetEntry(entry)
+	if err != nil {
+		return 0, false, tx.check(err)
+	}
+
+	err = tx.setLock(key, lock{
+		token:     token,
+		expiresAt: now + int64(lease),
+		owner:     owner,
+	})
+	if err != nil {
+		return 0, false, tx.check(err)
+	}
+	return token, true, nil
+}
+
+// LockRelease implements sdk.Operations.
+func (tx *Tx) LockRelease(key []byte, owner []byte) (bool, error) {
+	l, err := tx.lookupLock(key, time.Now().UnixNano())
+	if err != nil {
+		return false, tx.check(err)
+	}
+	if l == nil || !bytes.Equal(l.owner, owner) {
+		return false, nil
+	}
+
+	err = tx.deleteKey(key)
+	if err != nil {
+		return false, tx.check(err)
+	}
+	return true, nil
+}
+
+// LockRenew implements sdk.Operations.
+func (tx *Tx) LockRenew(key []byte, owner []byte, lease time.Duration) (bool, error) {
+	var now = time.Now().UnixNano()
+
+	l, err := tx.lookupLock(key, now)
+	if err != nil {
+		return false, tx.check(err)
+	}
+	if l == nil || !bytes.Equal(l.owner, owner) {
+		return false, nil
+	}
+
+	l.expiresAt = now + int64(lease)
+	err = tx.setLock(key, *l)
+	if err != nil {
+		return false, tx.check(err)
+	}
+	return true, nil
+}
+
+// LockAcquire implements sdk.Storage. The transactions of locks are retried
+// on conflict, so the contenders get the replies instead of the conflict.
+func (db *DB) LockAcquire(key []byte, owner []byte, lease time.Duration) (token int64, ok bool, err error) {
+	if !db.running {
+		return 0, false, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.updateRetry(func(txn *badger.Txn) error {
+		token, ok, err = db.newTx(txn).LockAcquire(key, owner, lease)
+		return err
+	})
+	return token, ok, err
+}
+
+// LockRelease implements sdk.Storage.
+func (db *DB) LockRelease(key []byte, owner []byte) (ok bool, err error) {
+	if !db.running {
+		return false, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.updateRetry(func(txn *badger.Txn) error {
+		ok, err = db.newTx(txn).LockRelease(key, owner)
+		return err
+	})
+	return ok, err
+}
+
+// LockRenew implements sdk.Storage.
+func (db *DB) LockRenew(key []byte, owner []byte, lease time.Duration) (ok bool, err error) {
+	if !db.running {
+		return false, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.updateRetry(func(txn *badger.Txn) error {
+		ok, err = db.newTx(txn).LockRenew(key, owner, lease)
+		return err
+	})
+	return ok, err
+}
@@ -0,0 +1,126 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDB_Lock(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	var (
+		key   = []byte("lock")
+		alice = []byte("alice")
+		bob   = []byte("bob")
+	)
+
+	first, ok, err := db.LockAcquire(key, alice, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expect the lock to be acquired")
+	}
+
+	if _, ok, _ := db.LockAcquire(key, bob, time.Second); ok {
+		t.Errorf("expect the lock to be held by alice")
+	}
+	if ok, _ := db.LockRelease(key, bob); ok {
+		t.Errorf("expect the lock not to be released by bob")
+	}
+
+	// the lease expires
+	time.Sleep(100 * time.Millisecond)
+
+	if ok, _ := db.LockRenew(key, alice, time.Second); ok {
+		t.Errorf("expect the expired lock not to be renewed")
+	}
+	second, ok, err := db.LockAcquire(key, bob, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expect the expired lock to be acquired")
+	}
+	if second <= first {
+		t.Errorf("expect the fencing token %d to be greater than %d", second, first)
+	}
+
+	if ok, _ := db.LockRelease(key, bob); !ok {
+		t.Errorf("expect the lock to be released by bob")
+	}
+}
+
+func TestDB_Lock_Restore(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	source := badger.New(&config)
+	source.Start(context.Background())
+	defer source.Stop(context.Background())
+
+	var (
+		key    = []byte("lock")
+		alice  = []byte("alice")
+		backup bytes.Buffer
+	)
+
+	// the tokens go on after the lock is released
+	first, _, err := source.LockAcquire(key, alice, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := source.LockRelease(key, alice); !ok {
+		t.Fatal("expect the lock to be released")
+	}
+	second, _, err := source.LockAcquire(key, alice, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first+1 {
+		t.Errorf("expect the fencing token %d, but got %d", first+1, second)
+	}
+	if ok, _ := source.LockRelease(key, alice); !ok {
+		t.Fatal("expect the lock to be released")
+	}
+
+	if _, err := source.Backup(&backup, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := source.LockAcquire(key, alice, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// the restored database issues the tokens after the ones of the backup,
+	// regardless of the tokens issued since
+	db := badger.New(&config)
+	defer db.Stop(context.Background())
+
+	if err := db.Restore(false, &backup); err != nil {
+		t.Fatal(err)
+	}
+	db.Start(context.Background())
+
+	token, ok, err := db.LockAcquire(key, alice, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || token != second+1 {
+		t.Errorf("expect the fencing token %d, but got %d, %v", second+1, token, ok)
+	}
+}
@@ -0,0 +1,231 @@
+package badger
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	// __FORMAT_VERSION is the version of the on-disk format. The databases
+	// written before the format was introduced are version 0, which store
+	// the raw keys and values without namespaces and data types. Version 1
+	// does not index the top-level keys by hash slot.
+	__FORMAT_VERSION uint32 = 2
+)
+
+var (
+	__FORMAT_KEY = []byte{__NAMESPACE_SYSTEM, 'f', 'o', 'r', 'm', 'a', 't'}
+)
+
+// migrate upgrades the database to the current on-disk format. The version
+// is written after each step, so that an interrupted migration is resumed
+// from the step it was in.
+func migrate(db *badger.DB, logger badger.Logger) error {
+	version, err := formatVersion(db)
+	if err != nil {
+		return err
+	}
+	if version > __FORMAT_VERSION {
+		return errors.New("unsupported database format version")
+	}
+
+	if version == 0 {
+		logger.Infof("Migrating database to format version %d", version+1)
+
+		count, err := migrateRawKeys(db)
+		if err != nil {
+			return err
+		}
+		if err = setFormatVersion(db, 1); err != nil {
+			return err
+		}
+
+		logger.Infof("Migrated %d keys", count)
+		version = 1
+	}
+
+	if version == 1 {
+		logger.Infof("Migrating database to format version %d", version+1)
+
+		count, err := indexSlots(db)
+		if err != nil {
+			return err
+		}
+		if err = setFormatVersion(db, 2); err != nil {
+			return err
+		}
+
+		logger.Infof("Indexed %d keys by slot", count)
+	}
+	return nil
+}
+
+func setFormatVersion(db *badger.DB, version uint32) error {
+	return db.Update(func(txn *badger.Txn) error {
+		var value = make([]byte, 4)
+		binary.BigEndian.PutUint32(value, version)
+
+		return txn.Set(__FORMAT_KEY, value)
+	})
+}
+
+func formatVersion(db *badger.DB) (uint32, error) {
+	var version uint32 = 0
+
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(__FORMAT_KEY)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			if len(val) != 4 {
+				return errors.New("invalid database format version")
+			}
+			version = binary.BigEndian.Uint32(val)
+			return nil
+		})
+	})
+	return version, err
+}
+
+// migrateRawKeys moves the raw keys into the top-level namespace as
+// strings, and retains their expiry.
+//
+// The keys are moved in several transactions, and the migration might be
+// interrupted in between. It is resumed on the next start, since a raw key
+// has no data type, and the moved keys are not moved again.
+func migrateRawKeys(db *badger.DB) (int, error) {
+	var count int = 0
+
+	txn := db.NewTransaction(true)
+	defer func() { txn.Discard() }()
+
+	err := db.View(func(view *badger.Txn) error {
+		iter := view.NewIterator(badger.IteratorOptions{PrefetchValues: false})
+		defer iter.Close()
+
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			item := iter.Item()
+			if item.UserMeta() != 0 {
+				continue
+			}
+			key := item.KeyCopy(nil)
+
+			n, err := migrateRawKey(txn, key)
+			if errors.Is(err, badger.ErrTxnTooBig) {
+				if err = txn.Commit(); err != nil {
+					return err
+				}
+				txn = db.NewTransaction(true)
+				n, err = migrateRawKey(txn, key)
+			}
+			if err != nil {
+				return err
+			}
+			count += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, txn.Commit()
+}
+
+// migrateRawKey moves the raw key, unless it is moved already, and returns
+// the number of the moved keys.
+func migrateRawKey(txn *badger.Txn, key []byte) (int, error) {
+	item, err := txn.Get(key)
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if item.UserMeta() != 0 {
+		return 0, nil
+	}
+
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return 0, err
+	}
+	expiresAt := item.ExpiresAt()
+
+	// NOTE: the migrated key might be another raw key, e.g. "kfoo" of
+	// "foo", which is moved first.
+	count, err := migrateRawKey(txn, encodeKey(key))
+	if err != nil {
+		return 0, err
+	}
+
+	entry := badger.NewEntry(encodeKey(key), value).
+		WithMeta(__TYPE_STRING).
+		WithDiscard()
+	entry.ExpiresAt = expiresAt
+
+	if err = txn.SetEntry(entry); err != nil {
+		return 0, err
+	}
+
+	// NOTE: likewise the raw key might be the migrated key of another raw
+	// key, which overwrites it instead. The raw key "k" is the migrated key
+	// of none, since the keys are never empty.
+	if len(key) > 1 && key[0] == __NAMESPACE_KEY {
+		item, err = txn.Get(decodeKey(key))
+		if err == nil && item.UserMeta() == 0 {
+			return count + 1, nil
+		}
+		if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+			return 0, err
+		}
+	}
+
+	if err = txn.Delete(key); err != nil {
+		return 0, err
+	}
+	return count + 1, nil
+}
+
+// indexSlots writes the entries of the slot index of the top-level keys,
+// which expire along with the keys. It is idempotent, so it is simply run
+// again if interrupted.
+func indexSlots(db *badger.DB) (int, error) {
+	var count int = 0
+
+	wb := db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := db.View(func(txn *badger.Txn) error {
+		iterOpts := badger.DefaultIteratorOptions
+		iterOpts.PrefetchValues = false
+		iterOpts.Prefix = []byte{__NAMESPACE_KEY}
+
+		iter := txn.NewIterator(iterOpts)
+		defer iter.Close()
+
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			item := iter.Item()
+
+			entry := badger.NewEntry(slotKey(decodeKey(item.KeyCopy(nil))), nil).
+				WithDiscard()
+			entry.ExpiresAt = item.ExpiresAt()
+
+			if err := wb.SetEntry(entry); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, wb.Flush()
+}
@@ -0,0 +1,87 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	badgerdb "github.com/dgraph-io/badger/v4"
+)
+
+func TestDB_Migrate(t *testing.T) {
+	config := sdk.Config{
+		Engine:             sdk.ENGINE_FILE,
+		DataPath:           t.TempDir(),
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	// a database of format version 0, which stores the raw keys. The
+	// migration of "bar" was interrupted after its key had been moved.
+	raw, err := badgerdb.Open(badgerdb.DefaultOptions(config.DataPath).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = raw.Update(func(txn *badgerdb.Txn) error {
+		for key, value := range map[string]string{
+			"foo":  "1",
+			"kfoo": "2",
+			"k":    "3",
+		} {
+			if err := txn.Set([]byte(key), []byte(value)); err != nil {
+				return err
+			}
+		}
+		if err := txn.SetEntry(badgerdb.NewEntry([]byte("ttl"), []byte("4")).WithTTL(time.Hour)); err != nil {
+			return err
+		}
+		// the moved key is a string, whose data type is 1
+		return txn.SetEntry(badgerdb.NewEntry([]byte("kbar"), []byte("5")).WithMeta(1))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := raw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	for key, expected := range map[string]string{
+		"foo":  "1",
+		"kfoo": "2",
+		"k":    "3",
+		"ttl":  "4",
+		"bar":  "5",
+	} {
+		value, err := db.Get([]byte(key))
+		if err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+		if string(value) != expected {
+			t.Errorf("expect %s = %q, but got %q", key, expected, value)
+		}
+	}
+	if _, err := db.Get([]byte("kbar")); !errors.Is(err, sdk.ErrNil) {
+		t.Errorf("expect kbar to be moved once, but got %v", err)
+	}
+	if ok, ttl, err := db.Ttl([]byte("ttl")); err != nil || !ok || ttl <= 0 {
+		t.Errorf("expect ttl to expire, but got %v, %d, %v", ok, ttl, err)
+	}
+
+	// the migrated keys are indexed by slot
+	for _, key := range []string{"foo", "kfoo", "k", "ttl", "bar"} {
+		keys, _, err := db.SlotKeys(sdk.KeySlot([]byte(key)), []byte(key), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 1 || string(keys[0]) != key {
+			t.Errorf("expect %s to be indexed by slot, but got %q", key, keys)
+		}
+	}
+}
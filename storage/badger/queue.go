@@ -0,0 +1,417 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// The messages of queues are the elements keyed by their ids, which are
+// assigned from the tail of the metadata in order. A message is either
+// visible, which is indexed by the ready index in order of ids, or it is
+// delayed or in flight, which is indexed by the schedule namespace at the
+// time it becomes visible. The schedule is shared by all queues, and the
+// due messages are moved back to the ready index by QueuePromoteTask.
+
+const (
+	__QUEUE_PROMOTE_BATCH = 1000
+)
+
+var (
+	errInvalidMessage = errors.New("invalid message")
+)
+
+type message struct {
+	receives  int64
+	visibleAt int64 // in unix nanoseconds; zero if the message is visible
+	body      []byte
+}
+
+func decodeMessage(buf []byte) (message, error) {
+	if len(buf) < 16 {
+		return message{}, errInvalidMessage
+	}
+	return message{
+		receives:  int64(binary.BigEndian.Uint64(buf[0:])),
+		visibleAt: int64(binary.BigEndian.Uint64(buf[8:])),
+		body:      append([]byte{}, buf[16:]...),
+	}, nil
+}
+
+func (msg message) encode() []byte {
+	buf := make([]byte, 16, 16+len(msg.body))
+	binary.BigEndian.PutUint64(buf[0:], uint64(msg.receives))
+	binary.BigEndian.PutUint64(buf[8:], uint64(msg.visibleAt))
+	return append(buf, msg.body...)
+}
+
+// formatReceipt returns the receipt of the delivery, which is the message id
+// and the number of receives. The receipts of prior deliveries are void as
+// the number of receives grows.
+func formatReceipt(seq int64, receives int64) []byte {
+	buf := strconv.AppendInt(nil, seq, 10)
+	buf = append(buf, '-')
+	return strconv.AppendInt(buf, receives, 10)
+}
+
+func parseReceipt(receipt []byte) (seq int64, receives int64, ok bool) {
+	before, after, found := bytes.Cut(receipt, []byte{'-'})
+	if !found {
+		return 0, 0, false
+	}
+	seq, err := strconv.ParseInt(string(before), 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	receives, err = strconv.ParseInt(string(after), 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return seq, receives, true
+}
+
+// getMessage returns the message of the queue, or nil if it does not exist.
+func (tx *Tx) getMessage(key []byte, id uint64, seq int64) (*message, error) {
+	item, err := tx.txn.Get(queueMessageKey(key, id, seq))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var msg message
+	err = item.Value(func(val []byte) error {
+		msg, err = decodeMessage(val)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// setMessage writes the message and indexes it by its state. The index of
+// the prior state must be removed by unindexMessage.
+func (tx *Tx) setMessage(key []byte, id uint64, seq int64, msg message) error {
+	var index []byte
+	if msg.visibleAt > 0 {
+		index = scheduleKey(msg.visibleAt, key, id, seq)
+	} else {
+		index = queueReadyKey(key, id, seq)
+	}
+
+	err := tx.txn.SetEntry(badger.NewEntry(index, nil).WithDiscard())
+	if err != nil {
+		return err
+	}
+	return tx.txn.SetEntry(badger.NewEntry(queueMessageKey(key, id, seq), msg.encode()).WithDiscard())
+}
+
+func (tx *Tx) unindexMessage(key []byte, id uint64, seq int64, msg message) error {
+	if msg.visibleAt > 0 {
+		return tx.txn.Delete(scheduleKey(msg.visibleAt, key, id, seq))
+	}
+	return tx.txn.Delete(queueReadyKey(key, id, seq))
+}
+
+// promote makes the scheduled messages which are due at now visible, up
+// to limit schedules. It returns the number of schedules processed.
+func (tx *Tx) promote(now int64, limit int) (int, error) {
+	iterOpts := badger.DefaultIteratorOptions
+	iterOpts.PrefetchValues = false
+	iterOpts.Prefix = []byte{__NAMESPACE_SCHEDULE}
+
+	iter := tx.txn.NewIterator(iterOpts)
+	defer iter.Close()
+
+	var count int = 0
+	for iter.Rewind(); iter.Valid() && count < limit; iter.Next() {
+		k := iter.Item().KeyCopy(nil)
+
+		at, key, id, seq, ok := decodeScheduleKey(k)
+		if !ok {
+			continue
+		}
+		if at > now {
+			break
+		}
+
+		err := tx.txn.Delete(k)
+		if err != nil {
+			return 0, err
+		}
+		count++
+
+		// NOTE: the schedule is void if the queue had been deleted, or the
+		// message had been acknowledged or rescheduled.
+		item, m, err := tx.lookupMetadata(key, __TYPE_QUEUE)
+		if err != nil {
+			if errors.Is(err, sdk.ErrWrongType) {
+				continue
+			}
+			return 0, err
+		}
+		if item == nil || m.id != id {
+			continue
+		}
+		msg, err := tx.getMessage(key, id, seq)
+		if err != nil {
+			return 0, err
+		}
+		if msg == nil || msg.visibleAt != at {
+			continue
+		}
+
+		msg.visibleAt = 0
+		err = tx.setMessage(key, id, seq, *msg)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+// QAck implements sdk.Operations.
+func (tx *Tx) QAck(key []byte, receipts ...[]byte) (int64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_QUEUE)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		return 0, nil
+	}
+
+	var count int64 = 0
+	for _, receipt := range receipts {
+		seq, receives, ok := parseReceipt(receipt)
+		if !ok {
+			continue
+		}
+
+		msg, err := tx.getMessage(key, m.id, seq)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		if msg == nil || msg.receives != receives {
+			continue
+		}
+
+		err = tx.unindexMessage(key, m.id, seq, *msg)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		err = tx.txn.Delete(queueMessageKey(key, m.id, seq))
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		m.length--
+		count++
+	}
+
+	err = tx.setMetadata(key, __TYPE_QUEUE, m, item)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	return count, nil
+}
+
+// QLen implements sdk.Operations.
+func (tx *Tx) QLen(key []byte) (int64, error) {
+	_, m, err := tx.lookupMetadata(key, __TYPE_QUEUE)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	return m.length, nil
+}
+
+// QPush implements sdk.Operations.
+func (tx *Tx) QPush(key []byte, delay time.Duration, messages ...[]byte) (int64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_QUEUE)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		m, err = tx.newMetadata()
+		if err != nil {
+			return 0, tx.check(err)
+		}
+	}
+
+	var visibleAt int64 = 0
+	if delay > 0 {
+		visibleAt = time.Now().Add(delay).UnixNano()
+	}
+
+	for _, body := range messages {
+		seq := m.tail
+		m.tail++
+
+		err = tx.setMessage(key, m.id, seq, message{
+			visibleAt: visibleAt,
+			body:      body,
+		})
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		m.length++
+	}
+
+	err = tx.setMetadata(key, __TYPE_QUEUE, m, item)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	return m.length, nil
+}
+
+// QReceive implements sdk.Operations.
+func (tx *Tx) QReceive(key []byte, opts sdk.QReceiveOptions) ([]sdk.QueueMessage, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_QUEUE)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	if item == nil {
+		return nil, nil
+	}
+
+	var count = opts.Count
+	if int64(count) > m.length {
+		count = int(m.length)
+	}
+	if count < 0 {
+		count = 0
+	}
+
+	var (
+		now         = time.Now().UnixNano()
+		prefix      = queueReadyPrefix(key, m.id)
+		messages    = make([]sdk.QueueMessage, 0, count)
+		deadLetters [][]byte
+	)
+
+	iterOpts := badger.DefaultIteratorOptions
+	iterOpts.PrefetchValues = false
+	iterOpts.Prefix = prefix
+
+	iter := tx.txn.NewIterator(iterOpts)
+	defer iter.Close()
+
+	for iter.Rewind(); iter.Valid() && len(messages) < opts.Count; iter.Next() {
+		k := iter.Item().KeyCopy(nil)
+		seq := decodeSequence(k[len(prefix):])
+
+		err = tx.txn.Delete(k)
+		if err != nil {
+			return nil, tx.check(err)
+		}
+
+		msg, err := tx.getMessage(key, m.id, seq)
+		if err != nil {
+			return nil, tx.check(err)
+		}
+		if msg == nil {
+			continue
+		}
+		msg.receives++
+
+		if opts.MaxReceives > 0 && msg.receives > opts.MaxReceives {
+			err = tx.txn.Delete(queueMessageKey(key, m.id, seq))
+			if err != nil {
+				return nil, tx.check(err)
+			}
+			m.length--
+			deadLetters = append(deadLetters, msg.body)
+			continue
+		}
+
+		// NOTE: the message is delivered again once the visibility timeout
+		// elapses; it becomes visible on the next promotion if the timeout
+		// is not positive.
+		msg.visibleAt = now + int64(opts.Visibility)
+		if opts.Visibility <= 0 {
+			msg.visibleAt = now
+		}
+		err = tx.setMessage(key, m.id, seq, *msg)
+		if err != nil {
+			return nil, tx.check(err)
+		}
+
+		messages = append(messages, sdk.QueueMessage{
+			ID:       seq,
+			Receipt:  formatReceipt(seq, msg.receives),
+			Receives: msg.receives,
+			Body:     msg.body,
+		})
+	}
+
+	err = tx.setMetadata(key, __TYPE_QUEUE, m, item)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+
+	if len(deadLetters) > 0 && opts.DeadLetter != nil {
+		_, err = tx.QPush(opts.DeadLetter, 0, deadLetters...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+// QAck implements sdk.Storage.
+func (db *DB) QAck(key []byte, receipts ...[]byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.updateRetry(func(txn *badger.Txn) error {
+		count, err = db.newTx(txn).QAck(key, receipts...)
+		return err
+	})
+	return count, err
+}
+
+// QLen implements sdk.Storage.
+func (db *DB) QLen(key []byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		count, err = tx.QLen(key)
+		return err
+	})
+	return count, err
+}
+
+// QPush implements sdk.Storage.
+func (db *DB) QPush(key []byte, delay time.Duration, messages ...[]byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.updateRetry(func(txn *badger.Txn) error {
+		count, err = db.newTx(txn).QPush(key, delay, messages...)
+		return err
+	})
+	return count, err
+}
+
+// QReceive implements sdk.Storage. The transaction is retried on conflict,
+// so the concurrent receivers never get the same message.
+func (db *DB) QReceive(key []byte, opts sdk.QReceiveOptions) (messages []sdk.QueueMessage, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.updateRetry(func(txn *badger.Txn) error {
+		messages, err = db.newTx(txn).QReceive(key, opts)
+		return err
+	})
+	return messages, err
+}
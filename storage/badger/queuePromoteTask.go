@@ -0,0 +1,119 @@
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// QueuePromoteTask makes the messages of queues visible again, which had
+// been delayed or whose visibility timeout has elapsed.
+type QueuePromoteTask struct {
+	BadgerDB *badger.DB
+
+	PromoteInterval time.Duration
+
+	// Paused reports whether the task is skipped, e.g. while the database
+	// is a read-only replica.
+	Paused func() bool
+	Logger badger.Logger
+
+	mutex       sync.Mutex
+	done        chan struct{}
+	stopped     chan struct{}
+	initialized bool
+	running     bool
+	disposed    bool
+}
+
+func (task *QueuePromoteTask) init() {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if task.initialized {
+		return
+	}
+
+	task.done = make(chan struct{})
+	task.stopped = make(chan struct{})
+	task.initialized = true
+}
+
+func (task *QueuePromoteTask) run() {
+	if !task.initialized {
+		panic(fmt.Sprintf("%T don't be initialized yet", task))
+	}
+
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if task.running || task.disposed {
+		return
+	}
+	task.running = true
+
+	ticker := time.NewTicker(task.PromoteInterval)
+
+	go func() {
+		defer close(task.stopped)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-task.done:
+				return
+			case <-ticker.C:
+				if task.Paused != nil && task.Paused() {
+					continue
+				}
+				err := task.promote()
+				if err != nil {
+					task.Logger.Errorf("promote messages: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// stop stops the task, and waits until the promotion being run is done,
+// since badger fails or panics once it is closed.
+func (task *QueuePromoteTask) stop() {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if !task.disposed {
+		task.disposed = true
+		close(task.done)
+		if task.running {
+			<-task.stopped
+		}
+	}
+}
+
+// promote moves the due messages in batches until none is left. The batch
+// which conflicts with the receivers is retried on the next tick.
+func (task *QueuePromoteTask) promote() error {
+	var now = time.Now().UnixNano()
+
+	for {
+		var count int
+
+		err := task.BadgerDB.Update(func(txn *badger.Txn) error {
+			var err error
+			count, err = (&Tx{txn: txn}).promote(now, __QUEUE_PROMOTE_BATCH)
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, badger.ErrConflict) {
+				return nil
+			}
+			return err
+		}
+		if count < __QUEUE_PROMOTE_BATCH {
+			return nil
+		}
+	}
+}
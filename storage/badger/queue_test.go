@@ -0,0 +1,91 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDB_Queue(t *testing.T) {
+	config := sdk.Config{
+		Engine:               "memory",
+		KeyDiscardInterval:   5 * time.Second,
+		KeyDiscardRatio:      0.7,
+		QueuePromoteInterval: 10 * time.Millisecond,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	var (
+		key  = []byte("jobs")
+		dlq  = []byte("jobs:dead")
+		opts = sdk.QReceiveOptions{
+			Count:       10,
+			Visibility:  50 * time.Millisecond,
+			MaxReceives: 2,
+			DeadLetter:  dlq,
+		}
+	)
+
+	if _, err := db.QPush(key, 0, []byte("a"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.QPush(key, 50*time.Millisecond, []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := db.QReceive(key, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || string(messages[0].Body) != "a" || string(messages[1].Body) != "b" {
+		t.Fatalf("expect the visible messages a and b, but got %d messages", len(messages))
+	}
+	if count, _ := db.QAck(key, messages[1].Receipt); count != 1 {
+		t.Errorf("expect b to be acknowledged")
+	}
+
+	// the delayed message and the unacknowledged message become visible
+	time.Sleep(150 * time.Millisecond)
+
+	messages, err = db.QReceive(key, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || string(messages[0].Body) != "a" || messages[0].Receives != 2 {
+		t.Fatalf("expect a to be delivered again")
+	}
+	if count, _ := db.QAck(key, messages[1].Receipt); count != 1 {
+		t.Errorf("expect c to be acknowledged")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	// a is dead-lettered on the third receive
+	messages, err = db.QReceive(key, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 0 {
+		t.Errorf("expect no message, but got %d messages", len(messages))
+	}
+	if count, _ := db.QLen(key); count != 0 {
+		t.Errorf("expect the queue to be empty, but got %d", count)
+	}
+	if count, _ := db.QLen(dlq); count != 1 {
+		t.Errorf("expect the dead-letter queue to have 1 message, but got %d", count)
+	}
+	// the count is bounded by the length of the queue
+	messages, err = db.QReceive(dlq, sdk.QReceiveOptions{Count: math.MaxInt, Visibility: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || string(messages[0].Body) != "a" {
+		t.Errorf("expect the dead-lettered message a, but got %d messages", len(messages))
+	}
+}
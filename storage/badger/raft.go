@@ -0,0 +1,472 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/hashicorp/raft"
+)
+
+const (
+	__RAFT_APPLY_TIMEOUT   = 10 * time.Second
+	__RAFT_MAX_POOL        = 3
+	__RAFT_SNAPSHOT_RETAIN = 2
+	__RAFT_READY_INTERVAL  = 10 * time.Millisecond
+
+	__RAFT_OP_SET    = "set"
+	__RAFT_OP_INCRBY = "incrby"
+	__RAFT_OP_EXPIRE = "expire"
+	__RAFT_OP_DEL    = "del"
+)
+
+var (
+	_ raft.FSM         = new(raftNode)
+	_ raft.FSMSnapshot = new(raftSnapshot)
+
+	errRaftNotReady = errors.New("raft leader is not ready to serve reads")
+
+	// __RAFT_KEY keeps the index of the last raft log applied to the keys.
+	__RAFT_KEY = []byte{__NAMESPACE_SYSTEM, 'r', 'a', 'f', 't'}
+)
+
+// raftCommand is the write proposed through the raft log. The leases are
+// turned into the expiry times once proposed, so that the keys expire at the
+// same time on every member.
+type raftCommand struct {
+	Op          string                          `json:"op"`
+	Keys        [][]byte                        `json:"keys"`
+	Value       []byte                          `json:"value,omitempty"`
+	SetOptions  sdk.SetOptions                  `json:"set_options"`
+	Increment   int64                           `json:"increment,omitempty"`
+	ExpireAt    time.Time                       `json:"expire_at"`
+	Constraints []sdk.BoundaryConstraint[int64] `json:"constraints,omitempty"`
+}
+
+// raftResult is the result of the raft log applied by the leader, which is
+// replied to the proposer.
+type raftResult struct {
+	ok     bool
+	old    []byte
+	number int64
+	err    error
+}
+
+// raftNode is the member of the raft cluster. It proposes the writes of the
+// database through the raft log, and applies the committed logs to the keys
+// as the raft.FSM of every member.
+type raftNode struct {
+	db      *DB
+	nodeID  string
+	members []sdk.RaftMember
+	logger  *Logger
+
+	store     *RaftStore
+	snapshots raft.SnapshotStore
+	transport *raft.NetworkTransport
+	raft      *raft.Raft
+
+	// ready is set once the leader has applied the logs of the former
+	// terms, after which its reads are linearizable.
+	ready atomic.Bool
+	done  chan struct{}
+}
+
+func newRaftNode(db *DB, config *sdk.Config, logger *Logger) (*raftNode, error) {
+	members, err := config.RaftMembers()
+	if err != nil {
+		return nil, err
+	}
+
+	var address string
+	for _, member := range members {
+		if member.ID == config.RaftNodeID {
+			address = member.Address
+		}
+	}
+
+	// badger.Options
+	var (
+		opts      badger.Options
+		snapshots raft.SnapshotStore
+	)
+	switch config.Engine {
+	case sdk.ENGINE_FILE:
+		opts = badger.DefaultOptions(filepath.Join(config.RaftDataPath, "logs")).
+			WithSyncWrites(true)
+
+		snapshots, err = raft.NewFileSnapshotStore(config.RaftDataPath, __RAFT_SNAPSHOT_RETAIN, logger.Writer())
+		if err != nil {
+			return nil, err
+		}
+	case sdk.ENGINE_MEMORY:
+		opts = badger.DefaultOptions("").
+			WithInMemory(true)
+
+		snapshots = raft.NewInmemSnapshotStore()
+	}
+	opts.WithLogger(logger)
+
+	badgerDB, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := raft.NewTCPTransport(address, nil, __RAFT_MAX_POOL, __RAFT_APPLY_TIMEOUT, logger.Writer())
+	if err != nil {
+		badgerDB.Close()
+		return nil, err
+	}
+
+	return &raftNode{
+		db:        db,
+		nodeID:    config.RaftNodeID,
+		members:   members,
+		logger:    logger,
+		store:     &RaftStore{BadgerDB: badgerDB},
+		snapshots: snapshots,
+		transport: transport,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// start joins the raft cluster, which is bootstrapped with the members once
+// the member has no raft state.
+func (node *raftNode) start() error {
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(node.nodeID)
+	conf.LogOutput = node.logger.Writer()
+
+	exists, err := raft.HasExistingState(node.store, node.store, node.snapshots)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		var configuration raft.Configuration
+		for _, member := range node.members {
+			configuration.Servers = append(configuration.Servers, raft.Server{
+				ID:      raft.ServerID(member.ID),
+				Address: raft.ServerAddress(member.Address),
+			})
+		}
+
+		err = raft.BootstrapCluster(conf, node.store, node.store, node.snapshots, node.transport, configuration)
+		if err != nil {
+			return err
+		}
+	}
+
+	r, err := raft.NewRaft(conf, node, node.store, node.store, node.snapshots, node.transport)
+	if err != nil {
+		return err
+	}
+	node.raft = r
+
+	go node.watchLeadership()
+	return nil
+}
+
+// stop leaves the raft cluster, and waits until the logs and the snapshot
+// being applied are done.
+func (node *raftNode) stop() {
+	if node.raft != nil {
+		err := node.raft.Shutdown().Error()
+		if err != nil {
+			node.logger.Errorf("raft: %v", err)
+		}
+		close(node.done)
+	}
+	node.transport.Close()
+	node.store.BadgerDB.Close()
+}
+
+// watchLeadership applies the logs of the former terms once the member
+// becomes the leader, by a barrier which commits a log of its own term.
+func (node *raftNode) watchLeadership() {
+	for {
+		select {
+		case <-node.done:
+			return
+		case leader := <-node.raft.LeaderCh():
+			node.ready.Store(false)
+			if !leader {
+				continue
+			}
+
+			err := node.raft.Barrier(__RAFT_APPLY_TIMEOUT).Error()
+			if err != nil {
+				node.logger.Warningf("raft: %v", err)
+				continue
+			}
+			node.ready.Store(node.raft.State() == raft.Leader)
+		}
+	}
+}
+
+// readIndex waits until the reads of the leader are linearizable. The
+// writes are replied once they are applied to the leader, so the leader
+// serves every replied write once it has applied the logs of the former
+// terms, and is confirmed by the quorum that it is still the leader.
+func (node *raftNode) readIndex() error {
+	if node.raft.State() != raft.Leader {
+		return sdk.ErrNotLeader
+	}
+
+	deadline := time.Now().Add(__RAFT_APPLY_TIMEOUT)
+	for !node.ready.Load() {
+		if time.Now().After(deadline) {
+			return errRaftNotReady
+		}
+		time.Sleep(__RAFT_READY_INTERVAL)
+	}
+
+	err := node.raft.VerifyLeader().Error()
+	if err != nil {
+		if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+			return sdk.ErrNotLeader
+		}
+		return err
+	}
+	return nil
+}
+
+// propose replicates the command through the raft log, and returns the
+// result of the command applied to the leader.
+func (node *raftNode) propose(cmd raftCommand) raftResult {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return raftResult{err: err}
+	}
+
+	future := node.raft.Apply(data, __RAFT_APPLY_TIMEOUT)
+	err = future.Error()
+	if err != nil {
+		if errors.Is(err, raft.ErrNotLeader) {
+			return raftResult{err: sdk.ErrNotLeader}
+		}
+		return raftResult{err: err}
+	}
+	return future.Response().(raftResult)
+}
+
+func (node *raftNode) set(key []byte, value []byte, opts sdk.SetOptions) (bool, []byte, error) {
+	if opts.ExpireAt.IsZero() && opts.Lease > 0 {
+		opts.ExpireAt = time.Now().Add(opts.Lease)
+	}
+	opts.Lease = 0
+
+	result := node.propose(raftCommand{
+		Op:         __RAFT_OP_SET,
+		Keys:       [][]byte{key},
+		Value:      value,
+		SetOptions: opts,
+	})
+	return result.ok, result.old, result.err
+}
+
+func (node *raftNode) incrBy(key []byte, increment int64, lease time.Duration, constraints []sdk.Constraint[int64]) (int64, error) {
+	var cmd = raftCommand{
+		Op:        __RAFT_OP_INCRBY,
+		Keys:      [][]byte{key},
+		Increment: increment,
+	}
+	if lease > 0 {
+		cmd.ExpireAt = time.Now().Add(lease)
+	}
+
+	// NOTE: the constraints are checked by every member, so only the
+	// constraints which can be encoded are allowed.
+	for _, constraint := range constraints {
+		c, ok := constraint.(sdk.BoundaryConstraint[int64])
+		if !ok {
+			return 0, sdk.ErrRaftUnsupported
+		}
+		cmd.Constraints = append(cmd.Constraints, c)
+	}
+
+	result := node.propose(cmd)
+	return result.number, result.err
+}
+
+func (node *raftNode) expire(key []byte, lease time.Duration) (bool, error) {
+	result := node.propose(raftCommand{
+		Op:       __RAFT_OP_EXPIRE,
+		Keys:     [][]byte{key},
+		ExpireAt: time.Now().Add(lease),
+	})
+	return result.ok, result.err
+}
+
+func (node *raftNode) del(keys [][]byte) (int64, error) {
+	result := node.propose(raftCommand{
+		Op:   __RAFT_OP_DEL,
+		Keys: keys,
+	})
+	return result.number, result.err
+}
+
+// status returns the state of the member.
+func (node *raftNode) status() sdk.RaftStatus {
+	status := sdk.RaftStatus{
+		NodeID: node.nodeID,
+		State:  raft.Shutdown.String(),
+	}
+	if node.raft == nil {
+		return status
+	}
+
+	address, id := node.raft.LeaderWithID()
+	status.State = node.raft.State().String()
+	status.LeaderID = string(id)
+	status.LeaderAddress = string(address)
+	status.AppliedIndex = node.raft.AppliedIndex()
+
+	future := node.raft.GetConfiguration()
+	if future.Error() == nil {
+		for _, server := range future.Configuration().Servers {
+			status.Members = append(status.Members, sdk.RaftMember{
+				ID:      string(server.ID),
+				Address: string(server.Address),
+			})
+		}
+	}
+	return status
+}
+
+// Apply implements raft.FSM.
+func (node *raftNode) Apply(log *raft.Log) interface{} {
+	var cmd raftCommand
+	err := json.Unmarshal(log.Data, &cmd)
+	if err != nil {
+		return raftResult{err: err}
+	}
+
+	var result raftResult
+	result.err = node.db.applyRaftLog(log.Index, func(tx *Tx) (err error) {
+		switch cmd.Op {
+		case __RAFT_OP_SET:
+			result.ok, result.old, err = tx.Set(cmd.Keys[0], cmd.Value, cmd.SetOptions)
+		case __RAFT_OP_INCRBY:
+			var (
+				lease       time.Duration = 0
+				constraints               = make([]sdk.Constraint[int64], 0, len(cmd.Constraints))
+			)
+			if !cmd.ExpireAt.IsZero() {
+				// NOTE: the lease is kept positive even if the expiry
+				// time is past, otherwise the new key never expires.
+				lease = time.Until(cmd.ExpireAt)
+				if lease <= 0 {
+					lease = time.Nanosecond
+				}
+			}
+			for _, constraint := range cmd.Constraints {
+				constraints = append(constraints, constraint)
+			}
+			result.number, err = tx.IncrBy(cmd.Keys[0], cmd.Increment, lease, constraints...)
+		case __RAFT_OP_EXPIRE:
+			result.ok, err = tx.Expire(cmd.Keys[0], time.Until(cmd.ExpireAt))
+		case __RAFT_OP_DEL:
+			result.number, err = tx.Del(cmd.Keys...)
+		default:
+			err = fmt.Errorf("unknown raft command '%s'", cmd.Op)
+		}
+		return err
+	})
+	return result
+}
+
+// Snapshot implements raft.FSM.
+func (node *raftNode) Snapshot() (raft.FSMSnapshot, error) {
+	return &raftSnapshot{BadgerDB: node.db.db}, nil
+}
+
+// Restore implements raft.FSM.
+func (node *raftNode) Restore(snapshot io.ReadCloser) error {
+	defer snapshot.Close()
+
+	return node.db.load(snapshot)
+}
+
+// raftSnapshot writes the full backup of the keys as the raft snapshot.
+//
+// NOTE: the backup is taken once it is persisted, so it might contain the
+// logs applied after the snapshot. They are applied only once after the
+// snapshot is restored, since the backup contains the applied index as well.
+type raftSnapshot struct {
+	BadgerDB *badger.DB
+}
+
+// Persist implements raft.FSMSnapshot.
+func (s *raftSnapshot) Persist(sink raft.SnapshotSink) error {
+	_, err := backup(s.BadgerDB, sink, 0)
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+// Release implements raft.FSMSnapshot.
+func (s *raftSnapshot) Release() {}
+
+// RaftStatus implements sdk.Storage.
+func (db *DB) RaftStatus() sdk.RaftStatus {
+	if db.raft == nil {
+		return sdk.RaftStatus{}
+	}
+	return db.raft.status()
+}
+
+// applyRaftLog runs fn within a read-write transaction which records the
+// index of the raft log, unless the log had been applied.
+func (db *DB) applyRaftLog(index uint64, fn func(tx *Tx) error) error {
+	for {
+		var tx *Tx
+
+		err := db.db.Update(func(txn *badger.Txn) error {
+			item, err := txn.Get(__RAFT_KEY)
+			if err != nil {
+				if !errors.Is(err, badger.ErrKeyNotFound) {
+					return err
+				}
+			} else {
+				var applied uint64 = 0
+				err = item.Value(func(val []byte) error {
+					applied = binary.BigEndian.Uint64(val)
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				if index <= applied {
+					return nil
+				}
+			}
+
+			tx = db.newTx(txn)
+			err = fn(tx)
+			if err != nil {
+				return err
+			}
+			return txn.Set(__RAFT_KEY, binary.BigEndian.AppendUint64(nil, index))
+		})
+		if errors.Is(err, badger.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if tx != nil {
+			db.notify(tx.events)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,171 @@
+package badger
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/hashicorp/raft"
+)
+
+const (
+	__RAFT_STORE_LOG    byte = 'l'
+	__RAFT_STORE_STABLE byte = 's'
+)
+
+var (
+	_ raft.LogStore    = new(RaftStore)
+	_ raft.StableStore = new(RaftStore)
+
+	// raft expects the error of the missing keys to be "not found"
+	errRaftKeyNotFound = errors.New("not found")
+)
+
+// RaftStore keeps the raft logs and the raft state in a badger database of
+// its own, apart from the keys which are dropped by the snapshots.
+type RaftStore struct {
+	BadgerDB *badger.DB
+}
+
+func encodeRaftLogKey(index uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte{__RAFT_STORE_LOG}, index)
+}
+
+func encodeRaftStableKey(key []byte) []byte {
+	return append([]byte{__RAFT_STORE_STABLE}, key...)
+}
+
+// FirstIndex implements raft.LogStore.
+func (s *RaftStore) FirstIndex() (uint64, error) {
+	return s.boundIndex(false)
+}
+
+// LastIndex implements raft.LogStore.
+func (s *RaftStore) LastIndex() (uint64, error) {
+	return s.boundIndex(true)
+}
+
+func (s *RaftStore) boundIndex(reverse bool) (uint64, error) {
+	var index uint64 = 0
+
+	err := s.BadgerDB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{
+			Reverse: reverse,
+			Prefix:  []byte{__RAFT_STORE_LOG},
+		})
+		defer it.Close()
+
+		if reverse {
+			it.Seek([]byte{__RAFT_STORE_LOG + 1})
+		} else {
+			it.Rewind()
+		}
+		if it.Valid() {
+			index = binary.BigEndian.Uint64(it.Item().Key()[1:])
+		}
+		return nil
+	})
+	return index, err
+}
+
+// GetLog implements raft.LogStore.
+func (s *RaftStore) GetLog(index uint64, log *raft.Log) error {
+	return s.BadgerDB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(encodeRaftLogKey(index))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return raft.ErrLogNotFound
+			}
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, log)
+		})
+	})
+}
+
+// StoreLog implements raft.LogStore.
+func (s *RaftStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs implements raft.LogStore.
+func (s *RaftStore) StoreLogs(logs []*raft.Log) error {
+	wb := s.BadgerDB.NewWriteBatch()
+	defer wb.Cancel()
+
+	for _, log := range logs {
+		val, err := json.Marshal(log)
+		if err != nil {
+			return err
+		}
+
+		err = wb.Set(encodeRaftLogKey(log.Index), val)
+		if err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+// DeleteRange implements raft.LogStore.
+func (s *RaftStore) DeleteRange(min, max uint64) error {
+	wb := s.BadgerDB.NewWriteBatch()
+	defer wb.Cancel()
+
+	for index := min; index <= max; index++ {
+		err := wb.Delete(encodeRaftLogKey(index))
+		if err != nil {
+			return err
+		}
+		if index == max {
+			break
+		}
+	}
+	return wb.Flush()
+}
+
+// Set implements raft.StableStore.
+func (s *RaftStore) Set(key []byte, val []byte) error {
+	return s.BadgerDB.Update(func(txn *badger.Txn) error {
+		return txn.Set(encodeRaftStableKey(key), val)
+	})
+}
+
+// Get implements raft.StableStore.
+func (s *RaftStore) Get(key []byte) ([]byte, error) {
+	var val []byte
+
+	err := s.BadgerDB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(encodeRaftStableKey(key))
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return errRaftKeyNotFound
+			}
+			return err
+		}
+
+		val, err = item.ValueCopy(nil)
+		return err
+	})
+	return val, err
+}
+
+// SetUint64 implements raft.StableStore.
+func (s *RaftStore) SetUint64(key []byte, val uint64) error {
+	return s.Set(key, binary.BigEndian.AppendUint64(nil, val))
+}
+
+// GetUint64 implements raft.StableStore.
+func (s *RaftStore) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(val) != 8 {
+		return 0, errRaftKeyNotFound
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
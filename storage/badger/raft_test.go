@@ -0,0 +1,141 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDB_Raft(t *testing.T) {
+	var peers []string
+	for i := 0; i < 3; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		peers = append(peers, fmt.Sprintf("n%d=%s", i, l.Addr()))
+		l.Close()
+	}
+
+	var nodes []*badger.DB
+	for i := range peers {
+		db := badger.New(&sdk.Config{
+			Engine:             "memory",
+			KeyDiscardInterval: 5 * time.Second,
+			KeyDiscardRatio:    0.7,
+			RaftNodeID:         fmt.Sprintf("n%d", i),
+			RaftPeers:          peers,
+		})
+		db.Start(context.Background())
+		defer db.Stop(context.Background())
+
+		nodes = append(nodes, db)
+	}
+
+	// leader waits until one of the nodes is the leader which serves reads
+	leader := func(nodes []*badger.DB) *badger.DB {
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			for _, db := range nodes {
+				if _, err := db.Get([]byte("a")); err == nil || errors.Is(err, sdk.ErrNil) {
+					return db
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatal("expect the leader to be elected")
+		return nil
+	}
+
+	db := leader(nodes)
+	if _, _, err := db.Set([]byte("a"), []byte("1"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.Set([]byte("b"), []byte("1"), sdk.SetOptions{Lease: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.IncrBy([]byte("a"), 2, 0, sdk.IntegerLessOrEqual(3)); err != nil || n != 3 {
+		t.Fatalf("expect 3, but got %d, %v", n, err)
+	}
+	if _, err := db.IncrBy([]byte("a"), 1, 0, sdk.IntegerLessOrEqual(3)); !errors.Is(err, sdk.ErrViolateConstraints) {
+		t.Fatalf("expect ErrViolateConstraints, but got %v", err)
+	}
+	if ok, err := db.Expire([]byte("a"), time.Hour); err != nil || !ok {
+		t.Fatalf("expect a to expire, but got %v, %v", ok, err)
+	}
+	if n, err := db.Del([]byte("b")); err != nil || n != 1 {
+		t.Fatalf("expect 1 key deleted, but got %d, %v", n, err)
+	}
+	if _, err := db.HSet([]byte("h"), sdk.FieldValue{Field: []byte("f"), Value: []byte("v")}); !errors.Is(err, sdk.ErrRaftUnsupported) {
+		t.Fatalf("expect ErrRaftUnsupported, but got %v", err)
+	}
+
+	// the followers redirect the clients to the leader
+	for _, node := range nodes {
+		if node == db {
+			continue
+		}
+		if _, _, err := node.Set([]byte("c"), []byte("1"), sdk.SetOptions{}); !errors.Is(err, sdk.ErrNotLeader) {
+			t.Errorf("expect ErrNotLeader, but got %v", err)
+		}
+	}
+
+	// the followers never serve the reads, which might be stale
+	reads := map[string]func(db *badger.DB) error{
+		"Get":    func(db *badger.DB) error { _, err := db.Get([]byte("a")); return err },
+		"Exists": func(db *badger.DB) error { _, err := db.Exists([]byte("a")); return err },
+		"MGet":   func(db *badger.DB) error { _, err := db.MGet([]byte("a")); return err },
+		"Ttl":    func(db *badger.DB) error { _, _, err := db.Ttl([]byte("a")); return err },
+		"Type":   func(db *badger.DB) error { _, err := db.Type([]byte("a")); return err },
+		"Scan":   func(db *badger.DB) error { _, _, err := db.Scan(nil, sdk.ScanOptions{Limit: 10}); return err },
+		"Watch":  func(db *badger.DB) error { _, err := db.Watch([]byte("a")); return err },
+		"Dump":   func(db *badger.DB) error { _, err := db.DumpKey([]byte("a")); return err },
+		"HGet":   func(db *badger.DB) error { _, err := db.HGet([]byte("h"), []byte("f")); return err },
+		"LRange": func(db *badger.DB) error { _, err := db.LRange([]byte("l"), 0, -1); return err },
+		"SCard":  func(db *badger.DB) error { _, err := db.SCard([]byte("s")); return err },
+		"ZRange": func(db *badger.DB) error { _, err := db.ZRange([]byte("z"), 0, -1, false); return err },
+		"QLen":   func(db *badger.DB) error { _, err := db.QLen([]byte("q")); return err },
+	}
+	for name, read := range reads {
+		for _, node := range nodes {
+			err := read(node)
+			if node == db {
+				if err != nil && !errors.Is(err, sdk.ErrNil) {
+					t.Errorf("%s: expect the leader to serve the read, but got %v", name, err)
+				}
+			} else if !errors.Is(err, sdk.ErrNotLeader) {
+				t.Errorf("%s: expect ErrNotLeader from the follower, but got %v", name, err)
+			}
+		}
+	}
+
+	// the acknowledged writes survive the loss of the leader
+	db.Stop(context.Background())
+
+	var rest []*badger.DB
+	for _, node := range nodes {
+		if node != db {
+			rest = append(rest, node)
+		}
+	}
+	db = leader(rest)
+
+	value, err := db.Get([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "3" {
+		t.Errorf("expect a = %q, but got %q", "3", value)
+	}
+	if n, err := db.Exists([]byte("b")); err != nil || n != 0 {
+		t.Errorf("expect b to be deleted, but got %d, %v", n, err)
+	}
+	if n, err := db.IncrBy([]byte("a"), -1, 0); err != nil || n != 2 {
+		t.Errorf("expect 2, but got %d, %v", n, err)
+	}
+}
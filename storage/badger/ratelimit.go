@@ -0,0 +1,230 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"encoding/binary"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// The state of rate limiters is kept in the metadata of the top-level key,
+// and the fields are used as follows.
+//
+//	fixed window: length is the count of the window starting at head
+//	sliding log:  length is the total cost of the log entries, which are
+//	              the elements keyed by their timestamps, and head is the
+//	              timestamp of the latest entry
+//	gcra:         head is the theoretical arrival time
+//
+// tail keeps the algorithm, and all timestamps are in nanoseconds.
+const (
+	__LIMITER_FIXED_WINDOW int64 = 1
+	__LIMITER_SLIDING_LOG  int64 = 2
+	__LIMITER_GCRA         int64 = 3
+)
+
+func limiterAlgorithm(name string) (int64, error) {
+	switch name {
+	case sdk.RATE_LIMIT_FIXED_WINDOW:
+		return __LIMITER_FIXED_WINDOW, nil
+	case sdk.RATE_LIMIT_SLIDING_LOG:
+		return __LIMITER_SLIDING_LOG, nil
+	case sdk.RATE_LIMIT_GCRA:
+		return __LIMITER_GCRA, nil
+	}
+	return 0, sdk.ErrUnknownAlgorithm
+}
+
+// RateLimit implements sdk.Operations.
+func (tx *Tx) RateLimit(key []byte, opts sdk.RateLimitOptions) (sdk.RateLimitResult, error) {
+	algorithm, err := limiterAlgorithm(opts.Algorithm)
+	if err != nil {
+		return sdk.RateLimitResult{}, err
+	}
+	// NOTE: the interval of gcra, i.e. period / limit, must not be zero.
+	if opts.Limit <= 0 || opts.Period <= 0 || (algorithm == __LIMITER_GCRA && int64(opts.Period) < opts.Limit) {
+		return sdk.RateLimitResult{}, sdk.ErrInvalidRateLimit
+	}
+
+	item, m, err := tx.lookupMetadata(key, __TYPE_LIMITER)
+	if err != nil {
+		return sdk.RateLimitResult{}, tx.check(err)
+	}
+	// NOTE: the limiter is reset if the algorithm is changed.
+	if item == nil || m.tail != algorithm {
+		m, err = tx.newMetadata()
+		if err != nil {
+			return sdk.RateLimitResult{}, tx.check(err)
+		}
+		m.tail = algorithm
+	}
+
+	var (
+		now        = time.Now().UnixNano()
+		period     = int64(opts.Period)
+		constraint = sdk.IntegerLessOrEqual(opts.Limit)
+
+		result    sdk.RateLimitResult
+		expiresAt int64
+	)
+
+	switch algorithm {
+	case __LIMITER_FIXED_WINDOW:
+		start := now - now%period
+		if m.head != start {
+			m.head = start
+			m.length = 0
+		}
+
+		result.Allowed = constraint.Check(m.length + opts.Cost)
+		if result.Allowed {
+			m.length += opts.Cost
+		} else {
+			result.RetryAfter = time.Duration(start + period - now)
+		}
+		result.Remaining = opts.Limit - m.length
+		result.ResetAfter = time.Duration(start + period - now)
+		expiresAt = start + period
+	case __LIMITER_SLIDING_LOG:
+		retryAt, err := tx.pruneLog(key, &m, now-period, opts.Limit-opts.Cost)
+		if err != nil {
+			return sdk.RateLimitResult{}, tx.check(err)
+		}
+
+		result.Allowed = constraint.Check(m.length + opts.Cost)
+		if result.Allowed && opts.Cost > 0 {
+			// NOTE: the timestamps of entries are unique
+			if now <= m.head {
+				now = m.head + 1
+			}
+			entry := badger.NewEntry(dataKey(key, m.id, binary.BigEndian.AppendUint64(nil, uint64(now))),
+				binary.BigEndian.AppendUint64(nil, uint64(opts.Cost))).
+				WithDiscard()
+
+			err = tx.txn.SetEntry(entry)
+			if err != nil {
+				return sdk.RateLimitResult{}, tx.check(err)
+			}
+			m.length += opts.Cost
+			m.head = now
+		}
+		if !result.Allowed {
+			result.RetryAfter = time.Duration(retryAt + period - now)
+		}
+		result.Remaining = opts.Limit - m.length
+		result.ResetAfter = time.Duration(m.head + period - now)
+		expiresAt = m.head + period
+	case __LIMITER_GCRA:
+		var (
+			interval = period / opts.Limit
+			tat      = m.head
+		)
+		if tat < now {
+			tat = now
+		}
+		next := tat + interval*opts.Cost
+
+		// NOTE: the request is allowed if the theoretical arrival time is
+		// no later than one period ahead.
+		result.Allowed = sdk.IntegerLessOrEqual(period).Check(next - now)
+		if result.Allowed {
+			tat = next
+			m.head = next
+		} else {
+			result.RetryAfter = time.Duration(next - period - now)
+		}
+		result.Remaining = (period - (tat - now)) / interval
+		result.ResetAfter = time.Duration(tat - now)
+		expiresAt = tat
+	}
+
+	if opts.Cost > opts.Limit {
+		result.RetryAfter = -1
+	}
+	if expiresAt <= now {
+		// NOTE: the limiter is fresh, e.g. peeking a gcra limiter with no cost
+		if item != nil {
+			err = tx.deleteKey(key)
+			if err != nil {
+				return sdk.RateLimitResult{}, tx.check(err)
+			}
+		}
+		return result, nil
+	}
+
+	entry := badger.NewEntry(encodeKey(key), m.encode()).
+		WithMeta(__TYPE_LIMITER).
+		WithDiscard()
+	entry.ExpiresAt = uint64((expiresAt + int64(time.Second) - 1) / int64(time.Second))
+
+	err = tx.setKey(entry)
+	if err != nil {
+		return sdk.RateLimitResult{}, tx.check(err)
+	}
+	return result, nil
+}
+
+// pruneLog deletes the entries of the sliding log at or before since. It
+// returns the timestamp of the entry, after which expires the total cost
+// of the log is no more than target.
+func (tx *Tx) pruneLog(key []byte, m *metadata, since int64, target int64) (int64, error) {
+	var (
+		prefix  = dataPrefix(key, m.id)
+		retryAt int64
+		total   = m.length
+	)
+
+	iterOpts := badger.DefaultIteratorOptions
+	iterOpts.Prefix = prefix
+
+	iter := tx.txn.NewIterator(iterOpts)
+	defer iter.Close()
+
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		item := iter.Item()
+
+		var cost int64
+		err := item.Value(func(val []byte) error {
+			if len(val) != 8 {
+				return errInvalidMetadata
+			}
+			cost = int64(binary.BigEndian.Uint64(val))
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		ts := int64(binary.BigEndian.Uint64(item.Key()[len(prefix):]))
+		if ts <= since {
+			err = tx.txn.Delete(item.KeyCopy(nil))
+			if err != nil {
+				return 0, err
+			}
+			m.length -= cost
+			total -= cost
+			continue
+		}
+		if total <= target {
+			break
+		}
+		total -= cost
+		retryAt = ts
+	}
+	return retryAt, nil
+}
+
+// RateLimit implements sdk.Storage. The transaction is retried on conflict,
+// so the concurrent requests are never rejected for conflict.
+func (db *DB) RateLimit(key []byte, opts sdk.RateLimitOptions) (result sdk.RateLimitResult, err error) {
+	if !db.running {
+		return sdk.RateLimitResult{}, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.updateRetry(func(txn *badger.Txn) error {
+		result, err = db.newTx(txn).RateLimit(key, opts)
+		return err
+	})
+	return result, err
+}
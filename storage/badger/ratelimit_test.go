@@ -0,0 +1,65 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDB_RateLimit(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	for _, algorithm := range []string{
+		sdk.RATE_LIMIT_FIXED_WINDOW,
+		sdk.RATE_LIMIT_SLIDING_LOG,
+		sdk.RATE_LIMIT_GCRA,
+	} {
+		var (
+			key  = []byte("limiter:" + algorithm)
+			opts = sdk.RateLimitOptions{
+				Algorithm: algorithm,
+				Limit:     3,
+				Period:    time.Hour,
+				Cost:      1,
+			}
+		)
+
+		for i := 0; i < 5; i++ {
+			result, err := db.RateLimit(key, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := i < 3; result.Allowed != expected {
+				t.Errorf("%s #%d: expect allowed %v, but got %v", algorithm, i, expected, result.Allowed)
+			}
+			if result.Allowed && result.Remaining != int64(2-i) {
+				t.Errorf("%s #%d: expect remaining %d, but got %d", algorithm, i, 2-i, result.Remaining)
+			}
+			if !result.Allowed && result.RetryAfter <= 0 {
+				t.Errorf("%s #%d: expect positive retry-after, but got %v", algorithm, i, result.RetryAfter)
+			}
+		}
+	}
+	// the options which would divide by zero are rejected
+	for _, opts := range []sdk.RateLimitOptions{
+		{Algorithm: sdk.RATE_LIMIT_FIXED_WINDOW, Limit: 1, Period: 0, Cost: 1},
+		{Algorithm: sdk.RATE_LIMIT_SLIDING_LOG, Limit: 1, Period: -time.Second, Cost: 1},
+		{Algorithm: sdk.RATE_LIMIT_GCRA, Limit: 0, Period: time.Second, Cost: 1},
+		{Algorithm: sdk.RATE_LIMIT_GCRA, Limit: 1000, Period: 999, Cost: 1},
+	} {
+		if _, err := db.RateLimit([]byte("limiter:invalid"), opts); !errors.Is(err, sdk.ErrInvalidRateLimit) {
+			t.Errorf("%v: expect ErrInvalidRateLimit, but got %v", opts, err)
+		}
+	}
+}
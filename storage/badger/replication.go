@@ -0,0 +1,362 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+)
+
+const (
+	__REPLICATION_HEARTBEAT_INTERVAL = time.Second
+
+	// the soft limit of the size of the batches, which is exceeded by the
+	// versions of a single key only
+	__REPLICATION_BATCH_SIZE = 4 << 20
+
+	// the bits of pb.KV.Meta written by badger backups
+	__BADGER_BIT_DELETE                   byte = 1 << 0
+	__BADGER_BIT_DISCARD_EARLIER_VERSIONS byte = 1 << 2
+)
+
+var (
+	// __REPLICATION_KEY keeps the primary and its version which had been
+	// applied to the replica. It is never replicated.
+	__REPLICATION_KEY = []byte{__NAMESPACE_SYSTEM, 'r', 'e', 'p', 'l'}
+)
+
+// ReadOnly implements sdk.Storage.
+func (db *DB) ReadOnly() bool {
+	return db.readOnly.Load()
+}
+
+// SetReadOnly implements sdk.Storage. The sequence is leased again once the
+// database becomes writable, since it might have been replicated.
+func (db *DB) SetReadOnly(readOnly bool) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if !db.running {
+		return sdk.ErrDatabaseUnavailable
+	}
+	if db.raft != nil {
+		return sdk.ErrRaftUnsupported
+	}
+	if !db.readOnly.Load() {
+		db.readOnly.Store(readOnly)
+		return nil
+	}
+	if readOnly {
+		return nil
+	}
+
+	err := db.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(__REPLICATION_KEY)
+	})
+	if err != nil {
+		return err
+	}
+
+	// NOTE: the former sequence is dropped without being released, which
+	// would write back its own lease over the replicated one.
+	seq, err := db.db.GetSequence(__SEQUENCE_KEY, __SEQUENCE_BANDWIDTH)
+	if err != nil {
+		return err
+	}
+	db.seq.Store(seq)
+	db.readOnly.Store(false)
+	return nil
+}
+
+// Replicate implements sdk.Storage. The changes are written in the format of
+// badger backups, which keeps the deletes and the expiry of the keys. The
+// badger subscription only wakes up the replication, which catches up with
+// every change since the last batch.
+//
+// The changes are streamed in the batches of about __REPLICATION_BATCH_SIZE,
+// and all but the last batch of the changes carry the version they are
+// applied on, so that the replica resumes from it again if the replication
+// fails in between, or fully synchronizes again if it is a full sync.
+func (db *DB) Replicate(ctx context.Context, since uint64, fn func(batch []byte, version uint64, full bool) error) error {
+	return db.stream(ctx, func(ctx context.Context) error {
+		return db.replicate(ctx, since, fn)
+	})
+}
+
+func (db *DB) replicate(ctx context.Context, since uint64, fn func(batch []byte, version uint64, full bool) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		signal = make(chan struct{}, 1)
+		errc   = make(chan error, 1)
+	)
+	go func() {
+		errc <- db.subscribe(ctx, func(*badger.KVList) error {
+			select {
+			case signal <- struct{}{}:
+			default:
+			}
+			return nil
+		}, []pb.Match{{Prefix: nil}})
+	}()
+
+	ticker := time.NewTicker(__REPLICATION_HEARTBEAT_INTERVAL)
+	defer ticker.Stop()
+
+	// NOTE: the replica is fully synchronized if it is ahead of the
+	// primary, e.g. the primary had been replaced, or if the versions since
+	// its version are no longer retained.
+	var full = since == 0 || since > db.db.MaxVersion() || since < db.historyTask.retained()
+	if full {
+		since = 0
+	}
+
+	for {
+		var first = full
+
+		w := &replicationWriter{
+			fn: func(batch []byte) error {
+				err := fn(batch, since, first)
+				first = false
+				return err
+			},
+		}
+		version, err := backup(db.db, w, since)
+		if err != nil {
+			return err
+		}
+		batch, err := w.close()
+		if err != nil {
+			return err
+		}
+
+		if first || version > since {
+			err = fn(batch, version, first)
+			since, full = version, false
+		} else {
+			err = fn(nil, since, false)
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errc:
+			return err
+		case <-signal:
+		case <-ticker.C:
+		}
+	}
+}
+
+// replicationWriter splits the backup written by badger into the batches of
+// about __REPLICATION_BATCH_SIZE, which are in the format of the backup as
+// well. The versions of a key are never split, since the replica applies
+// only the first one of each key in a batch. The latest batch is held back
+// until the next one is complete, so that the last batch is returned by
+// close, which is never empty unless nothing is written.
+type replicationWriter struct {
+	fn func(batch []byte) error
+
+	buf     []byte // written, but not parsed yet
+	list    pb.KVList
+	size    int
+	pending []byte
+}
+
+// Write implements io.Writer.
+func (w *replicationWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for len(w.buf) >= 8 {
+		size := binary.LittleEndian.Uint64(w.buf)
+		if size > uint64(len(w.buf)-8) {
+			break
+		}
+
+		var list pb.KVList
+		err := list.Unmarshal(w.buf[8 : 8+size])
+		if err != nil {
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[8+size:]...)
+
+		for _, kv := range list.Kv {
+			var last = len(w.list.Kv) - 1
+			if w.size >= __REPLICATION_BATCH_SIZE && !bytes.Equal(kv.Key, w.list.Kv[last].Key) {
+				err = w.flush()
+				if err != nil {
+					return 0, err
+				}
+			}
+			w.list.Kv = append(w.list.Kv, kv)
+			w.size += kv.Size()
+		}
+	}
+	return len(p), nil
+}
+
+// flush closes the batch of the listed changes, and sends the pending one.
+func (w *replicationWriter) flush() error {
+	buf, err := w.list.Marshal()
+	if err != nil {
+		return err
+	}
+	batch := binary.LittleEndian.AppendUint64(nil, uint64(len(buf)))
+	batch = append(batch, buf...)
+
+	w.list.Kv = nil
+	w.size = 0
+
+	if w.pending != nil {
+		err = w.fn(w.pending)
+		if err != nil {
+			return err
+		}
+	}
+	w.pending = batch
+	return nil
+}
+
+// close returns the last batch.
+func (w *replicationWriter) close() ([]byte, error) {
+	if len(w.buf) > 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if len(w.list.Kv) > 0 {
+		err := w.flush()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return w.pending, nil
+}
+
+// ReplicationVersion implements sdk.Storage.
+func (db *DB) ReplicationVersion(primary string) (uint64, error) {
+	var version uint64 = 0
+
+	err := db.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(__REPLICATION_KEY)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			if len(val) >= 8 && string(val[8:]) == primary {
+				version = binary.BigEndian.Uint64(val)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// ApplyReplication implements sdk.Storage. Only the latest version of each
+// key in the batch is applied, which is the first one written by badger.
+func (db *DB) ApplyReplication(primary string, batch []byte, version uint64, full bool) error {
+	if !db.running {
+		return sdk.ErrDatabaseUnavailable
+	}
+	if !db.readOnly.Load() {
+		return sdk.ErrNotReplica
+	}
+
+	if full {
+		err := db.db.DropAll()
+		if err != nil {
+			return err
+		}
+	}
+
+	wb := db.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	var (
+		r    = bytes.NewReader(batch)
+		last []byte
+	)
+	for {
+		var size uint64
+		err := binary.Read(r, binary.LittleEndian, &size)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		if size > uint64(r.Len()) {
+			return io.ErrUnexpectedEOF
+		}
+
+		var (
+			buf  = make([]byte, size)
+			list = &pb.KVList{}
+		)
+		r.Read(buf)
+		err = list.Unmarshal(buf)
+		if err != nil {
+			return err
+		}
+
+		for _, kv := range list.Kv {
+			if last != nil && bytes.Equal(kv.Key, last) {
+				continue
+			}
+			last = kv.Key
+
+			if bytes.Equal(kv.Key, __REPLICATION_KEY) {
+				continue
+			}
+			err = applyKV(wb, kv)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var value = binary.BigEndian.AppendUint64(nil, version)
+	value = append(value, primary...)
+	err := wb.Set(__REPLICATION_KEY, value)
+	if err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+func applyKV(wb *badger.WriteBatch, kv *pb.KV) error {
+	var meta, userMeta byte = 0, 0
+	if len(kv.Meta) > 0 {
+		meta = kv.Meta[0]
+	}
+	if len(kv.UserMeta) > 0 {
+		userMeta = kv.UserMeta[0]
+	}
+
+	if meta&__BADGER_BIT_DELETE != 0 {
+		return wb.Delete(kv.Key)
+	}
+
+	entry := badger.NewEntry(kv.Key, kv.Value).
+		WithMeta(userMeta)
+	entry.ExpiresAt = kv.ExpiresAt
+	if meta&__BADGER_BIT_DISCARD_EARLIER_VERSIONS != 0 {
+		entry = entry.WithDiscard()
+	}
+	return wb.SetEntry(entry)
+}
@@ -0,0 +1,291 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDB_Replicate(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	primary := badger.New(&config)
+	primary.Start(context.Background())
+	defer primary.Stop(context.Background())
+
+	replica := badger.New(&config)
+	replica.Start(context.Background())
+	defer replica.Stop(context.Background())
+
+	if err := replica.SetReadOnly(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := replica.Set([]byte("a"), []byte("1"), sdk.SetOptions{}); !errors.Is(err, sdk.ErrReadOnly) {
+		t.Fatalf("expect ErrReadOnly, but got %v", err)
+	}
+
+	if _, _, err := primary.Set([]byte("a"), []byte("1"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := primary.HSet([]byte("h"), sdk.FieldValue{Field: []byte("f"), Value: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// replicate applies the batches until the replica catches up with the
+	// primary at the given version
+	replicate := func(until uint64) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		since, err := replica.ReplicationVersion("primary")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = primary.Replicate(ctx, since, func(batch []byte, version uint64, full bool) error {
+			if err := replica.ApplyReplication("primary", batch, version, full); err != nil {
+				return err
+			}
+			if version >= until {
+				cancel()
+			}
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatal(err)
+		}
+	}
+
+	watches, err := primary.Watch([]byte("h"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicate(watches[0].Version)
+
+	if _, _, err := primary.Set([]byte("a"), []byte("2"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := primary.Del([]byte("h")); err != nil {
+		t.Fatal(err)
+	}
+	watches, err = primary.Watch([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicate(watches[0].Version)
+
+	value, err := replica.Get([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "2" {
+		t.Errorf("expect a = %q, but got %q", "2", value)
+	}
+	if typ, err := replica.Type([]byte("h")); err != nil || typ != sdk.TYPE_NONE {
+		t.Errorf("expect h to be deleted, but got %q, %v", typ, err)
+	}
+
+	// the promoted replica is writable, and forgets the primary
+	if err := replica.SetReadOnly(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replica.HSet([]byte("h"), sdk.FieldValue{Field: []byte("g"), Value: []byte("w")}); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := replica.ReplicationVersion("primary"); err != nil || version != 0 {
+		t.Errorf("expect version 0, but got %d, %v", version, err)
+	}
+}
+
+func TestDB_Replicate_Batches(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	primary := badger.New(&config)
+	primary.Start(context.Background())
+	defer primary.Stop(context.Background())
+
+	replica := badger.New(&config)
+	replica.Start(context.Background())
+	defer replica.Stop(context.Background())
+
+	if err := replica.SetReadOnly(true); err != nil {
+		t.Fatal(err)
+	}
+
+	var value = bytes.Repeat([]byte{'v'}, 256<<10)
+	for i := 0; i < 64; i++ {
+		if _, _, err := primary.Set([]byte(fmt.Sprintf("key:%02d", i)), value, sdk.SetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	watches, err := primary.Watch([]byte("key:63"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the full sync of 16MB is split into the batches, and all but the last
+	// one resume the full sync
+	type batch struct {
+		size    int
+		version uint64
+		full    bool
+	}
+	var batches []batch
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = primary.Replicate(ctx, 0, func(b []byte, version uint64, full bool) error {
+		if err := replica.ApplyReplication("primary", b, version, full); err != nil {
+			return err
+		}
+		batches = append(batches, batch{len(b), version, full})
+		if version >= watches[0].Version {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+
+	if len(batches) < 4 {
+		t.Fatalf("expect the full sync in batches, but got %+v", batches)
+	}
+	for i, b := range batches {
+		if b.size > 8<<20 {
+			t.Errorf("expect batch %d to be bounded, but got %+v", i, b)
+		}
+		if b.full != (i == 0) {
+			t.Errorf("expect the first batch only to be full, but got %+v", batches)
+		}
+		if i < len(batches)-1 && b.version != 0 {
+			t.Errorf("expect batch %d to resume the full sync, but got %+v", i, b)
+		}
+	}
+
+	for i := 0; i < 64; i++ {
+		v, err := replica.Get([]byte(fmt.Sprintf("key:%02d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(v, value) {
+			t.Errorf("expect key:%02d to be replicated, but got %d bytes", i, len(v))
+		}
+	}
+}
+
+func TestDB_Replicate_History(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+		HistoryRetention:   time.Millisecond,
+	}
+
+	primary := badger.New(&config)
+	primary.Start(context.Background())
+	defer primary.Stop(context.Background())
+
+	if _, _, err := primary.Set([]byte("a"), []byte("1"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	watches, err := primary.Watch([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := watches[0].Version
+
+	// replicate returns whether the replication from since is a full sync
+	replicate := func(since uint64) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var result bool
+		err := primary.Replicate(ctx, since, func(batch []byte, version uint64, full bool) error {
+			result = full
+			cancel()
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	if replicate(since) {
+		t.Errorf("expect the replication to resume from %d", since)
+	}
+
+	// the versions are retained for HistoryRetention only, which is renewed
+	// every second, so a is overwritten between the renewals
+	time.Sleep(1100 * time.Millisecond)
+	for _, value := range []string{"2", "3"} {
+		if _, _, err := primary.Set([]byte("a"), []byte(value), sdk.SetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(2500 * time.Millisecond)
+
+	if !replicate(since) {
+		t.Errorf("expect a full sync, since the changes since %d are no longer retained", since)
+	}
+}
+
+func TestDB_Replicate_Stop(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	primary := badger.New(&config)
+	primary.Start(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var (
+		synced     = make(chan struct{}, 1)
+		replicated = make(chan error, 1)
+	)
+	go func() {
+		replicated <- primary.Replicate(ctx, 0, func(batch []byte, version uint64, full bool) error {
+			select {
+			case synced <- struct{}{}:
+			default:
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case <-synced:
+	case <-ctx.Done():
+		t.Fatal("expect the replica to be synchronized")
+	}
+
+	// the replication ends with an error once the primary is stopped
+	primary.Stop(context.Background())
+
+	select {
+	case err := <-replicated:
+		if !errors.Is(err, sdk.ErrDatabaseUnavailable) {
+			t.Errorf("expect ErrDatabaseUnavailable, but got %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("expect the replication to end")
+	}
+}
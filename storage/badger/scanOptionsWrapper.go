@@ -13,6 +13,23 @@ func (opts ScanOptionsWrapper) apply(iterOpts *badger.IteratorOptions) {
 	if opts.PrefetchSize > 0 {
 		iterOpts.PrefetchSize = opts.PrefetchSize
 	}
-	iterOpts.Prefix = opts.Prefix
 	iterOpts.Reverse = opts.Reverse
+	if !opts.Reverse {
+		// NOTE: badger.Iterator stops at the first key without the prefix, so
+		// the prefix is checked by Scan instead while iterating in reverse.
+		iterOpts.Prefix = opts.Prefix
+	}
+}
+
+// prefixUpperBound returns the smallest key which is greater than all
+// keys with the prefix, or nil if there is no such key.
+func prefixUpperBound(prefix []byte) []byte {
+	bound := append([]byte{}, prefix...)
+	for i := len(bound) - 1; i >= 0; i-- {
+		if bound[i] < 0xff {
+			bound[i]++
+			return bound[:i+1]
+		}
+	}
+	return nil
 }
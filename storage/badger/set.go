@@ -0,0 +1,446 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"bytes"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// memberIterator iterates the members of a set in byte order. The iterator
+// of a missing set is always exhausted.
+type memberIterator struct {
+	iter   *badger.Iterator
+	prefix []byte
+}
+
+func (tx *Tx) newMemberIterator(key []byte) (*memberIterator, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_SET)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return &memberIterator{}, nil
+	}
+
+	var prefix = dataPrefix(key, m.id)
+
+	iterOpts := badger.DefaultIteratorOptions
+	iterOpts.PrefetchValues = false
+	iterOpts.Prefix = prefix
+
+	it := &memberIterator{
+		iter:   tx.txn.NewIterator(iterOpts),
+		prefix: prefix,
+	}
+	it.iter.Rewind()
+	return it, nil
+}
+
+func (it *memberIterator) valid() bool {
+	return it.iter != nil && it.iter.Valid()
+}
+
+// member returns the current member, which is only valid until the iterator
+// is moved.
+func (it *memberIterator) member() []byte {
+	return it.iter.Item().Key()[len(it.prefix):]
+}
+
+func (it *memberIterator) next() {
+	it.iter.Next()
+}
+
+// seek moves to the first member which is greater than or equal to member.
+func (it *memberIterator) seek(member []byte) {
+	if it.iter != nil {
+		it.iter.Seek(append(append([]byte{}, it.prefix...), member...))
+	}
+}
+
+func (it *memberIterator) close() {
+	if it.iter != nil {
+		it.iter.Close()
+	}
+}
+
+// newMemberIterators opens the iterators of the sets. The iterators must be
+// closed by closeMemberIterators.
+func (tx *Tx) newMemberIterators(keys [][]byte) ([]*memberIterator, error) {
+	var iterators = make([]*memberIterator, 0, len(keys))
+	for _, key := range keys {
+		it, err := tx.newMemberIterator(key)
+		if err != nil {
+			closeMemberIterators(iterators)
+			return nil, err
+		}
+		iterators = append(iterators, it)
+	}
+	return iterators, nil
+}
+
+func closeMemberIterators(iterators []*memberIterator) {
+	for _, it := range iterators {
+		it.close()
+	}
+}
+
+// SAdd implements sdk.Operations.
+func (tx *Tx) SAdd(key []byte, members ...[]byte) (int64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_SET)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		m, err = tx.newMetadata()
+		if err != nil {
+			return 0, tx.check(err)
+		}
+	}
+
+	var count int64 = 0
+	for _, member := range members {
+		k := dataKey(key, m.id, member)
+
+		_, err := tx.txn.Get(k)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, badger.ErrKeyNotFound) {
+			return 0, tx.check(err)
+		}
+
+		entry := badger.NewEntry(k, nil).
+			WithDiscard()
+
+		err = tx.txn.SetEntry(entry)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		count++
+	}
+
+	m.length += count
+	err = tx.setMetadata(key, __TYPE_SET, m, item)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	if count > 0 {
+		tx.emit("sadd", key)
+	}
+	return count, nil
+}
+
+// SCard implements sdk.Operations.
+func (tx *Tx) SCard(key []byte) (int64, error) {
+	_, m, err := tx.lookupMetadata(key, __TYPE_SET)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	return m.length, nil
+}
+
+// SDiff implements sdk.Operations.
+func (tx *Tx) SDiff(keys ...[]byte) ([][]byte, error) {
+	if len(keys) == 0 {
+		return [][]byte{}, nil
+	}
+
+	iterators, err := tx.newMemberIterators(keys)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	defer closeMemberIterators(iterators)
+
+	var (
+		reply  = [][]byte{}
+		first  = iterators[0]
+		others = iterators[1:]
+	)
+	for ; first.valid(); first.next() {
+		var (
+			member = first.member()
+			found  = false
+		)
+		for _, it := range others {
+			// NOTE: the members are visited in order, so the iterators only
+			// move forward.
+			it.seek(member)
+			if it.valid() && bytes.Equal(it.member(), member) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			reply = append(reply, append([]byte{}, member...))
+		}
+	}
+	return reply, nil
+}
+
+// SInter implements sdk.Operations.
+func (tx *Tx) SInter(keys ...[]byte) ([][]byte, error) {
+	if len(keys) == 0 {
+		return [][]byte{}, nil
+	}
+
+	iterators, err := tx.newMemberIterators(keys)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	defer closeMemberIterators(iterators)
+
+	var reply = [][]byte{}
+	for {
+		// find the greatest of the current members
+		var candidate []byte
+		for _, it := range iterators {
+			if !it.valid() {
+				return reply, nil
+			}
+			if candidate == nil || bytes.Compare(it.member(), candidate) > 0 {
+				candidate = append([]byte{}, it.member()...)
+			}
+		}
+
+		// move all iterators to the candidate
+		var matched = true
+		for _, it := range iterators {
+			it.seek(candidate)
+			if !it.valid() {
+				return reply, nil
+			}
+			if !bytes.Equal(it.member(), candidate) {
+				matched = false
+			}
+		}
+
+		if matched {
+			reply = append(reply, candidate)
+			for _, it := range iterators {
+				it.next()
+			}
+		}
+	}
+}
+
+// SIsMember implements sdk.Operations.
+func (tx *Tx) SIsMember(key []byte, member []byte) (bool, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_SET)
+	if err != nil {
+		return false, tx.check(err)
+	}
+	if item == nil {
+		return false, nil
+	}
+
+	_, err = tx.txn.Get(dataKey(key, m.id, member))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return false, nil
+		}
+		return false, tx.check(err)
+	}
+	return true, nil
+}
+
+// SMembers implements sdk.Operations.
+func (tx *Tx) SMembers(key []byte) ([][]byte, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_SET)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	if item == nil {
+		return [][]byte{}, nil
+	}
+
+	var reply = make([][]byte, 0, m.length)
+	_, err = tx.scanElements(dataPrefix(key, m.id), nil, sdk.ScanOptions{}, func(member []byte, item *badger.Item) error {
+		reply = append(reply, member)
+		return nil
+	})
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	return reply, nil
+}
+
+// SRem implements sdk.Operations.
+func (tx *Tx) SRem(key []byte, members ...[]byte) (int64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_SET)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		return 0, nil
+	}
+
+	var count int64 = 0
+	for _, member := range members {
+		k := dataKey(key, m.id, member)
+
+		_, err := tx.txn.Get(k)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			}
+			return 0, tx.check(err)
+		}
+
+		err = tx.txn.Delete(k)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		count++
+	}
+
+	m.length -= count
+	err = tx.setMetadata(key, __TYPE_SET, m, item)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	if count > 0 {
+		tx.emit("srem", key)
+		if m.length <= 0 {
+			tx.emit("del", key)
+		}
+	}
+	return count, nil
+}
+
+// SUnion implements sdk.Operations.
+func (tx *Tx) SUnion(keys ...[]byte) ([][]byte, error) {
+	iterators, err := tx.newMemberIterators(keys)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	defer closeMemberIterators(iterators)
+
+	var reply = [][]byte{}
+	for {
+		// find the least of the current members
+		var least []byte
+		for _, it := range iterators {
+			if it.valid() && (least == nil || bytes.Compare(it.member(), least) < 0) {
+				least = append([]byte{}, it.member()...)
+			}
+		}
+		if least == nil {
+			return reply, nil
+		}
+
+		reply = append(reply, least)
+		for _, it := range iterators {
+			if it.valid() && bytes.Equal(it.member(), least) {
+				it.next()
+			}
+		}
+	}
+}
+
+// SAdd implements sdk.Storage.
+func (db *DB) SAdd(key []byte, members ...[]byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		count, err = tx.SAdd(key, members...)
+		return err
+	})
+	return count, err
+}
+
+// SCard implements sdk.Storage.
+func (db *DB) SCard(key []byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		count, err = tx.SCard(key)
+		return err
+	})
+	return count, err
+}
+
+// SDiff implements sdk.Storage.
+func (db *DB) SDiff(keys ...[]byte) (members [][]byte, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		members, err = tx.SDiff(keys...)
+		return err
+	})
+	return members, err
+}
+
+// SInter implements sdk.Storage.
+func (db *DB) SInter(keys ...[]byte) (members [][]byte, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		members, err = tx.SInter(keys...)
+		return err
+	})
+	return members, err
+}
+
+// SIsMember implements sdk.Storage.
+func (db *DB) SIsMember(key []byte, member []byte) (ok bool, err error) {
+	if !db.running {
+		return false, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		ok, err = tx.SIsMember(key, member)
+		return err
+	})
+	return ok, err
+}
+
+// SMembers implements sdk.Storage.
+func (db *DB) SMembers(key []byte) (members [][]byte, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		members, err = tx.SMembers(key)
+		return err
+	})
+	return members, err
+}
+
+// SRem implements sdk.Storage.
+func (db *DB) SRem(key []byte, members ...[]byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		count, err = tx.SRem(key, members...)
+		return err
+	})
+	return count, err
+}
+
+// SUnion implements sdk.Storage.
+func (db *DB) SUnion(keys ...[]byte) (members [][]byte, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		members, err = tx.SUnion(keys...)
+		return err
+	})
+	return members, err
+}
@@ -0,0 +1,83 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDB_Set(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	var (
+		a = []byte("set:a")
+		b = []byte("set:b")
+		c = []byte("set:c")
+	)
+
+	count, err := db.SAdd(a, toBytes("1", "2", "3", "4", "2")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("expect 4 members added, but got %d", count)
+	}
+	if _, err := db.SAdd(b, toBytes("2", "4", "6")...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SAdd(c, toBytes("4", "5")...); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		fn       func(keys ...[]byte) ([][]byte, error)
+		keys     [][]byte
+		expected [][]byte
+	}{
+		{"SInter", db.SInter, [][]byte{a, b}, toBytes("2", "4")},
+		{"SInter", db.SInter, [][]byte{a, b, c}, toBytes("4")},
+		{"SInter", db.SInter, [][]byte{a, []byte("missing")}, toBytes()},
+		{"SUnion", db.SUnion, [][]byte{a, b, c}, toBytes("1", "2", "3", "4", "5", "6")},
+		{"SDiff", db.SDiff, [][]byte{a, b}, toBytes("1", "3")},
+		{"SDiff", db.SDiff, [][]byte{a, b, c}, toBytes("1", "3")},
+	}
+	for _, c := range cases {
+		members, err := c.fn(c.keys...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(members, c.expected) {
+			t.Errorf("%s %q: expect %q, but got %q", c.name, c.keys, c.expected, members)
+		}
+	}
+
+	count, err = db.SRem(c, toBytes("4", "5", "7")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expect 2 members removed, but got %d", count)
+	}
+	if n, _ := db.Exists(c); n != 0 {
+		t.Errorf("expect the empty set to be deleted")
+	}
+
+	if _, err := db.RPush([]byte("list"), []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SInter(a, []byte("list")); err != sdk.ErrWrongType {
+		t.Errorf("expect %v, but got %v", sdk.ErrWrongType, err)
+	}
+}
@@ -0,0 +1,315 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	__SNAPSHOT_FULL_FORMAT        = "full-%020d.snapshot"
+	__SNAPSHOT_INCREMENTAL_FORMAT = "incr-%020d-%020d.snapshot"
+	__SNAPSHOT_TEMP_FILE          = "snapshot.tmp"
+)
+
+// SnapshotTask writes the snapshots of the database into SnapshotPath. The
+// snapshots are named by their versions, so that the chains of a full
+// snapshot and its incremental snapshots are found from the directory.
+type SnapshotTask struct {
+	BadgerDB *badger.DB
+
+	SnapshotInterval     time.Duration
+	SnapshotPath         string
+	FullRetention        int
+	IncrementalRetention int
+
+	Logger badger.Logger
+
+	statusMutex sync.Mutex
+	status      sdk.SnapshotStatus
+
+	mutex       sync.Mutex
+	done        chan struct{}
+	stopped     chan struct{}
+	initialized bool
+	running     bool
+	disposed    bool
+}
+
+func (task *SnapshotTask) init() {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if task.initialized {
+		return
+	}
+
+	task.done = make(chan struct{})
+	task.stopped = make(chan struct{})
+	task.initialized = true
+}
+
+func (task *SnapshotTask) run() {
+	if !task.initialized {
+		panic(fmt.Sprintf("%T don't be initialized yet", task))
+	}
+
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if task.running || task.disposed {
+		return
+	}
+	task.running = true
+
+	ticker := time.NewTicker(task.SnapshotInterval)
+
+	go func() {
+		defer close(task.stopped)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-task.done:
+				return
+			case <-ticker.C:
+				task.snapshot()
+			}
+		}
+	}()
+}
+
+// stop stops the task, and waits until the snapshot being written is done,
+// since badger panics if it is closed while streaming.
+func (task *SnapshotTask) stop() {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+
+	if !task.disposed {
+		task.disposed = true
+		close(task.done)
+		if task.running {
+			<-task.stopped
+		}
+	}
+}
+
+// Status returns the results of the snapshots.
+func (task *SnapshotTask) Status() sdk.SnapshotStatus {
+	task.statusMutex.Lock()
+	defer task.statusMutex.Unlock()
+
+	return task.status
+}
+
+func (task *SnapshotTask) snapshot() {
+	path, version, err := task.write()
+
+	task.statusMutex.Lock()
+	if err != nil {
+		task.status.LastFailure = time.Now()
+		task.status.LastError = err.Error()
+		task.status.Failures++
+	} else {
+		task.status.LastSuccess = time.Now()
+		task.status.LastVersion = version
+		task.status.Successes++
+	}
+	task.statusMutex.Unlock()
+
+	if err != nil {
+		task.Logger.Errorf("snapshot: %v", err)
+	} else if path != "" {
+		task.Logger.Infof("Snapshot %s at version %d", path, version)
+	}
+}
+
+// write writes the next snapshot, which is a full snapshot unless the latest
+// chain has less incremental snapshots than retained, and prunes the chains
+// out of retention. The path is empty if nothing changed since the latest
+// snapshot.
+func (task *SnapshotTask) write() (path string, version uint64, err error) {
+	err = os.MkdirAll(task.SnapshotPath, 0o755)
+	if err != nil {
+		return "", 0, err
+	}
+
+	chains, err := listSnapshots(task.SnapshotPath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var full, since uint64 = 0, 0
+	if len(chains) > 0 {
+		chain := chains[len(chains)-1]
+		if len(chain.incrementals) < task.IncrementalRetention {
+			full, since = chain.full.version, chain.version()
+		}
+	}
+
+	temp := filepath.Join(task.SnapshotPath, __SNAPSHOT_TEMP_FILE)
+
+	f, err := os.Create(temp)
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(temp)
+
+	version, err = backup(task.BadgerDB, f, since)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	// NOTE: the full snapshot is skipped as well if nothing changed since
+	// the latest chain, which would be written to the same path otherwise,
+	// e.g. full-0 of an empty database.
+	if since > 0 && version == since {
+		return "", version, nil
+	}
+	if since == 0 && len(chains) > 0 && version == chains[len(chains)-1].version() {
+		return "", version, nil
+	}
+
+	if since == 0 {
+		path = filepath.Join(task.SnapshotPath, fmt.Sprintf(__SNAPSHOT_FULL_FORMAT, version))
+	} else {
+		path = filepath.Join(task.SnapshotPath, fmt.Sprintf(__SNAPSHOT_INCREMENTAL_FORMAT, full, version))
+	}
+	err = os.Rename(temp, path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// NOTE: the new full snapshot is counted in the retention
+	if since == 0 && len(chains) >= task.FullRetention {
+		for _, chain := range chains[:len(chains)-task.FullRetention+1] {
+			if chain.full.path == path {
+				continue
+			}
+			err = chain.remove()
+			if err != nil {
+				return path, version, err
+			}
+		}
+	}
+	return path, version, nil
+}
+
+type snapshotFile struct {
+	path    string
+	version uint64
+}
+
+type snapshotChain struct {
+	full         snapshotFile
+	incrementals []snapshotFile
+}
+
+// version returns the version of the latest snapshot of the chain.
+func (chain *snapshotChain) version() uint64 {
+	if len(chain.incrementals) > 0 {
+		return chain.incrementals[len(chain.incrementals)-1].version
+	}
+	return chain.full.version
+}
+
+// paths returns the paths of the snapshots in order of restoring.
+func (chain *snapshotChain) paths() []string {
+	var paths = []string{chain.full.path}
+	for _, f := range chain.incrementals {
+		paths = append(paths, f.path)
+	}
+	return paths
+}
+
+// remove removes the incremental snapshots of the chain before the full
+// snapshot, so that the chain is never left without its full snapshot.
+func (chain *snapshotChain) remove() error {
+	for i := len(chain.incrementals) - 1; i >= 0; i-- {
+		err := os.Remove(chain.incrementals[i].path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	err := os.Remove(chain.full.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// listSnapshots returns the chains of the snapshots in the directory in order
+// of versions. The incremental snapshots without their full snapshots are
+// ignored.
+func listSnapshots(dir string) ([]*snapshotChain, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var (
+		chains       = make(map[uint64]*snapshotChain)
+		incrementals = make(map[uint64][]snapshotFile)
+	)
+	for _, entry := range entries {
+		var (
+			name          = entry.Name()
+			full, version uint64
+		)
+		if n, _ := fmt.Sscanf(name, __SNAPSHOT_FULL_FORMAT, &version); n == 1 && name == fmt.Sprintf(__SNAPSHOT_FULL_FORMAT, version) {
+			chains[version] = &snapshotChain{
+				full: snapshotFile{
+					path:    filepath.Join(dir, name),
+					version: version,
+				},
+			}
+		} else if n, _ := fmt.Sscanf(name, __SNAPSHOT_INCREMENTAL_FORMAT, &full, &version); n == 2 && name == fmt.Sprintf(__SNAPSHOT_INCREMENTAL_FORMAT, full, version) {
+			incrementals[full] = append(incrementals[full], snapshotFile{
+				path:    filepath.Join(dir, name),
+				version: version,
+			})
+		}
+	}
+
+	var result = make([]*snapshotChain, 0, len(chains))
+	for full, chain := range chains {
+		chain.incrementals = incrementals[full]
+		sort.Slice(chain.incrementals, func(i, j int) bool {
+			return chain.incrementals[i].version < chain.incrementals[j].version
+		})
+		result = append(result, chain)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].full.version < result[j].full.version
+	})
+	return result, nil
+}
+
+// SnapshotFiles returns the paths of the latest full snapshot in dir and its
+// incremental snapshots, in order of restoring.
+func SnapshotFiles(dir string) ([]string, error) {
+	chains, err := listSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(chains) == 0 {
+		return nil, fmt.Errorf("no snapshots in %s", dir)
+	}
+	return chains[len(chains)-1].paths(), nil
+}
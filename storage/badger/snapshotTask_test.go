@@ -0,0 +1,157 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDB_Snapshot(t *testing.T) {
+	config := sdk.Config{
+		Engine:                       "memory",
+		KeyDiscardInterval:           5 * time.Second,
+		KeyDiscardRatio:              0.7,
+		SnapshotInterval:             20 * time.Millisecond,
+		SnapshotPath:                 t.TempDir(),
+		SnapshotFullRetention:        1,
+		SnapshotIncrementalRetention: 1,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	// set writes the key and waits until it is in a snapshot
+	set := func(key string) {
+		if _, _, err := db.Set([]byte(key), []byte(key), sdk.SetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		watches, err := db.Watch([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for db.SnapshotStatus().LastVersion < watches[0].Version {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect snapshot of %s, but got %+v", key, db.SnapshotStatus())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// full, incremental, and then full which prunes the former chain
+	set("a")
+	set("b")
+	set("c")
+	db.Stop(context.Background())
+
+	files, err := filepath.Glob(filepath.Join(config.SnapshotPath, "*.snapshot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := badger.SnapshotFiles(config.SnapshotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(paths) || len(paths) > 2 {
+		t.Errorf("expect the latest chain only, but got %q", files)
+	}
+
+	restored := badger.New(&sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	})
+	defer restored.Stop(context.Background())
+
+	var backups []io.Reader
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		backups = append(backups, f)
+	}
+	if err := restored.Restore(false, backups...); err != nil {
+		t.Fatal(err)
+	}
+	restored.Start(context.Background())
+
+	values, err := restored.MGet([]byte("a"), []byte("b"), []byte("c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range []string{"a", "b", "c"} {
+		if string(values[i]) != key {
+			t.Errorf("expect %s = %q, but got %q", key, key, values[i])
+		}
+	}
+}
+
+func TestDB_Snapshot_Idle(t *testing.T) {
+	config := sdk.Config{
+		Engine:                       "memory",
+		KeyDiscardInterval:           5 * time.Second,
+		KeyDiscardRatio:              0.7,
+		SnapshotInterval:             20 * time.Millisecond,
+		SnapshotPath:                 t.TempDir(),
+		SnapshotFullRetention:        1,
+		SnapshotIncrementalRetention: 0,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	// expect checks that the latest full snapshot is kept by the ticks after
+	// it, in which nothing changed
+	expect := func(version uint64) {
+		deadline := time.Now().Add(5 * time.Second)
+		for db.SnapshotStatus().Successes < 1 || db.SnapshotStatus().LastVersion < version {
+			if time.Now().After(deadline) {
+				t.Fatalf("expect snapshot at version %d, but got %+v", version, db.SnapshotStatus())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		successes := db.SnapshotStatus().Successes
+		for db.SnapshotStatus().Successes < successes+5 {
+			paths, err := badger.SnapshotFiles(config.SnapshotPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(paths) != 1 {
+				t.Fatalf("expect a full snapshot, but got %q", paths)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		files, err := filepath.Glob(filepath.Join(config.SnapshotPath, "*.snapshot"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 {
+			t.Errorf("expect a full snapshot, but got %q", files)
+		}
+	}
+
+	// the empty database
+	expect(0)
+
+	if _, _, err := db.Set([]byte("a"), []byte("a"), sdk.SetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	watches, err := db.Watch([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(watches[0].Version)
+}
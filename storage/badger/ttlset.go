@@ -0,0 +1,225 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// The members of ttl sets expire by the badger entry TTL one by one, so the
+// number of members is unknown without counting. The length of the metadata
+// counts the members added and not removed, including the expired ones, and
+// the top-level key expires with the last member instead of being deleted
+// when the set is empty.
+
+// TSAdd implements sdk.Operations.
+func (tx *Tx) TSAdd(key []byte, lease time.Duration, members ...[]byte) (int64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_TTLSET)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		m, err = tx.newMetadata()
+		if err != nil {
+			return 0, tx.check(err)
+		}
+	}
+
+	var (
+		count  int64  = 0
+		expiry uint64 = expiresAt(time.Now().Add(lease))
+	)
+	for _, member := range members {
+		k := dataKey(key, m.id, member)
+
+		// the existing members are written again to refresh their expiry
+		_, err := tx.txn.Get(k)
+		if err != nil {
+			if !errors.Is(err, badger.ErrKeyNotFound) {
+				return 0, tx.check(err)
+			}
+			count++
+		}
+
+		entry := badger.NewEntry(k, nil).
+			WithDiscard()
+		entry.ExpiresAt = expiry
+
+		err = tx.txn.SetEntry(entry)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+	}
+	m.length += count
+
+	// NOTE: the top-level key lives as long as the last member, unless it
+	// has been persisted.
+	entry := badger.NewEntry(encodeKey(key), m.encode()).
+		WithMeta(__TYPE_TTLSET).
+		WithDiscard()
+	entry.ExpiresAt = expiry
+	if item != nil && (item.ExpiresAt() == 0 || item.ExpiresAt() > expiry) {
+		entry.ExpiresAt = item.ExpiresAt()
+	}
+
+	err = tx.setKey(entry)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	if len(members) > 0 {
+		tx.emit("tsadd", key)
+	}
+	return count, nil
+}
+
+// TSCard implements sdk.Operations.
+func (tx *Tx) TSCard(key []byte) (int64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_TTLSET)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		return 0, nil
+	}
+
+	var count int64 = 0
+	_, err = tx.scanElements(dataPrefix(key, m.id), nil, sdk.ScanOptions{}, func(member []byte, item *badger.Item) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	return count, nil
+}
+
+// TSIsMember implements sdk.Operations.
+func (tx *Tx) TSIsMember(key []byte, member []byte) (bool, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_TTLSET)
+	if err != nil {
+		return false, tx.check(err)
+	}
+	if item == nil {
+		return false, nil
+	}
+
+	_, err = tx.txn.Get(dataKey(key, m.id, member))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return false, nil
+		}
+		return false, tx.check(err)
+	}
+	return true, nil
+}
+
+// TSRem implements sdk.Operations.
+func (tx *Tx) TSRem(key []byte, members ...[]byte) (int64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_TTLSET)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		return 0, nil
+	}
+
+	var count int64 = 0
+	for _, member := range members {
+		k := dataKey(key, m.id, member)
+
+		_, err := tx.txn.Get(k)
+		if err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			}
+			return 0, tx.check(err)
+		}
+
+		err = tx.txn.Delete(k)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		count++
+	}
+
+	// delete the set if no member is left
+	var remaining = false
+	_, err = tx.scanElements(dataPrefix(key, m.id), nil, sdk.ScanOptions{Limit: 1}, func(member []byte, item *badger.Item) error {
+		remaining = true
+		return nil
+	})
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	m.length -= count
+	if !remaining {
+		m.length = 0
+	}
+	err = tx.setMetadata(key, __TYPE_TTLSET, m, item)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	if count > 0 {
+		tx.emit("tsrem", key)
+	}
+	if m.length <= 0 {
+		tx.emit("del", key)
+	}
+	return count, nil
+}
+
+// TSAdd implements sdk.Storage.
+func (db *DB) TSAdd(key []byte, lease time.Duration, members ...[]byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		count, err = tx.TSAdd(key, lease, members...)
+		return err
+	})
+	return count, err
+}
+
+// TSCard implements sdk.Storage.
+func (db *DB) TSCard(key []byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		count, err = tx.TSCard(key)
+		return err
+	})
+	return count, err
+}
+
+// TSIsMember implements sdk.Storage.
+func (db *DB) TSIsMember(key []byte, member []byte) (ok bool, err error) {
+	if !db.running {
+		return false, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		ok, err = tx.TSIsMember(key, member)
+		return err
+	})
+	return ok, err
+}
+
+// TSRem implements sdk.Storage.
+func (db *DB) TSRem(key []byte, members ...[]byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		count, err = tx.TSRem(key, members...)
+		return err
+	})
+	return count, err
+}
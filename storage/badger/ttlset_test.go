@@ -0,0 +1,87 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDB_TTLSet(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	var (
+		key    = []byte("ttlset:a")
+		events []string
+	)
+	db.Listen(func(event sdk.KeyEvent) {
+		events = append(events, event.Event)
+	})
+
+	count, err := db.TSAdd(key, time.Second, toBytes("a", "b")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expect 2 members added, but got %d", count)
+	}
+
+	// the existing member is not counted, but its expiry is refreshed
+	count, err = db.TSAdd(key, time.Hour, toBytes("a", "c")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expect 1 member added, but got %d", count)
+	}
+	if count, err := db.TSCard(key); err != nil || count != 3 {
+		t.Errorf("expect 3 members, but got %d, %v", count, err)
+	}
+
+	time.Sleep(2100 * time.Millisecond)
+
+	for member, expected := range map[string]bool{"a": true, "b": false, "c": true} {
+		ok, err := db.TSIsMember(key, []byte(member))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != expected {
+			t.Errorf("expect %s to be a member: %v, but got %v", member, expected, ok)
+		}
+	}
+	if count, err := db.TSCard(key); err != nil || count != 2 {
+		t.Errorf("expect 2 members, but got %d, %v", count, err)
+	}
+
+	// the set is deleted with the last live member
+	count, err = db.TSRem(key, toBytes("a", "b")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expect 1 member removed, but got %d", count)
+	}
+	if n, err := db.Exists(key); err != nil || n != 1 {
+		t.Errorf("expect the set to exist, but got %d, %v", n, err)
+	}
+	if _, err := db.TSRem(key, []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.Exists(key); err != nil || n != 0 {
+		t.Errorf("expect the set to be deleted, but got %d, %v", n, err)
+	}
+
+	if expected := []string{"tsadd", "tsadd", "tsrem", "tsrem", "del"}; !reflect.DeepEqual(events, expected) {
+		t.Errorf("expect events %v, but got %v", expected, events)
+	}
+}
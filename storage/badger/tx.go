@@ -0,0 +1,784 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"bytes"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+var (
+	_ sdk.Operations = new(Tx)
+)
+
+// Tx executes sdk.Operations within a single badger transaction.
+type Tx struct {
+	txn *badger.Txn
+	seq *badger.Sequence
+
+	// err keeps the first error which is not a sdk.Error, or
+	// sdk.ErrReadOnly of a write. Such error means the transaction cannot
+	// be committed.
+	err error
+
+	// events are sent to the listeners after the transaction is committed.
+	events []sdk.KeyEvent
+}
+
+// lookup returns the item of the top-level key, or nil if the key does
+// not exist. It returns sdk.ErrWrongType if the key holds a value of
+// other type than meta; the type is not checked if meta is zero.
+func (tx *Tx) lookup(key []byte, meta byte) (*badger.Item, error) {
+	item, err := tx.txn.Get(encodeKey(key))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if meta != 0 && item.UserMeta() != meta {
+		return nil, sdk.ErrWrongType
+	}
+	return item, nil
+}
+
+// lookupMetadata returns the item and the metadata of the collection at
+// key. The item is nil if the key does not exist.
+func (tx *Tx) lookupMetadata(key []byte, meta byte) (*badger.Item, metadata, error) {
+	item, err := tx.lookup(key, meta)
+	if err != nil || item == nil {
+		return nil, metadata{}, err
+	}
+
+	var m metadata
+	err = item.Value(func(val []byte) error {
+		m, err = decodeMetadata(val)
+		return err
+	})
+	if err != nil {
+		return nil, metadata{}, err
+	}
+	return item, m, nil
+}
+
+// newMetadata returns the metadata of a new collection.
+func (tx *Tx) newMetadata() (metadata, error) {
+	if tx.seq == nil {
+		return metadata{}, badger.ErrReadOnlyTxn
+	}
+	id, err := tx.seq.Next()
+	if err != nil {
+		return metadata{}, err
+	}
+	return metadata{id: id}, nil
+}
+
+// setMetadata writes the metadata of the collection at key and retains the
+// expiry of item. The key is deleted if the collection becomes empty.
+func (tx *Tx) setMetadata(key []byte, meta byte, m metadata, item *badger.Item) error {
+	if m.length <= 0 {
+		if item == nil {
+			return nil
+		}
+		return tx.deleteKey(key)
+	}
+
+	entry := badger.NewEntry(encodeKey(key), m.encode()).
+		WithMeta(meta).
+		WithDiscard()
+
+	if item != nil {
+		entry.ExpiresAt = item.ExpiresAt()
+	}
+	return tx.setKey(entry)
+}
+
+// setKey writes the entry of the top-level key, along with the entry which
+// indexes the key by its hash slot and expires at the same time.
+func (tx *Tx) setKey(entry *badger.Entry) error {
+	err := tx.txn.SetEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	index := badger.NewEntry(slotKey(decodeKey(entry.Key)), nil).
+		WithDiscard()
+	index.ExpiresAt = entry.ExpiresAt
+
+	return tx.txn.SetEntry(index)
+}
+
+// deleteKey deletes the top-level key along with its entry of the slot index.
+func (tx *Tx) deleteKey(key []byte) error {
+	err := tx.txn.Delete(encodeKey(key))
+	if err != nil {
+		return err
+	}
+	return tx.txn.Delete(slotKey(key))
+}
+
+// emit records the event of key.
+func (tx *Tx) emit(event string, key []byte) {
+	tx.events = append(tx.events, sdk.KeyEvent{
+		Event: event,
+		Key:   append([]byte{}, key...),
+	})
+}
+
+func (tx *Tx) check(err error) error {
+	if errors.Is(err, badger.ErrReadOnlyTxn) {
+		// the database is read-only, so the transaction fails as a whole
+		if tx.err == nil {
+			tx.err = sdk.ErrReadOnly
+		}
+		return sdk.ErrReadOnly
+	}
+	if err != nil && tx.err == nil {
+		var e sdk.Error
+		if !errors.As(err, &e) {
+			tx.err = err
+		}
+	}
+	return err
+}
+
+// Del implements sdk.Operations.
+func (tx *Tx) Del(keys ...[]byte) (int64, error) {
+	var count int64 = 0
+
+	for _, key := range keys {
+		item, err := tx.lookup(key, 0)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		if item == nil {
+			continue
+		}
+
+		err = tx.deleteKey(key)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		count++
+		tx.emit("del", key)
+	}
+	return count, nil
+}
+
+// Exists implements sdk.Operations.
+func (tx *Tx) Exists(keys ...[]byte) (int64, error) {
+	var count int64 = 0
+
+	for _, key := range keys {
+		item, err := tx.lookup(key, 0)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		if item == nil {
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Expire implements sdk.Operations.
+func (tx *Tx) Expire(key []byte, lease time.Duration) (bool, error) {
+	item, err := tx.lookup(key, 0)
+	if err != nil {
+		return false, tx.check(err)
+	}
+	if item == nil {
+		return false, nil
+	}
+
+	err = item.Value(func(val []byte) error {
+		entry := badger.NewEntry(item.KeyCopy(nil), val).
+			WithMeta(item.UserMeta()).
+			WithDiscard().
+			WithTTL(lease)
+
+		return tx.setKey(entry)
+	})
+	if err != nil {
+		return false, tx.check(err)
+	}
+	tx.emit("expire", key)
+	return true, nil
+}
+
+// Get implements sdk.Operations.
+func (tx *Tx) Get(key []byte) ([]byte, error) {
+	item, err := tx.lookup(key, __TYPE_STRING)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	if item == nil {
+		return nil, sdk.ErrNil
+	}
+
+	reply, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	return reply, nil
+}
+
+// IncrBy implements sdk.Operations.
+func (tx *Tx) IncrBy(key []byte, increment int64, lease time.Duration, constraints ...sdk.Constraint[int64]) (int64, error) {
+	var result int64 = 0
+
+	item, err := tx.lookup(key, __TYPE_STRING)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	var value []byte
+	{
+		var number int64 = 0
+
+		if item != nil {
+			err = item.Value(func(val []byte) error {
+				n, err := strconv.ParseInt(string(val), 10, 64)
+				if err != nil {
+					return sdk.ErrNonInteger
+				}
+
+				number = n
+				return nil
+			})
+			if err != nil {
+				return 0, tx.check(err)
+			}
+		}
+
+		// add increment & export
+		result = number + increment
+
+		// check
+		for _, constraint := range constraints {
+			ok := constraint.Check(result)
+			if !ok {
+				return 0, sdk.ErrViolateConstraints
+			}
+		}
+
+		// export
+		value = []byte(strconv.FormatInt(result, 10))
+	}
+
+	entry := badger.NewEntry(encodeKey(key), value).
+		WithMeta(__TYPE_STRING).
+		WithDiscard()
+
+	// the lease applies to new keys only
+	if item != nil {
+		entry.ExpiresAt = item.ExpiresAt()
+	} else if lease > 0 {
+		entry.ExpiresAt = expiresAt(time.Now().Add(lease))
+	}
+
+	err = tx.setKey(entry)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	tx.emit("incrby", key)
+	return result, nil
+}
+
+// IncrByFloat implements sdk.Operations.
+func (tx *Tx) IncrByFloat(key []byte, increment float64, lease time.Duration, constraints ...sdk.Constraint[float64]) (float64, error) {
+	var result float64 = 0
+
+	item, err := tx.lookup(key, __TYPE_STRING)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	var value []byte
+	{
+		var number float64 = 0
+
+		if item != nil {
+			err = item.Value(func(val []byte) error {
+				n, err := strconv.ParseFloat(string(val), 64)
+				if err != nil {
+					return sdk.ErrNonInteger
+				}
+
+				number = n
+				return nil
+			})
+			if err != nil {
+				return 0, tx.check(err)
+			}
+		}
+
+		// add increment & export
+		result = number + increment
+
+		// check
+		for _, constraint := range constraints {
+			ok := constraint.Check(result)
+			if !ok {
+				return 0, sdk.ErrViolateConstraints
+			}
+		}
+
+		// export
+		value = []byte(strconv.FormatFloat(result, 'f', 4, 64))
+	}
+
+	entry := badger.NewEntry(encodeKey(key), value).
+		WithMeta(__TYPE_STRING).
+		WithDiscard()
+
+	// the lease applies to new keys only
+	if item != nil {
+		entry.ExpiresAt = item.ExpiresAt()
+	} else if lease > 0 {
+		entry.ExpiresAt = expiresAt(time.Now().Add(lease))
+	}
+
+	err = tx.setKey(entry)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	tx.emit("incrbyfloat", key)
+	return result, nil
+}
+
+// MGet implements sdk.Operations.
+func (tx *Tx) MGet(keys ...[]byte) ([][]byte, error) {
+	var reply = make([][]byte, len(keys))
+
+	for i, key := range keys {
+		item, err := tx.lookup(key, __TYPE_STRING)
+		if err != nil {
+			if errors.Is(err, sdk.ErrWrongType) {
+				continue
+			}
+			return nil, tx.check(err)
+		}
+		if item == nil {
+			continue
+		}
+
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, tx.check(err)
+		}
+		if value == nil {
+			value = []byte{}
+		}
+		reply[i] = value
+	}
+	return reply, nil
+}
+
+// MSet implements sdk.Operations.
+func (tx *Tx) MSet(kvs ...sdk.KeyValue) error {
+	for _, kv := range kvs {
+		entry := badger.NewEntry(encodeKey(kv.Key), kv.Value).
+			WithMeta(__TYPE_STRING).
+			WithDiscard()
+
+		err := tx.setKey(entry)
+		if err != nil {
+			return tx.check(err)
+		}
+		tx.emit("set", kv.Key)
+	}
+	return nil
+}
+
+// MSetNX implements sdk.Operations.
+func (tx *Tx) MSetNX(kvs ...sdk.KeyValue) (bool, error) {
+	for _, kv := range kvs {
+		item, err := tx.lookup(kv.Key, 0)
+		if err != nil {
+			return false, tx.check(err)
+		}
+		if item != nil {
+			return false, nil
+		}
+	}
+
+	err := tx.MSet(kvs...)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Persist implements sdk.Operations.
+func (tx *Tx) Persist(key []byte) (bool, error) {
+	item, err := tx.lookup(key, 0)
+	if err != nil {
+		return false, tx.check(err)
+	}
+	if item == nil {
+		return false, nil
+	}
+
+	err = item.Value(func(val []byte) error {
+		entry := badger.NewEntry(item.KeyCopy(nil), val).
+			WithMeta(item.UserMeta()).
+			WithDiscard()
+
+		return tx.setKey(entry)
+	})
+	if err != nil {
+		return false, tx.check(err)
+	}
+	tx.emit("persist", key)
+	return true, nil
+}
+
+// Scan implements sdk.Operations.
+func (tx *Tx) Scan(cursor []byte, opts sdk.ScanOptions) (kvs [][]byte, next []byte, err error) {
+	// narrow the prefix by the literal prefix of the pattern
+	if len(opts.Match) > 0 {
+		literal := sdk.PatternPrefix(opts.Match)
+		switch {
+		case bytes.HasPrefix(literal, opts.Prefix):
+			opts.Prefix = literal
+		case bytes.HasPrefix(opts.Prefix, literal):
+			// the prefix is narrower
+		default:
+			// no key matches both the prefix and the pattern
+			return nil, nil, nil
+		}
+	}
+
+	// iterate the top-level keys only
+	opts.Prefix = encodeKey(opts.Prefix)
+	if len(opts.EndKey) > 0 {
+		opts.EndKey = encodeKey(opts.EndKey)
+	}
+	if len(cursor) > 0 {
+		cursor = encodeKey(cursor)
+	}
+
+	iterOpts := badger.DefaultIteratorOptions
+	ScanOptionsWrapper(opts).apply(&iterOpts)
+
+	iter := tx.txn.NewIterator(iterOpts)
+	defer iter.Close()
+
+	switch {
+	case len(cursor) > 0:
+		iter.Seek(cursor)
+	case opts.Reverse:
+		iter.Seek(prefixUpperBound(opts.Prefix))
+	default:
+		iter.Rewind()
+	}
+
+	// NOTE: the limit bounds the keys examined rather than the keys replied,
+	// as COUNT of Redis does, so that a sparse MATCH or TYPE never walks the
+	// whole keyspace within a single call.
+	var examined int = 0
+	for ; iter.Valid(); iter.Next() {
+		item := iter.Item()
+		key := item.Key()
+
+		if !bytes.HasPrefix(key, opts.Prefix) {
+			if opts.Reverse && bytes.Compare(key, opts.Prefix) > 0 {
+				// the key is greater than all keys with the prefix
+				continue
+			}
+			break
+		}
+		if len(opts.EndKey) > 0 {
+			c := bytes.Compare(key, opts.EndKey)
+			if (!opts.Reverse && c >= 0) || (opts.Reverse && c <= 0) {
+				break
+			}
+		}
+		if opts.Limit > 0 && examined >= opts.Limit {
+			next = decodeKey(item.KeyCopy(nil))
+			break
+		}
+		examined++
+
+		if opts.PrefetchValues && (item.ValueSize() == 0 || item.UserMeta() != __TYPE_STRING) {
+			continue
+		}
+		if len(opts.Match) > 0 && !sdk.MatchPattern(opts.Match, decodeKey(key)) {
+			continue
+		}
+		if len(opts.Type) > 0 && typeName(item.UserMeta()) != opts.Type {
+			continue
+		}
+
+		if opts.PrefetchValues {
+			var val []byte = make([]byte, item.ValueSize())
+
+			_, err := item.ValueCopy(val)
+			if err != nil {
+				return nil, nil, tx.check(err)
+			}
+
+			kvs = append(kvs, decodeKey(item.KeyCopy(nil)), val)
+		} else {
+			kvs = append(kvs, decodeKey(item.KeyCopy(nil)))
+		}
+	}
+	return kvs, next, nil
+}
+
+// Set implements sdk.Operations.
+func (tx *Tx) Set(key []byte, value []byte, opts sdk.SetOptions) (ok bool, old []byte, err error) {
+	item, err := tx.lookup(key, 0)
+	if err != nil {
+		return false, nil, tx.check(err)
+	}
+
+	if item != nil && opts.ReturnOld {
+		if item.UserMeta() != __TYPE_STRING {
+			return false, nil, sdk.ErrWrongType
+		}
+		old, err = item.ValueCopy(nil)
+		if err != nil {
+			return false, nil, tx.check(err)
+		}
+		if old == nil {
+			old = []byte{}
+		}
+	}
+
+	// check conditions
+	if opts.IfNotExists && item != nil {
+		return false, old, nil
+	}
+	if opts.IfExists && item == nil {
+		return false, old, nil
+	}
+
+	entry := badger.NewEntry(encodeKey(key), value).
+		WithMeta(__TYPE_STRING).
+		WithDiscard()
+
+	switch {
+	case opts.KeepTTL:
+		if item != nil {
+			entry.ExpiresAt = item.ExpiresAt()
+		}
+	case !opts.ExpireAt.IsZero():
+		entry.ExpiresAt = expiresAt(opts.ExpireAt)
+	case opts.Lease > 0:
+		entry.ExpiresAt = expiresAt(time.Now().Add(opts.Lease))
+	}
+
+	err = tx.setKey(entry)
+	if err != nil {
+		return false, nil, tx.check(err)
+	}
+	tx.emit("set", key)
+	if entry.ExpiresAt > 0 && !opts.KeepTTL {
+		tx.emit("expire", key)
+	}
+	return true, old, nil
+}
+
+// Transfer implements sdk.Operations.
+func (tx *Tx) Transfer(source, destination []byte, amount int64, sourceConstraints, destinationConstraints []sdk.Constraint[int64]) (int64, int64, error) {
+	var (
+		sourceValue      int64
+		destinationValue int64
+	)
+
+	sourceItem, err := tx.getInteger(source, &sourceValue)
+	if err != nil {
+		return 0, 0, tx.check(err)
+	}
+	destinationItem, err := tx.getInteger(destination, &destinationValue)
+	if err != nil {
+		return 0, 0, tx.check(err)
+	}
+
+	if bytes.Equal(source, destination) {
+		// transfer to itself doesn't change the value
+		destinationValue = sourceValue
+	} else {
+		sourceValue -= amount
+		destinationValue += amount
+	}
+
+	// check
+	for _, constraint := range sourceConstraints {
+		if !constraint.Check(sourceValue) {
+			return 0, 0, sdk.ErrViolateConstraints
+		}
+	}
+	for _, constraint := range destinationConstraints {
+		if !constraint.Check(destinationValue) {
+			return 0, 0, sdk.ErrViolateConstraints
+		}
+	}
+
+	if !bytes.Equal(source, destination) {
+		err = tx.setInteger(source, sourceValue, sourceItem)
+		if err != nil {
+			return 0, 0, tx.check(err)
+		}
+		err = tx.setInteger(destination, destinationValue, destinationItem)
+		if err != nil {
+			return 0, 0, tx.check(err)
+		}
+		tx.emit("decrby", source)
+		tx.emit("incrby", destination)
+	}
+	return sourceValue, destinationValue, nil
+}
+
+// CountKeysInSlot implements sdk.Operations. The keys are counted by the
+// slot index without reading them.
+func (tx *Tx) CountKeysInSlot(slot int) (int64, error) {
+	iterOpts := badger.DefaultIteratorOptions
+	iterOpts.PrefetchValues = false
+	iterOpts.Prefix = slotPrefix(slot)
+
+	iter := tx.txn.NewIterator(iterOpts)
+	defer iter.Close()
+
+	var count int64 = 0
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		count++
+	}
+	return count, nil
+}
+
+// SlotKeys implements sdk.Operations.
+func (tx *Tx) SlotKeys(slot int, cursor []byte, count int) (keys [][]byte, next []byte, err error) {
+	prefix := slotPrefix(slot)
+
+	iterOpts := badger.DefaultIteratorOptions
+	iterOpts.PrefetchValues = false
+	iterOpts.Prefix = prefix
+
+	iter := tx.txn.NewIterator(iterOpts)
+	defer iter.Close()
+
+	for iter.Seek(append(prefix, cursor...)); iter.Valid(); iter.Next() {
+		key := iter.Item().KeyCopy(nil)[len(prefix):]
+		if count > 0 && len(keys) >= count {
+			return keys, key, nil
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil, nil
+}
+
+// Ttl implements sdk.Operations.
+func (tx *Tx) Ttl(key []byte) (ok bool, ttl int64, err error) {
+	item, err := tx.lookup(key, 0)
+	if err != nil {
+		return false, sdk.NONE_TTL, tx.check(err)
+	}
+	if item == nil {
+		return false, sdk.NONE_TTL, nil
+	}
+
+	var expireAt uint64 = item.ExpiresAt()
+	if expireAt == 0 {
+		return true, sdk.UNSET_LEASE, nil
+	}
+
+	var now uint64 = uint64(time.Now().Unix())
+	if now > expireAt {
+		return false, sdk.NONE_TTL, nil
+	}
+	return true, int64(expireAt - now), nil
+}
+
+// Type implements sdk.Operations.
+func (tx *Tx) Type(key []byte) (string, error) {
+	item, err := tx.lookup(key, 0)
+	if err != nil {
+		return sdk.TYPE_NONE, tx.check(err)
+	}
+	if item == nil {
+		return sdk.TYPE_NONE, nil
+	}
+	return typeName(item.UserMeta()), nil
+}
+
+// getInteger reads the integer stored at key into number. The returned
+// item is nil if the key does not exist.
+func (tx *Tx) getInteger(key []byte, number *int64) (*badger.Item, error) {
+	*number = 0
+
+	item, err := tx.lookup(key, __TYPE_STRING)
+	if err != nil || item == nil {
+		return nil, err
+	}
+
+	err = item.Value(func(val []byte) error {
+		n, err := strconv.ParseInt(string(val), 10, 64)
+		if err != nil {
+			return sdk.ErrNonInteger
+		}
+
+		*number = n
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// setInteger writes number to key and retains the expiry of item.
+func (tx *Tx) setInteger(key []byte, number int64, item *badger.Item) error {
+	entry := badger.NewEntry(encodeKey(key), []byte(strconv.FormatInt(number, 10))).
+		WithMeta(__TYPE_STRING).
+		WithDiscard()
+
+	if item != nil {
+		entry.ExpiresAt = item.ExpiresAt()
+	}
+	return tx.setKey(entry)
+}
+
+// scanElements iterates the elements of the collection which badger keys
+// start with prefix, and calls fn with each element. It stops after opts.Limit
+// elements examined, including the ones filtered by opts.Match, as Scan does,
+// and returns the element where the next scan starts from.
+func (tx *Tx) scanElements(prefix []byte, cursor []byte, opts sdk.ScanOptions, fn func(element []byte, item *badger.Item) error) (next []byte, err error) {
+	iterOpts := badger.DefaultIteratorOptions
+	iterOpts.PrefetchValues = opts.PrefetchValues
+	iterOpts.Prefix = prefix
+
+	iter := tx.txn.NewIterator(iterOpts)
+	defer iter.Close()
+
+	var (
+		count int = 0
+		seek      = append(append([]byte{}, prefix...), cursor...)
+	)
+	for iter.Seek(seek); iter.Valid(); iter.Next() {
+		item := iter.Item()
+		element := item.Key()[len(prefix):]
+
+		if opts.Limit > 0 && count >= opts.Limit {
+			return append([]byte{}, element...), nil
+		}
+		count++
+
+		if len(opts.Match) > 0 && !sdk.MatchPattern(opts.Match, element) {
+			continue
+		}
+
+		err = fn(append([]byte{}, element...), item)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
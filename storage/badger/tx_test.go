@@ -0,0 +1,72 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDB_IncrBy_Expiry(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	var key = []byte("counter")
+
+	if _, err := db.IncrBy(key, 1, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// the lease applies to new keys only
+	if _, err := db.IncrBy(key, 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	_, ttl, err := db.Ttl(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl <= 60 {
+		t.Errorf("expect the expiry of the first write, but got ttl %d", ttl)
+	}
+
+	if _, err := db.Expire(key, 30*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.IncrByFloat(key, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	_, ttl, err = db.Ttl(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl <= 0 || ttl > 30 {
+		t.Errorf("expect the expiry to be retained, but got ttl %d", ttl)
+	}
+	// the sub-second lease is rounded up to the next second
+	key = []byte("counter:px")
+	if _, err := db.IncrBy(key, 1, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.IncrByFloat([]byte("counter:px:float"), 1, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range [][]byte{key, []byte("counter:px:float")} {
+		if _, err := db.Get(key); err != nil {
+			t.Errorf("expect %s to live at least the lease, but got %v", key, err)
+		}
+	}
+	time.Sleep(1100 * time.Millisecond)
+	for _, key := range [][]byte{key, []byte("counter:px:float")} {
+		if _, err := db.Get(key); !errors.Is(err, sdk.ErrNil) {
+			t.Errorf("expect %s to expire, but got %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,679 @@
+package badger
+
+import (
+	"badgerlit/sdk"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// scoreIterator iterates the members of a sorted set in the order of
+// score and then member.
+type scoreIterator struct {
+	iter    *badger.Iterator
+	prefix  []byte
+	reverse bool
+}
+
+func (tx *Tx) newScoreIterator(key []byte, id uint64, reverse bool) *scoreIterator {
+	iterOpts := badger.DefaultIteratorOptions
+	iterOpts.PrefetchValues = false
+	iterOpts.Reverse = reverse
+
+	return &scoreIterator{
+		iter:    tx.txn.NewIterator(iterOpts),
+		prefix:  zsetScorePrefix(key, id),
+		reverse: reverse,
+	}
+}
+
+// seek moves to the first entry at or after score in the direction of the
+// iterator.
+func (it *scoreIterator) seek(score float64) {
+	k := append(append([]byte{}, it.prefix...), encodeScore(score)...)
+	if it.reverse {
+		k = prefixUpperBound(k)
+	}
+	it.iter.Seek(k)
+}
+
+func (it *scoreIterator) rewind() {
+	if it.reverse {
+		it.iter.Seek(prefixUpperBound(it.prefix))
+	} else {
+		it.iter.Seek(it.prefix)
+	}
+}
+
+func (it *scoreIterator) valid() bool {
+	return it.iter.ValidForPrefix(it.prefix)
+}
+
+func (it *scoreIterator) next() {
+	it.iter.Next()
+}
+
+// entry returns the score and a copy of the member of the current entry.
+func (it *scoreIterator) entry() sdk.ScoredMember {
+	k := it.iter.Item().Key()[len(it.prefix):]
+	return sdk.ScoredMember{
+		Member: append([]byte{}, k[8:]...),
+		Score:  decodeScore(k[:8]),
+	}
+}
+
+func (it *scoreIterator) close() {
+	it.iter.Close()
+}
+
+// lookupScore returns the score of the member of the sorted set.
+func (tx *Tx) lookupScore(key []byte, id uint64, member []byte) (score float64, ok bool, err error) {
+	item, err := tx.txn.Get(zsetMemberKey(key, id, member))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	err = item.Value(func(val []byte) error {
+		if len(val) != 8 {
+			return errInvalidMetadata
+		}
+		score = decodeScore(val)
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return score, true, nil
+}
+
+// setScore writes the member to both index spaces, and removes the entry
+// of the old score if the member exists.
+func (tx *Tx) setScore(key []byte, id uint64, member []byte, score float64, old float64, exists bool) error {
+	if exists {
+		err := tx.txn.Delete(zsetScoreKey(key, id, old, member))
+		if err != nil {
+			return err
+		}
+	}
+
+	entry := badger.NewEntry(zsetMemberKey(key, id, member), encodeScore(score)).
+		WithDiscard()
+
+	err := tx.txn.SetEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	entry = badger.NewEntry(zsetScoreKey(key, id, score, member), nil).
+		WithDiscard()
+
+	err = tx.txn.SetEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		err = tx.addCount(key, id, old, -1)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.addCount(key, id, score, 1)
+}
+
+// addCount adds delta to the counters of every prefix of the encoded score.
+// The counters which drop to zero are deleted.
+func (tx *Tx) addCount(key []byte, id uint64, score float64, delta int64) error {
+	encoded := encodeScore(score)
+
+	for i := 1; i <= len(encoded); i++ {
+		k := zsetCountKey(key, id, encoded[:i])
+
+		var count int64 = 0
+		item, err := tx.txn.Get(k)
+		switch {
+		case err == nil:
+			count, err = decodeCount(item)
+			if err != nil {
+				return err
+			}
+		case !errors.Is(err, badger.ErrKeyNotFound):
+			return err
+		}
+
+		count += delta
+		if count <= 0 {
+			err = tx.txn.Delete(k)
+		} else {
+			entry := badger.NewEntry(k, binary.BigEndian.AppendUint64(nil, uint64(count))).
+				WithDiscard()
+			err = tx.txn.SetEntry(entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countBelow returns the number of the members whose scores are lower than
+// score. At each prefix length, the counters of the lower siblings of the
+// prefix of the score are summed, so no more than 256 counters are read
+// per byte of the encoded score.
+func (tx *Tx) countBelow(key []byte, id uint64, score float64) (int64, error) {
+	encoded := encodeScore(score)
+
+	iter := tx.txn.NewIterator(badger.DefaultIteratorOptions)
+	defer iter.Close()
+
+	var count int64 = 0
+	for i := 0; i < len(encoded); i++ {
+		prefix := zsetCountPrefix(key, id, encoded[:i])
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			if iter.Item().Key()[len(prefix)] >= encoded[i] {
+				break
+			}
+			n, err := decodeCount(iter.Item())
+			if err != nil {
+				return 0, err
+			}
+			count += n
+		}
+	}
+	return count, nil
+}
+
+// scoreAt returns the score of the member ranked rank, which is found by
+// descending the counters from the shortest prefix. It also returns the
+// rank of the member among the members of the same score, and the number
+// of them.
+func (tx *Tx) scoreAt(key []byte, id uint64, rank int64) (score float64, offset int64, ties int64, err error) {
+	iter := tx.txn.NewIterator(badger.DefaultIteratorOptions)
+	defer iter.Close()
+
+	var encoded []byte
+	for len(encoded) < 8 {
+		var (
+			prefix = zsetCountPrefix(key, id, encoded)
+			found  = false
+		)
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			n, err := decodeCount(iter.Item())
+			if err != nil {
+				return 0, 0, 0, err
+			}
+			if rank < n {
+				encoded = append(encoded, iter.Item().Key()[len(prefix)])
+				ties = n
+				found = true
+				break
+			}
+			rank -= n
+		}
+		if !found {
+			return 0, 0, 0, errInvalidMetadata
+		}
+	}
+	return decodeScore(encoded), rank, ties, nil
+}
+
+func decodeCount(item *badger.Item) (count int64, err error) {
+	err = item.Value(func(val []byte) error {
+		if len(val) != 8 {
+			return errInvalidMetadata
+		}
+		count = int64(binary.BigEndian.Uint64(val))
+		return nil
+	})
+	return count, err
+}
+
+// ZAdd implements sdk.Operations.
+func (tx *Tx) ZAdd(key []byte, opts sdk.ZAddOptions, members ...sdk.ScoredMember) (int64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_ZSET)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		m, err = tx.newMetadata()
+		if err != nil {
+			return 0, tx.check(err)
+		}
+	}
+
+	var (
+		added   int64 = 0
+		changed int64 = 0
+	)
+	for _, sm := range members {
+		old, exists, err := tx.lookupScore(key, m.id, sm.Member)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+
+		switch {
+		case exists && opts.IfNotExists:
+			continue
+		case !exists && opts.IfExists:
+			continue
+		case exists && opts.GreaterThan && sm.Score <= old:
+			continue
+		case exists && opts.LessThan && sm.Score >= old:
+			continue
+		case exists && sm.Score == old:
+			continue
+		}
+
+		err = tx.setScore(key, m.id, sm.Member, sm.Score, old, exists)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		if !exists {
+			added++
+		}
+		changed++
+	}
+
+	m.length += added
+	err = tx.setMetadata(key, __TYPE_ZSET, m, item)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	if changed > 0 {
+		tx.emit("zadd", key)
+	}
+
+	if opts.Changed {
+		return changed, nil
+	}
+	return added, nil
+}
+
+// ZCard implements sdk.Operations.
+func (tx *Tx) ZCard(key []byte) (int64, error) {
+	_, m, err := tx.lookupMetadata(key, __TYPE_ZSET)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	return m.length, nil
+}
+
+// ZIncrBy implements sdk.Operations.
+func (tx *Tx) ZIncrBy(key []byte, member []byte, increment float64, constraints ...sdk.Constraint[float64]) (float64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_ZSET)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		m, err = tx.newMetadata()
+		if err != nil {
+			return 0, tx.check(err)
+		}
+	}
+
+	old, exists, err := tx.lookupScore(key, m.id, member)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	// add increment
+	result := old + increment
+	if math.IsNaN(result) {
+		return 0, sdk.ErrNaN
+	}
+
+	// check
+	for _, constraint := range constraints {
+		ok := constraint.Check(result)
+		if !ok {
+			return 0, sdk.ErrViolateConstraints
+		}
+	}
+
+	err = tx.setScore(key, m.id, member, result, old, exists)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	if !exists {
+		m.length++
+	}
+	err = tx.setMetadata(key, __TYPE_ZSET, m, item)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	tx.emit("zincr", key)
+	return result, nil
+}
+
+// ZRange implements sdk.Operations.
+func (tx *Tx) ZRange(key []byte, start, stop int64, reverse bool) ([]sdk.ScoredMember, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_ZSET)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	if item == nil {
+		return nil, nil
+	}
+
+	// normalize the range
+	if start < 0 {
+		start += m.length
+	}
+	if stop < 0 {
+		stop += m.length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= m.length {
+		stop = m.length - 1
+	}
+	if start > stop {
+		return nil, nil
+	}
+
+	// NOTE: the iteration starts from the score of the member ranked start,
+	// which is found by the counters, and skips the members of the same
+	// score ahead of it.
+	first := start
+	if reverse {
+		first = m.length - 1 - start
+	}
+	score, offset, ties, err := tx.scoreAt(key, m.id, first)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	if reverse {
+		offset = ties - 1 - offset
+	}
+
+	it := tx.newScoreIterator(key, m.id, reverse)
+	defer it.close()
+
+	reply := make([]sdk.ScoredMember, 0, stop-start+1)
+	for it.seek(score); it.valid() && int64(len(reply)) <= stop-start; it.next() {
+		if offset > 0 {
+			offset--
+			continue
+		}
+		reply = append(reply, it.entry())
+	}
+	return reply, nil
+}
+
+// ZRangeByScore implements sdk.Operations.
+func (tx *Tx) ZRangeByScore(key []byte, min, max sdk.ScoreBound, opts sdk.ZRangeOptions) ([]sdk.ScoredMember, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_ZSET)
+	if err != nil {
+		return nil, tx.check(err)
+	}
+	if item == nil || opts.Offset < 0 {
+		return nil, nil
+	}
+
+	// NOTE: from is the bound where the iteration starts, and to is the
+	// bound where it stops.
+	var (
+		from    = min
+		to      = max
+		reached = func(score float64) bool {
+			return score > to.Value || (to.Exclusive && score == to.Value)
+		}
+	)
+	if opts.Reverse {
+		from, to = max, min
+		reached = func(score float64) bool {
+			return score < to.Value || (to.Exclusive && score == to.Value)
+		}
+	}
+
+	it := tx.newScoreIterator(key, m.id, opts.Reverse)
+	defer it.close()
+
+	var (
+		reply  []sdk.ScoredMember
+		offset = opts.Offset
+	)
+	for it.seek(from.Value); it.valid(); it.next() {
+		entry := it.entry()
+		if from.Exclusive && entry.Score == from.Value {
+			continue
+		}
+		if reached(entry.Score) {
+			break
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		reply = append(reply, entry)
+		if opts.Count > 0 && int64(len(reply)) >= opts.Count {
+			break
+		}
+	}
+	return reply, nil
+}
+
+// ZRank implements sdk.Operations. The members of lower scores are counted
+// by the counters, and the members of the same score are iterated.
+func (tx *Tx) ZRank(key []byte, member []byte, reverse bool) (int64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_ZSET)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		return 0, sdk.ErrNil
+	}
+
+	score, ok, err := tx.lookupScore(key, m.id, member)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if !ok {
+		return 0, sdk.ErrNil
+	}
+
+	rank, err := tx.countBelow(key, m.id, score)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	target := zsetScoreKey(key, m.id, score, member)
+
+	it := tx.newScoreIterator(key, m.id, false)
+	defer it.close()
+
+	for it.seek(score); it.valid(); it.next() {
+		if bytes.Equal(it.iter.Item().Key(), target) {
+			if reverse {
+				return m.length - 1 - rank, nil
+			}
+			return rank, nil
+		}
+		rank++
+	}
+	return 0, sdk.ErrNil
+}
+
+// ZRem implements sdk.Operations.
+func (tx *Tx) ZRem(key []byte, members ...[]byte) (int64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_ZSET)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		return 0, nil
+	}
+
+	var count int64 = 0
+	for _, member := range members {
+		score, ok, err := tx.lookupScore(key, m.id, member)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		if !ok {
+			continue
+		}
+
+		err = tx.txn.Delete(zsetMemberKey(key, m.id, member))
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		err = tx.txn.Delete(zsetScoreKey(key, m.id, score, member))
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		err = tx.addCount(key, m.id, score, -1)
+		if err != nil {
+			return 0, tx.check(err)
+		}
+		count++
+	}
+
+	m.length -= count
+	err = tx.setMetadata(key, __TYPE_ZSET, m, item)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+
+	if count > 0 {
+		tx.emit("zrem", key)
+		if m.length <= 0 {
+			tx.emit("del", key)
+		}
+	}
+	return count, nil
+}
+
+// ZScore implements sdk.Operations.
+func (tx *Tx) ZScore(key []byte, member []byte) (float64, error) {
+	item, m, err := tx.lookupMetadata(key, __TYPE_ZSET)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if item == nil {
+		return 0, sdk.ErrNil
+	}
+
+	score, ok, err := tx.lookupScore(key, m.id, member)
+	if err != nil {
+		return 0, tx.check(err)
+	}
+	if !ok {
+		return 0, sdk.ErrNil
+	}
+	return score, nil
+}
+
+// ZAdd implements sdk.Storage.
+func (db *DB) ZAdd(key []byte, opts sdk.ZAddOptions, members ...sdk.ScoredMember) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		count, err = tx.ZAdd(key, opts, members...)
+		return err
+	})
+	return count, err
+}
+
+// ZCard implements sdk.Storage.
+func (db *DB) ZCard(key []byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		count, err = tx.ZCard(key)
+		return err
+	})
+	return count, err
+}
+
+// ZIncrBy implements sdk.Storage.
+func (db *DB) ZIncrBy(key []byte, member []byte, increment float64, constraints ...sdk.Constraint[float64]) (result float64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		result, err = tx.ZIncrBy(key, member, increment, constraints...)
+		return err
+	})
+	return result, err
+}
+
+// ZRange implements sdk.Storage.
+func (db *DB) ZRange(key []byte, start, stop int64, reverse bool) (members []sdk.ScoredMember, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		members, err = tx.ZRange(key, start, stop, reverse)
+		return err
+	})
+	return members, err
+}
+
+// ZRangeByScore implements sdk.Storage.
+func (db *DB) ZRangeByScore(key []byte, min, max sdk.ScoreBound, opts sdk.ZRangeOptions) (members []sdk.ScoredMember, err error) {
+	if !db.running {
+		return nil, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		members, err = tx.ZRangeByScore(key, min, max, opts)
+		return err
+	})
+	return members, err
+}
+
+// ZRank implements sdk.Storage.
+func (db *DB) ZRank(key []byte, member []byte, reverse bool) (rank int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		rank, err = tx.ZRank(key, member, reverse)
+		return err
+	})
+	return rank, err
+}
+
+// ZRem implements sdk.Storage.
+func (db *DB) ZRem(key []byte, members ...[]byte) (count int64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.update(func(tx *Tx) error {
+		count, err = tx.ZRem(key, members...)
+		return err
+	})
+	return count, err
+}
+
+// ZScore implements sdk.Storage.
+func (db *DB) ZScore(key []byte, member []byte) (score float64, err error) {
+	if !db.running {
+		return 0, sdk.ErrDatabaseUnavailable
+	}
+
+	err = db.view(func(tx *Tx) error {
+		score, err = tx.ZScore(key, member)
+		return err
+	})
+	return score, err
+}
@@ -0,0 +1,181 @@
+package badger_test
+
+import (
+	"badgerlit/sdk"
+	"badgerlit/storage/badger"
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDB_ZSet(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	var key = []byte("leaderboard")
+
+	count, err := db.ZAdd(key, sdk.ZAddOptions{},
+		sdk.ScoredMember{Member: []byte("a"), Score: 2.5},
+		sdk.ScoredMember{Member: []byte("b"), Score: -1},
+		sdk.ScoredMember{Member: []byte("c"), Score: 100},
+		sdk.ScoredMember{Member: []byte("d"), Score: 0},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("expect 4 members added, but got %d", count)
+	}
+
+	score, err := db.ZIncrBy(key, []byte("b"), -2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score != -3 {
+		t.Errorf("expect score -3, but got %v", score)
+	}
+
+	_, err = db.ZIncrBy(key, []byte("b"), -1, sdk.NumberNonNegativeValue())
+	if err != sdk.ErrViolateConstraints {
+		t.Errorf("expect %v, but got %v", sdk.ErrViolateConstraints, err)
+	}
+
+	members, err := db.ZRange(key, 0, -1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := joinMembers(members); got != "b,d,a,c" {
+		t.Errorf("expect %q, but got %q", "b,d,a,c", got)
+	}
+
+	members, err = db.ZRangeByScore(key,
+		sdk.ScoreBound{Value: 0, Exclusive: true},
+		sdk.ScoreBound{Value: math.Inf(1)},
+		sdk.ZRangeOptions{Reverse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := joinMembers(members); got != "c,a" {
+		t.Errorf("expect %q, but got %q", "c,a", got)
+	}
+
+	rank, err := db.ZRank(key, []byte("a"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rank != 2 {
+		t.Errorf("expect rank 2, but got %d", rank)
+	}
+}
+
+func TestDB_ZSet_Rank(t *testing.T) {
+	config := sdk.Config{
+		Engine:             "memory",
+		KeyDiscardInterval: 5 * time.Second,
+		KeyDiscardRatio:    0.7,
+	}
+
+	db := badger.New(&config)
+	db.Start(context.Background())
+	defer db.Stop(context.Background())
+
+	var key = []byte("ranks")
+
+	// the scores spread over both signs and tie in groups of three, and
+	// some members are moved and removed afterwards
+	var members []sdk.ScoredMember
+	for i := 0; i < 300; i++ {
+		members = append(members, sdk.ScoredMember{
+			Member: []byte(fmt.Sprintf("m%03d", i)),
+			Score:  float64(i/3-50) * 1.5,
+		})
+	}
+	_, err := db.ZAdd(key, sdk.ZAddOptions{}, members...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 300; i += 7 {
+		_, err = db.ZIncrBy(key, []byte(fmt.Sprintf("m%03d", i)), 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i < 300; i += 11 {
+		_, err = db.ZRem(key, []byte(fmt.Sprintf("m%03d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := db.ZRangeByScore(key,
+		sdk.ScoreBound{Value: math.Inf(-1)},
+		sdk.ScoreBound{Value: math.Inf(1)},
+		sdk.ZRangeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	length := int64(len(expected))
+
+	for i, member := range expected {
+		rank, err := db.ZRank(key, member.Member, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rank != int64(i) {
+			t.Errorf("%s: expect rank %d, but got %d", member.Member, i, rank)
+		}
+		rank, err = db.ZRank(key, member.Member, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rank != length-1-int64(i) {
+			t.Errorf("%s: expect reverse rank %d, but got %d", member.Member, length-1-int64(i), rank)
+		}
+	}
+
+	for start := int64(0); start < length; start += 5 {
+		members, err := db.ZRange(key, start, start+3, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stop := start + 4
+		if stop > length {
+			stop = length
+		}
+		if got, want := joinMembers(members), joinMembers(expected[start:stop]); got != want {
+			t.Errorf("range %d: expect %q, but got %q", start, want, got)
+		}
+
+		members, err = db.ZRange(key, start, start+3, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reversed []sdk.ScoredMember
+		for i := length - 1 - start; i >= 0 && i > length-1-stop; i-- {
+			reversed = append(reversed, expected[i])
+		}
+		if got, want := joinMembers(members), joinMembers(reversed); got != want {
+			t.Errorf("reverse range %d: expect %q, but got %q", start, want, got)
+		}
+	}
+}
+
+func joinMembers(members []sdk.ScoredMember) string {
+	var s string
+	for i, member := range members {
+		if i > 0 {
+			s += ","
+		}
+		s += string(member.Member)
+	}
+	return s
+}